@@ -0,0 +1,210 @@
+// Package analytics works out punctuality figures, like the Public Performance Measure, from collections of services
+package analytics
+
+import (
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// Stats are punctuality figures over a set of services or calls. Only calls with an actual time, or which
+// are cancelled, are counted; calls which haven't happened yet or have no realtime data are left out
+type Stats struct {
+
+	// Counted is the number of calls with an outcome, Cancelled are those which were cancelled
+	Counted, Cancelled int
+
+	// RightTime arrived early or within a minute, Within5 and Within10 within five and ten minutes
+	RightTime, Within5, Within10 int
+
+	// TotalDelay is the sum of delays of calls which ran, counting early running as no delay
+	TotalDelay time.Duration
+}
+
+// percent gives n as a percentage of everything counted
+func (s Stats) percent(n int) float64 {
+	if s.Counted == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(s.Counted)
+}
+
+// OnTime5 is the percentage arriving within five minutes, cancellations count as late
+func (s Stats) OnTime5() float64 {
+	return s.percent(s.Within5)
+}
+
+// OnTime10 is the percentage arriving within ten minutes, cancellations count as late
+func (s Stats) OnTime10() float64 {
+	return s.percent(s.Within10)
+}
+
+// RightTimePercent is the percentage arriving early or within a minute, cancellations count as late
+func (s Stats) RightTimePercent() float64 {
+	return s.percent(s.RightTime)
+}
+
+// CancelledPercent is the percentage which were cancelled
+func (s Stats) CancelledPercent() float64 {
+	return s.percent(s.Cancelled)
+}
+
+// AverageDelay is the mean delay of calls which ran, counting early running as no delay
+func (s Stats) AverageDelay() time.Duration {
+	ran := s.Counted - s.Cancelled
+	if ran == 0 {
+		return 0
+	}
+	return s.TotalDelay / time.Duration(ran)
+}
+
+// add counts an outcome into the figures
+func (s *Stats) add(o outcome) {
+	s.Counted++
+	if o.cancelled {
+		s.Cancelled++
+		return
+	}
+
+	delay := o.delay
+	if delay < 0 {
+		delay = 0
+	}
+	s.TotalDelay += delay
+
+	if delay < time.Minute {
+		s.RightTime++
+	}
+	if delay <= 5*time.Minute {
+		s.Within5++
+	}
+	if delay <= 10*time.Minute {
+		s.Within10++
+	}
+}
+
+// outcome is how a single call turned out, compared to the timetable
+type outcome struct {
+	booked    time.Time
+	delay     time.Duration
+	cancelled bool
+}
+
+// callOutcome compares the actual time of a call to its booked time, using the arrival where there is one
+// and the departure otherwise. It returns false when the call hasn't got an outcome yet
+func callOutcome(location model.LocationDetail, service model.Service) (outcome, bool) {
+
+	booked, bookedErr := location.BookedArrivalTime(service.RunDate)
+	realtime, realtimeErr := location.RealtimeArrivalTime(service.RunDate)
+	actual := location.RealTimeArrivalActual
+	if bookedErr == model.ErrNoTime {
+		booked, bookedErr = location.BookedDepartureTime(service.RunDate)
+		realtime, realtimeErr = location.RealtimeDepartureTime(service.RunDate)
+		actual = location.RealTimeDepartureActual
+	}
+	if bookedErr != nil {
+		return outcome{}, false
+	}
+
+	switch {
+	case service.PlannedCancel || location.Cancelled():
+		return outcome{booked: booked, cancelled: true}, true
+	case realtimeErr != nil || !actual:
+		return outcome{}, false
+	}
+	return outcome{booked: booked, delay: realtime.Sub(booked)}, true
+}
+
+// destination returns the call at the end of a service's journey, the last public call when
+// its booked destination can't be found
+func destination(service model.Service) (model.LocationDetail, bool) {
+	if len(service.Destination) > 0 {
+		for i := len(service.Locations) - 1; i >= 0; i-- {
+			if service.Locations[i].TIPLOC == service.Destination[0].TIPLOC {
+				return service.Locations[i], true
+			}
+		}
+	}
+
+	calls := service.PublicCalls()
+	if len(calls) == 0 {
+		return model.LocationDetail{}, false
+	}
+	return calls[len(calls)-1], true
+}
+
+// serviceOutcome is how a service turned out at its destination, the measure PPM uses
+func serviceOutcome(service model.Service) (outcome, bool) {
+	location, ok := destination(service)
+	if !ok {
+		return outcome{}, false
+	}
+	return callOutcome(location, service)
+}
+
+// groupServices counts each service's outcome at its destination into groups picked by key
+func groupServices(services []model.Service, key func(model.Service, outcome) string) map[string]Stats {
+	groups := make(map[string]Stats)
+	for _, service := range services {
+		o, ok := serviceOutcome(service)
+		if !ok {
+			continue
+		}
+		k := key(service, o)
+		stats := groups[k]
+		stats.add(o)
+		groups[k] = stats
+	}
+	return groups
+}
+
+// Summarise works out the figures over all services, measured at their destinations
+func Summarise(services []model.Service) Stats {
+	return groupServices(services, func(model.Service, outcome) string { return "" })[""]
+}
+
+// ByOperator works out the figures for each operator, keyed by ATOC code
+func ByOperator(services []model.Service) map[string]Stats {
+	return groupServices(services, func(s model.Service, _ outcome) string { return s.ATOCCode })
+}
+
+// ByService works out the figures for each service UID, across all of the dates it ran
+func ByService(services []model.Service) map[string]Stats {
+	return groupServices(services, func(s model.Service, _ outcome) string { return s.ServiceUID })
+}
+
+// ByHour works out the figures for each hour of the day, by booked arrival at destination in UK time
+func ByHour(services []model.Service) map[int]Stats {
+	hours := make(map[int]Stats)
+	for _, service := range services {
+		o, ok := serviceOutcome(service)
+		if !ok {
+			continue
+		}
+		hour := o.booked.In(model.London).Hour()
+		stats := hours[hour]
+		stats.add(o)
+		hours[hour] = stats
+	}
+	return hours
+}
+
+// ByStation works out the figures for every public call at each station, keyed by CRS
+func ByStation(services []model.Service) map[string]Stats {
+	stations := make(map[string]Stats)
+	for _, service := range services {
+		for _, location := range service.PublicCalls() {
+			if location.CRS == "" {
+				continue
+			}
+			o, ok := callOutcome(location, service)
+			if !ok {
+				continue
+			}
+			stats := stations[location.CRS]
+			stats.add(o)
+			stations[location.CRS] = stats
+		}
+	}
+	return stations
+}
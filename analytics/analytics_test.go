@@ -0,0 +1,115 @@
+package analytics
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+	"github.com/georgeprice/realtime-trains-golang/model/modeltest"
+)
+
+// newService builds a service from modeltest run by an operator
+func newService(uid, operator string, calls ...modeltest.Call) model.Service {
+	service := modeltest.Service(uid, calls...)
+	service.ATOCCode = operator
+	return service
+}
+
+var services = []model.Service{
+	newService("A1", "SW",
+		modeltest.Call{CRS: "BMH", Departure: "0800", RealDeparture: "0800", Actual: true},
+		modeltest.Call{CRS: "WAT", Arrival: "0930", RealArrival: "0933", Actual: true}),
+	newService("A2", "SW",
+		modeltest.Call{CRS: "BMH", Departure: "0800", RealDeparture: "0801", Actual: true},
+		modeltest.Call{CRS: "WAT", Arrival: "0930", RealArrival: "0929", Actual: true}),
+	newService("A1", "SW",
+		modeltest.Call{CRS: "BMH", Departure: "0845", RealDeparture: "0850", Actual: true},
+		modeltest.Call{CRS: "WAT", Arrival: "1015", RealArrival: "1027", Actual: true}),
+	newService("B1", "XC",
+		modeltest.Call{CRS: "BMH", Departure: "0830", RealDeparture: "0830", Actual: true},
+		modeltest.Call{CRS: "MAN", Arrival: "1100", Cancelled: true}),
+	newService("B2", "XC",
+		modeltest.Call{CRS: "BMH", Departure: "0900", RealDeparture: "0902", Actual: true},
+		modeltest.Call{CRS: "MAN", Arrival: "1130", RealArrival: "1132"}),
+	newService("B3", "XC",
+		modeltest.Call{CRS: "BMH", Departure: "0730", RealDeparture: "0738", Actual: true},
+		modeltest.Call{CRS: "MAN", Arrival: "1000", RealArrival: "1008", Actual: true}),
+}
+
+// approx compares percentages to a couple of decimal places
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 0.01
+}
+
+func TestSummarise(t *testing.T) {
+	stats := Summarise(services)
+
+	expected := Stats{Counted: 5, Cancelled: 1, RightTime: 1, Within5: 2, Within10: 3, TotalDelay: 23 * time.Minute}
+	if stats != expected {
+		t.Fatalf("Got wrong figures, got %+v, expected %+v", stats, expected)
+	}
+
+	switch {
+	case !approx(stats.OnTime5(), 40):
+		t.Errorf("Got wrong on time within 5, got %f", stats.OnTime5())
+	case !approx(stats.OnTime10(), 60):
+		t.Errorf("Got wrong on time within 10, got %f", stats.OnTime10())
+	case !approx(stats.RightTimePercent(), 20):
+		t.Errorf("Got wrong right time, got %f", stats.RightTimePercent())
+	case !approx(stats.CancelledPercent(), 20):
+		t.Errorf("Got wrong cancelled, got %f", stats.CancelledPercent())
+	case stats.AverageDelay() != 23*time.Minute/4:
+		t.Errorf("Got wrong average delay, got %v", stats.AverageDelay())
+	}
+
+	if empty := Summarise(nil); empty.OnTime5() != 0 || empty.AverageDelay() != 0 {
+		t.Errorf("Got figures from no services, got %+v", empty)
+	}
+}
+
+func TestGroups(t *testing.T) {
+
+	t.Run("ByOperator", func(t *testing.T) {
+		operators := ByOperator(services)
+		if sw := operators["SW"]; sw.Counted != 3 || sw.Within5 != 2 || sw.RightTime != 1 {
+			t.Errorf("Got wrong figures for SW, got %+v", sw)
+		}
+		if xc := operators["XC"]; xc.Counted != 2 || xc.Cancelled != 1 || xc.Within10 != 1 {
+			t.Errorf("Got wrong figures for XC, got %+v", xc)
+		}
+	})
+
+	t.Run("ByService", func(t *testing.T) {
+		uids := ByService(services)
+		if a1 := uids["A1"]; a1.Counted != 2 || a1.Within5 != 1 || a1.AverageDelay() != 15*time.Minute/2 {
+			t.Errorf("Got wrong figures for A1, got %+v", a1)
+		}
+		if _, ok := uids["B2"]; ok {
+			t.Errorf("Got figures for a service which hasn't arrived")
+		}
+	})
+
+	t.Run("ByHour", func(t *testing.T) {
+		hours := ByHour(services)
+		if len(hours) != 3 {
+			t.Errorf("Got wrong number of hours, got %d, expected 3", len(hours))
+		}
+		if nine := hours[9]; nine.Counted != 2 || nine.RightTime != 1 {
+			t.Errorf("Got wrong figures for 09:00, got %+v", nine)
+		}
+		if ten := hours[10]; ten.Counted != 2 || ten.Within10 != 1 {
+			t.Errorf("Got wrong figures for 10:00, got %+v", ten)
+		}
+	})
+
+	t.Run("ByStation", func(t *testing.T) {
+		stations := ByStation(services)
+		if bmh := stations["BMH"]; bmh.Counted != 6 || bmh.RightTime != 2 || bmh.Within5 != 5 || bmh.Within10 != 6 {
+			t.Errorf("Got wrong figures for BMH, got %+v", bmh)
+		}
+		if man := stations["MAN"]; man.Counted != 2 || man.Cancelled != 1 {
+			t.Errorf("Got wrong figures for MAN, got %+v", man)
+		}
+	})
+}
@@ -0,0 +1,278 @@
+// Package announce renders lineups and services as station announcements, like "The next train to depart
+// from platform 3 will be the 01:18 South Western Railway service to Poole, calling at ...". Each kind of
+// announcement is a text/template, rendered with Data, and any of them can be replaced
+package announce
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// ErrNotAtLocation is returned when a service doesn't visit the location it is being announced at
+var ErrNotAtLocation = errors.New("announce: service does not visit location")
+
+// Kind is a kind of announcement
+type Kind string
+
+// Departure announces the next train to leave
+// Arrival announces a train terminating at the station
+// Delay apologises for a late train
+// PlatformChange announces a train moving platform
+// Cancellation apologises for a cancelled train, with its reason where RTT has one
+const (
+	Departure      Kind = "departure"
+	Arrival        Kind = "arrival"
+	Delay          Kind = "delay"
+	PlatformChange Kind = "platform-change"
+	Cancellation   Kind = "cancellation"
+)
+
+// Kinds lists every kind of announcement, in the order they are chosen, see Announcer.Kind
+var Kinds = []Kind{Cancellation, PlatformChange, Delay, Arrival, Departure}
+
+// DefaultTemplates are the announcements used unless New is given others
+var DefaultTemplates = map[Kind]string{
+	Departure: `The next train to depart{{with .Platform}} from platform {{.}}{{end}} will be the {{.Service}}` +
+		`{{with .CallingAt}}, calling at {{list .}}{{end}}.`,
+	Arrival: `The next train to arrive{{with .Platform}} at platform {{.}}{{end}} will be the {{.Service}}. ` +
+		`This train terminates here.`,
+	Delay: `We are sorry to announce that the {{.Service}} is delayed by approximately {{.Minutes}} ` +
+		`{{if eq .Minutes 1}}minute{{else}}minutes{{end}}{{with .Expected}}, and is now expected at {{.}}{{end}}.`,
+	PlatformChange: `Platform alteration. The {{.Service}} will now {{if .Terminates}}arrive at{{else}}depart from{{end}} ` +
+		`platform {{.Platform}}.`,
+	Cancellation: `We are sorry to announce that the {{.Service}} has been cancelled{{with .Reason}}. ` +
+		`This is due to {{.}}{{end}}.`,
+}
+
+// DefaultLate is how late a train is before Announcer.Kind chooses a delay announcement
+const DefaultLate = 5 * time.Minute
+
+// Data is what announcements are rendered with
+type Data struct {
+
+	// Station is the name of the location being announced at
+	Station string
+
+	// Time is the booked time at the station, e.g. 01:18, and Expected the realtime one when it differs
+	Time, Expected string
+
+	// Minutes is how many whole minutes late the train is, negative when it is early
+	Minutes int
+
+	Platform        string
+	PlatformChanged bool
+
+	// Operator is the operator's name, e.g. South Western Railway
+	Operator string
+
+	// Origin and Destination are the names of where the train started and is going
+	Origin, Destination string
+
+	// CallingAt names the public calls after the station, only known when announcing a whole service
+	CallingAt []string
+
+	// Terminates is set when the train finishes at the station
+	Terminates bool
+
+	Cancelled bool
+	Reason    string
+}
+
+// Service describes the train, e.g. "01:18 South Western Railway service to Poole", or from its origin
+// when it terminates at the station
+func (d Data) Service() string {
+	parts := []string{d.Time}
+	if d.Operator != "" {
+		parts = append(parts, d.Operator)
+	}
+	switch {
+	case d.Terminates && d.Origin != "":
+		parts = append(parts, "service from "+d.Origin)
+	case d.Destination != "":
+		parts = append(parts, "service to "+d.Destination)
+	default:
+		parts = append(parts, "service")
+	}
+	return strings.Join(parts, " ")
+}
+
+// list joins names as they'd be read out, e.g. "Salisbury, Yeovil Junction and Exeter St Davids"
+func list(names []string) string {
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// Announcer renders announcements from its templates
+type Announcer struct {
+
+	// Late is how late a train is before it gets a delay announcement, defaults to DefaultLate
+	Late time.Duration
+
+	templates map[Kind]*template.Template
+}
+
+// New creates an announcer using DefaultTemplates, replacing any given in overrides
+func New(overrides map[Kind]string) (*Announcer, error) {
+	a := &Announcer{templates: make(map[Kind]*template.Template)}
+	for _, kind := range Kinds {
+		text, ok := overrides[kind]
+		if !ok {
+			text = DefaultTemplates[kind]
+		}
+		t, err := template.New(string(kind)).Funcs(template.FuncMap{"list": list}).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("announce: parsing %s template: %v", kind, err)
+		}
+		a.templates[kind] = t
+	}
+	for kind := range overrides {
+		if _, ok := a.templates[kind]; !ok {
+			return nil, fmt.Errorf("announce: unknown kind of announcement %q", kind)
+		}
+	}
+	return a, nil
+}
+
+// Render renders a kind of announcement with the given data
+func (a *Announcer) Render(kind Kind, d Data) (string, error) {
+	t, ok := a.templates[kind]
+	if !ok {
+		return "", fmt.Errorf("announce: unknown kind of announcement %q", kind)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, d); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// Kind chooses the announcement to make for a train: a cancellation, a platform change, a delay
+// when it is at least Late behind, then an arrival when it terminates and a departure otherwise
+func (a *Announcer) Kind(d Data) Kind {
+	late := a.Late
+	if late <= 0 {
+		late = DefaultLate
+	}
+	switch {
+	case d.Cancelled:
+		return Cancellation
+	case d.PlatformChanged && d.Platform != "":
+		return PlatformChange
+	case time.Duration(d.Minutes)*time.Minute >= late:
+		return Delay
+	case d.Terminates:
+		return Arrival
+	}
+	return Departure
+}
+
+// Container announces a service on a lineup, choosing the kind of announcement with Kind
+func (a *Announcer) Container(c model.LocationContainer) (string, error) {
+	d := FromContainer(c)
+	return a.Render(a.Kind(d), d)
+}
+
+// Service announces a service at a TIPLOC or CRS code, with the public calls it makes afterwards
+func (a *Announcer) Service(service model.Service, code string) (string, error) {
+	d, err := FromService(service, code)
+	if err != nil {
+		return "", err
+	}
+	return a.Render(a.Kind(d), d)
+}
+
+// names joins the descriptions of origins or destinations, a train can have more than one of each
+func names(pairs []model.Pair) string {
+	var names []string
+	for _, p := range pairs {
+		name := p.Description
+		if name == "" {
+			name = p.TIPLOC
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, " and ")
+}
+
+// FromContainer fills in announcement data for a service on a lineup
+func FromContainer(c model.LocationContainer) Data {
+	d := Data{
+		Station:         c.Description,
+		Platform:        c.Platform,
+		PlatformChanged: c.PlatformChanged,
+		Operator:        c.ATOCName,
+		Cancelled:       c.Cancelled(),
+		Reason:          c.CancelReasonShortText,
+	}
+
+	// RTT gives origins and destinations within the location detail, the container's are a fallback
+	origin, destination := c.LocationDetail.Origin, c.LocationDetail.Destination
+	if len(origin) == 0 {
+		origin = c.Origin
+	}
+	if len(destination) == 0 {
+		destination = c.Destination
+	}
+	d.Origin, d.Destination = names(origin), names(destination)
+
+	// a train terminates where it arrives without being booked to leave again
+	_, err := c.BookedDepartureTime(c.RunDate)
+	d.Terminates = err != nil && c.GBTTBookedArrival != ""
+
+	booked, err := c.BookedTime()
+	if err != nil {
+		return d
+	}
+	d.Time = booked.Format("15:04")
+	if expected, err := c.RealtimeTime(); err == nil && !d.Cancelled {
+		d.Minutes = int(expected.Sub(booked) / time.Minute)
+		if d.Minutes != 0 {
+			d.Expected = expected.Format("15:04")
+		}
+	}
+	return d
+}
+
+// FromService fills in announcement data for a service at a TIPLOC or CRS code, including the public
+// calls it makes afterwards. A service visiting the location more than once is announced at the first visit
+func FromService(service model.Service, code string) (Data, error) {
+	i := service.IndexOf(code)
+	if i == -1 {
+		return Data{}, ErrNotAtLocation
+	}
+
+	d := FromContainer(model.LocationContainer{
+		LocationDetail:  service.Locations[i],
+		ServiceUID:      service.ServiceUID,
+		RunDate:         service.RunDate,
+		TrainIdentity:   service.TrainIdentity,
+		RunningIdentity: service.RunningIdentity,
+		ATOCCode:        service.ATOCCode,
+		ATOCName:        service.ATOCName,
+		ServiceType:     string(service.ServiceType),
+		IsPassenger:     service.IsPassenger,
+		PlannedCancel:   service.PlannedCancel,
+		Origin:          service.Origin,
+		Destination:     service.Destination,
+	})
+
+	for _, location := range service.Locations[i+1:] {
+		if !location.PublicCall() || location.Cancelled() {
+			continue
+		}
+		name := location.Description
+		if name == "" {
+			name = location.CRS
+		}
+		d.CallingAt = append(d.CallingAt, name)
+	}
+	return d, nil
+}
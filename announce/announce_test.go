@@ -0,0 +1,142 @@
+package announce
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+	"github.com/georgeprice/realtime-trains-golang/model/modeltest"
+)
+
+// departure is the 01:18 to Poole from platform 3, change it as needed
+func departure(edit func(c *model.LocationContainer)) model.LocationContainer {
+	c := model.LocationContainer{
+		LocationDetail: model.LocationDetail{
+			Description:         "Southampton Central",
+			GBTTBookedDeparture: "0118",
+			Platform:            "3",
+			Destination:         []model.Pair{{TIPLOC: "POOLE", Description: "Poole"}},
+			Origin:              []model.Pair{{TIPLOC: "WATRLMN", Description: "London Waterloo"}},
+		},
+		RunDate:  "2020-02-12",
+		ATOCName: "South Western Railway",
+	}
+	edit(&c)
+	return c
+}
+
+func TestContainer(t *testing.T) {
+
+	ts := []struct {
+		name      string
+		container model.LocationContainer
+		expected  string
+	}{
+		{"departure", departure(func(*model.LocationContainer) {}),
+			"The next train to depart from platform 3 will be the 01:18 South Western Railway service to Poole."},
+		{"no-platform", departure(func(c *model.LocationContainer) { c.Platform = "" }),
+			"The next train to depart will be the 01:18 South Western Railway service to Poole."},
+		{"arrival", departure(func(c *model.LocationContainer) {
+			c.GBTTBookedDeparture, c.GBTTBookedArrival = "", "0115"
+		}), "The next train to arrive at platform 3 will be the 01:15 South Western Railway service from London Waterloo. " +
+			"This train terminates here."},
+		{"slightly-late", departure(func(c *model.LocationContainer) { c.RealTimeDeparture = "0121" }),
+			"The next train to depart from platform 3 will be the 01:18 South Western Railway service to Poole."},
+		{"delay", departure(func(c *model.LocationContainer) { c.RealTimeDeparture = "0130" }),
+			"We are sorry to announce that the 01:18 South Western Railway service to Poole is delayed by approximately " +
+				"12 minutes, and is now expected at 01:30."},
+		{"platform-change", departure(func(c *model.LocationContainer) { c.PlatformChanged = true }),
+			"Platform alteration. The 01:18 South Western Railway service to Poole will now depart from platform 3."},
+		{"cancellation", departure(func(c *model.LocationContainer) {
+			c.CancelReasonCode, c.CancelReasonShortText = "TG", "a shortage of train crew"
+			c.RealTimeDeparture = "0130"
+		}), "We are sorry to announce that the 01:18 South Western Railway service to Poole has been cancelled. " +
+			"This is due to a shortage of train crew."},
+		{"planned-cancel", departure(func(c *model.LocationContainer) { c.PlannedCancel = true }),
+			"We are sorry to announce that the 01:18 South Western Railway service to Poole has been cancelled."},
+	}
+
+	a, err := New(nil)
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	for _, tc := range ts {
+		if got, err := a.Container(tc.container); err != nil || got != tc.expected {
+			t.Errorf("%s: Got wrong announcement, got %q (%v), expected %q", tc.name, got, err, tc.expected)
+		}
+	}
+}
+
+func TestService(t *testing.T) {
+	service := modeltest.Service("W12345",
+		modeltest.Stop("WAT", "", "2330"),
+		modeltest.Stop("SOU", "0115", "0118"),
+		modeltest.Stop("BMH", "0145", "0147"),
+		modeltest.Call{CRS: "BSM", Arrival: "0155", Departure: "0156", Cancelled: true},
+		modeltest.Stop("PKS", "0201", "0202"),
+		modeltest.Stop("POO", "0207", ""),
+	)
+	service.ATOCName = "South Western Railway"
+	service.Destination = []model.Pair{{TIPLOC: "POOLE", Description: "Poole"}}
+	service.Locations[1].Platform = "3"
+	service.Locations[1].GBTTBookedArrivalNextDay, service.Locations[1].GBTTBookedDepartureNextDay = true, true
+	service.Locations[2].Description = "Bournemouth"
+	service.Locations[4].Description = "Parkstone"
+	service.Locations[5].Description = "Poole"
+
+	a, err := New(nil)
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+
+	expected := "The next train to depart from platform 3 will be the 01:18 South Western Railway service to Poole, " +
+		"calling at Bournemouth, Parkstone and Poole."
+	if got, err := a.Service(service, "SOU"); err != nil || got != expected {
+		t.Errorf("Got wrong announcement, got %q (%v), expected %q", got, err, expected)
+	}
+
+	if _, err := a.Service(service, "MAN"); err != ErrNotAtLocation {
+		t.Errorf("Got wrong error, got %v, expected %v", err, ErrNotAtLocation)
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	a, err := New(map[Kind]string{Departure: "{{.Time}} to {{.Destination}}, platform {{.Platform}}"})
+	if err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+
+	expected := "01:18 to Poole, platform 3"
+	if got, err := a.Container(departure(func(*model.LocationContainer) {})); err != nil || got != expected {
+		t.Errorf("Got wrong announcement, got %q (%v), expected %q", got, err, expected)
+	}
+
+	// the other templates are left alone
+	got, _ := a.Render(Cancellation, Data{Time: "01:18", Destination: "Poole"})
+	if expected := "We are sorry to announce that the 01:18 service to Poole has been cancelled."; got != expected {
+		t.Errorf("Got wrong announcement, got %q, expected %q", got, expected)
+	}
+
+	for _, overrides := range []map[Kind]string{{Delay: "{{.Time"}, {"tannoy": "{{.Time}}"}} {
+		if _, err := New(overrides); err == nil || !strings.HasPrefix(err.Error(), "announce:") {
+			t.Errorf("Got wrong error for %v, got %v", overrides, err)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	ts := []struct {
+		names    []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"Poole"}, "Poole"},
+		{[]string{"Parkstone", "Poole"}, "Parkstone and Poole"},
+		{[]string{"Bournemouth", "Parkstone", "Poole"}, "Bournemouth, Parkstone and Poole"},
+	}
+	for _, tc := range ts {
+		if got := list(tc.names); got != tc.expected {
+			t.Errorf("Got wrong list, got %q, expected %q", got, tc.expected)
+		}
+	}
+}
@@ -1,9 +1,12 @@
 package api
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"path"
@@ -23,6 +26,31 @@ var (
 
 	// ErrAuthenticationFailed is returned when API credentials aren't accepted
 	ErrAuthenticationFailed = errors.New("Origin location is equal destination")
+
+	// ErrRateLimited is returned when the API turns down a request for exceeding its rate limit
+	ErrRateLimited = errors.New("API rate limit exceeded")
+)
+
+// StatusError is returned when the API responds with an unexpected error status
+type StatusError struct {
+	Code int
+	URL  string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("API responded %d %s for %s", e.Code, http.StatusText(e.Code), e.URL)
+}
+
+// StrictMode sets how responses are checked against the model when decoding
+type StrictMode int
+
+// StrictOff decodes responses leniently, the default
+// StrictWarn attaches schema mismatches to the decoded lineup or service as warnings
+// StrictFail also returns the warnings as an error, alongside the decoded response
+const (
+	StrictOff StrictMode = iota
+	StrictWarn
+	StrictFail
 )
 
 // User contains data for a RTT API account, wrapping requests
@@ -32,6 +60,12 @@ type User struct {
 	SearchEndpoint  *url.URL
 	ServiceEndpoint *url.URL
 	Client          *http.Client
+	Strict          StrictMode
+	Limiter         *Limiter
+	Archive         Archive
+
+	// Metrics records requests when set, see NewMetrics
+	Metrics *Metrics
 }
 
 // New creates a new user login for RTT
@@ -54,13 +88,25 @@ func New(username, password string, baseURL *url.URL, client *http.Client) (User
 	}, err
 }
 
-func (c User) get(u *url.URL) (*http.Response, error) {
+func (c User) get(ctx context.Context, kind Kind, u *url.URL) (*http.Response, error) {
+
+	// wait for our turn if requests are rate limited
+	if c.Limiter != nil {
+		waited, err := c.Limiter.wait(ctx)
+		if waited > 0 {
+			c.Metrics.limiterWait(waited)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// setup the basic GET request
 	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 
 	// Add authentication
 	if c.Username != "" && c.Password != "" {
@@ -68,20 +114,70 @@ func (c User) get(u *url.URL) (*http.Response, error) {
 	}
 
 	// send the request to the API
+	start := time.Now()
 	resp, err := c.Client.Do(req)
 	if err != nil {
+		c.Metrics.request(kind, 0, time.Since(start))
 		return resp, err
 	}
+	c.Metrics.request(kind, resp.StatusCode, time.Since(start))
 
 	// check the response status code, return custom error
-	switch resp.StatusCode {
-	case http.StatusUnauthorized:
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		resp.Body.Close()
 		return nil, ErrAuthenticationFailed
+	case resp.StatusCode == http.StatusTooManyRequests:
+		resp.Body.Close()
+		return nil, ErrRateLimited
+	case resp.StatusCode >= http.StatusBadRequest:
+		resp.Body.Close()
+		return nil, &StatusError{Code: resp.StatusCode, URL: u.String()}
 	default:
 		return resp, err
 	}
 }
 
+// fetch gets a resource from the API, decoding it into v and returning the layout of the JSON
+func (c User) fetch(ctx context.Context, kind Kind, u *url.URL, v interface{}) (model.Warnings, model.Layout, error) {
+	resp, err := c.get(ctx, kind, u)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	warnings, err := c.decode(body, v)
+	if _, mismatched := err.(model.Warnings); err != nil && !mismatched {
+		c.Metrics.decodeFailure(kind)
+		return warnings, nil, err
+	}
+
+	// the layout lets an archive keep the response as it was sent, explicit zero values and all
+	layout, layoutErr := model.ReadLayout(body)
+	if layoutErr != nil {
+		return warnings, nil, layoutErr
+	}
+	return warnings, layout, err
+}
+
+// decode unpacks a response body into v, checking it against the model in strict mode
+func (c User) decode(body []byte, v interface{}) (model.Warnings, error) {
+	if c.Strict == StrictOff {
+		return nil, json.Unmarshal(body, v)
+	}
+
+	warnings, err := model.DecodeStrict(bytes.NewReader(body), v)
+	if err == nil && c.Strict == StrictFail && len(warnings) > 0 {
+		err = warnings
+	}
+	return warnings, err
+}
+
 // Departures returns all of the departures from a starting station
 func (c User) Departures(origin string) (lineup model.Lineup, err error) {
 
@@ -92,11 +188,8 @@ func (c User) Departures(origin string) (lineup model.Lineup, err error) {
 	}
 
 	// get response and parse out into service
-	resp, err := c.get(url)
-	if err == nil {
-		err = json.NewDecoder(resp.Body).Decode(&lineup)
-	}
-	return lineup, err
+	lineup.Warnings, lineup.Layout, err = c.fetch(context.Background(), KindDepartures, url, &lineup)
+	return c.archiveLineup(origin, time.Now(), lineup, err)
 }
 
 // creates the url to access a lineup resource from an origin
@@ -117,10 +210,9 @@ func (c User) DeparturesToDestination(origin, destination string) (lineup model.
 	}
 
 	// get response and parse out into service
-	resp, err := c.get(url)
-	if err == nil {
-		err = json.NewDecoder(resp.Body).Decode(&lineup)
-	}
+	lineup.Warnings, lineup.Layout, err = c.fetch(context.Background(), KindDestination, url, &lineup)
+
+	// the lineup is filtered by destination, so isn't archived as the station's departures
 	return lineup, err
 }
 
@@ -153,11 +245,9 @@ func (c User) ServicesForDate(origin string, date time.Time) (lineup model.Lineu
 	}
 
 	// get response and parse out into service
-	resp, err := c.get(url)
-	if err == nil {
-		err = json.NewDecoder(resp.Body).Decode(&lineup)
-	}
-	return lineup, err
+	lineup.Warnings, lineup.Layout, err = c.fetch(context.Background(), KindDate, url, &lineup)
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+	return c.archiveLineup(origin, day, lineup, err)
 }
 
 // creates a url to access the service resource from an origin station, on a given date
@@ -189,11 +279,8 @@ func (c User) ServicesForTime(origin string, date time.Time) (lineup model.Lineu
 	}
 
 	// get response and parse out into service
-	resp, err := c.get(url)
-	if err == nil {
-		err = json.NewDecoder(resp.Body).Decode(&lineup)
-	}
-	return lineup, err
+	lineup.Warnings, lineup.Layout, err = c.fetch(context.Background(), KindTime, url, &lineup)
+	return c.archiveLineup(origin, date, lineup, err)
 }
 
 // creates a url to access the service resource from an origin station, at a given time
@@ -218,6 +305,10 @@ func getServicesTime(endpoint *url.URL, origin string, date time.Time) (*url.URL
 
 // ServiceInfo returns information about a specific service id
 func (c User) ServiceInfo(id string, date time.Time) (service model.Service, err error) {
+	return c.serviceInfo(context.Background(), id, date)
+}
+
+func (c User) serviceInfo(ctx context.Context, id string, date time.Time) (service model.Service, err error) {
 
 	// send the get request for the custom resource endpoint
 	url, err := getServiceInfo(c.ServiceEndpoint, id, date)
@@ -226,11 +317,8 @@ func (c User) ServiceInfo(id string, date time.Time) (service model.Service, err
 	}
 
 	// get response and parse out into service
-	resp, err := c.get(url)
-	if err == nil {
-		err = json.NewDecoder(resp.Body).Decode(&service)
-	}
-	return service, err
+	service.Warnings, service.Layout, err = c.fetch(ctx, KindService, url, &service)
+	return c.archiveService(service, err)
 }
 
 func getServiceInfo(endpoint *url.URL, service string, date time.Time) (*url.URL, error) {
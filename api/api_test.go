@@ -1,16 +1,21 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/georgeprice/realtime-trains-golang/metrics"
 	"github.com/georgeprice/realtime-trains-golang/model"
 )
 
@@ -24,25 +29,33 @@ var (
 		Location: model.LocationDetailHeader{
 			Name: "getDeparturesResponse",
 		},
+		Layout: lineupLayout,
 	}
 	getDeparturesDestinationResponse = model.Lineup{
 		Location: model.LocationDetailHeader{
 			Name: "getDeparturesDestinationResponse",
 		},
+		Layout: lineupLayout,
 	}
 	getServicesDateResponse = model.Lineup{
 		Location: model.LocationDetailHeader{
 			Name: "getServicesDateResponse",
 		},
+		Layout: lineupLayout,
 	}
 	getServicesTimeResponse = model.Lineup{
 		Location: model.LocationDetailHeader{
 			Name: "getServicesTimeResponse",
 		},
+		Layout: lineupLayout,
 	}
 	getServiceInfoResponse = model.Service{
 		ServiceUID: "getServiceInfoResponse",
+		Layout:     model.Layout{"": {"serviceUid"}},
 	}
+
+	// lineupLayout is the layout of the lineups the mock server sends, which the client records
+	lineupLayout = model.Layout{"": {"location"}, "location": {"name"}}
 )
 
 func mockServer() http.HandlerFunc {
@@ -534,3 +547,524 @@ func TestURLs(t *testing.T) {
 
 	})
 }
+
+func TestStrict(t *testing.T) {
+
+	// server responds with a lineup containing a property the model doesn't know about
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(rw, `{"location": {"name": "Manchester", "crs": "MAN"}, "newProperty": 1}`)
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := New(username, password, base, &http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("off", func(t *testing.T) {
+		lineup, err := client.Departures("MAN")
+		switch {
+		case err != nil:
+			t.Fatal(err)
+		case lineup.Warnings != nil:
+			t.Fatalf("Got warnings when not strict, got %+v", lineup.Warnings)
+		}
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		client.Strict = StrictWarn
+		lineup, err := client.Departures("MAN")
+		switch {
+		case err != nil:
+			t.Fatal(err)
+		case len(lineup.Warnings) != 1 || lineup.Warnings[0].Path != "newProperty":
+			t.Fatalf("Got wrong warnings, got %+v", lineup.Warnings)
+		case lineup.Location.Name != "Manchester":
+			t.Fatalf("Got wrong lineup, got %+v", lineup)
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		client.Strict = StrictFail
+		lineup, err := client.Departures("MAN")
+		warnings, ok := err.(model.Warnings)
+		switch {
+		case !ok:
+			t.Fatalf("Got wrong error, got %+v, expected warnings", err)
+		case !reflect.DeepEqual(warnings, lineup.Warnings):
+			t.Fatalf("Got wrong warnings, got %+v, expected %+v", warnings, lineup.Warnings)
+		case lineup.Location.Name != "Manchester":
+			t.Fatalf("Got wrong lineup, got %+v", lineup)
+		}
+	})
+}
+
+func TestExpandLineup(t *testing.T) {
+
+	var (
+		mu       sync.Mutex
+		inFlight int
+		maxIn    int
+		limited  bool
+	)
+
+	// serves services by UID, with one missing and one rate limited on its first request
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxIn {
+			maxIn = inFlight
+		}
+		mu.Unlock()
+
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		uid := strings.Split(req.URL.Path, "/")[2]
+		switch uid {
+		case "MISSING":
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		case "LIMITED":
+			mu.Lock()
+			first := !limited
+			limited = true
+			mu.Unlock()
+			if first {
+				rw.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+		}
+		json.NewEncoder(rw).Encode(model.Service{ServiceUID: uid})
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := New(username, password, base, &http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expandBackoff = time.Millisecond
+	lineup := model.Lineup{}
+	for _, uid := range []string{"A", "B", "MISSING", "C", "LIMITED", "D"} {
+		lineup.Services = append(lineup.Services, model.LocationContainer{ServiceUID: uid, RunDate: "2020-02-12"})
+	}
+
+	t.Run("partial-results", func(t *testing.T) {
+		results, err := client.ExpandLineup(context.Background(), lineup, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(results) != len(lineup.Services) {
+			t.Fatalf("Got wrong number of results, got %d, expected %d", len(results), len(lineup.Services))
+		}
+
+		for i, result := range results {
+			uid := lineup.Services[i].ServiceUID
+			switch {
+			case result.Entry.ServiceUID != uid:
+				t.Errorf("Got result out of order at %d, got %s, expected %s", i, result.Entry.ServiceUID, uid)
+			case uid == "MISSING":
+				if statusErr, ok := result.Err.(*StatusError); !ok || statusErr.Code != http.StatusNotFound {
+					t.Errorf("Got wrong error for missing service, got %v", result.Err)
+				}
+			case result.Err != nil:
+				t.Errorf("Got error for %s, got %v", uid, result.Err)
+			case result.Service.ServiceUID != uid:
+				t.Errorf("Got wrong service for %s, got %s", uid, result.Service.ServiceUID)
+			}
+		}
+
+		if maxIn > 2 {
+			t.Errorf("Got too many requests at once, got %d, expected at most 2", maxIn)
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		results, err := client.ExpandLineup(ctx, lineup, 2)
+		if err != context.Canceled {
+			t.Fatalf("Got wrong error, got %v, expected %v", err, context.Canceled)
+		}
+		for _, result := range results {
+			if result.Err != context.Canceled {
+				t.Errorf("Got wrong error for %s, got %v", result.Entry.ServiceUID, result.Err)
+			}
+		}
+	})
+
+	t.Run("limiter", func(t *testing.T) {
+		limitedClient := client
+		limitedClient.Limiter = NewLimiter(20 * time.Millisecond)
+
+		start := time.Now()
+		results, err := limitedClient.ExpandLineup(context.Background(), lineup, 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Errorf("Got requests faster than the limiter allows, took %v for %d", elapsed, len(results))
+		}
+	})
+}
+
+func TestLimiter(t *testing.T) {
+	start := time.Date(2020, 2, 12, 12, 0, 0, 0, model.London)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+
+	l := NewLimiter(time.Second)
+	for i := 0; i < 4; i++ {
+		if got := l.reserve(start); !got.Equal(at(i)) {
+			t.Fatalf("Got wrong slot, got %v, expected %v", got, at(i))
+		}
+	}
+
+	// slots given back in the middle go to the next callers, the last ones shorten the queue
+	l.release(at(1))
+	l.release(at(2))
+	l.release(at(3))
+	for _, expected := range []time.Time{at(1), at(2), at(3), at(4)} {
+		if got := l.reserve(start); !got.Equal(expected) {
+			t.Errorf("Got wrong slot, got %v, expected %v", got, expected)
+		}
+	}
+
+	// slots given back which have gone are skipped
+	l.release(at(2))
+	if got := l.reserve(at(3)); !got.Equal(at(5)) {
+		t.Errorf("Got wrong slot, got %v, expected %v", got, at(5))
+	}
+
+	t.Run("cancelled", func(t *testing.T) {
+		l := NewLimiter(time.Hour)
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := l.Wait(ctx); err != context.Canceled {
+			t.Fatalf("Got wrong error, got %v, expected %v", err, context.Canceled)
+		}
+		if wait := time.Until(l.reserve(time.Now())); wait > time.Hour {
+			t.Errorf("Got cancelled slot kept, next request waits %v", wait)
+		}
+	})
+}
+
+func TestDeparturesMulti(t *testing.T) {
+
+	departure := func(uid, clock string) model.LocationContainer {
+		return model.LocationContainer{
+			ServiceUID:     uid,
+			RunDate:        "2020-02-12",
+			LocationDetail: model.LocationDetail{GBTTBookedDeparture: clock},
+		}
+	}
+
+	boards := map[string]model.Lineup{
+		"WAT": {Services: []model.LocationContainer{departure("S1", "1000"), departure("S2", "1005")}},
+		"VXH": {Services: []model.LocationContainer{departure("S1", "1004"), departure("S3", "0958")}},
+	}
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		board, ok := boards[strings.Split(req.URL.Path, "/")[2]]
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(rw).Encode(board)
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := New(username, password, base, &http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("merged", func(t *testing.T) {
+		merged, err := client.DeparturesMulti([]string{"WAT", "VXH"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []struct {
+			uid, clock string
+			origins    []string
+		}{
+			{"S3", "0958", []string{"VXH"}},
+			{"S1", "1000", []string{"WAT", "VXH"}},
+			{"S2", "1005", []string{"WAT"}},
+		}
+
+		if len(merged.Services) != len(expected) {
+			t.Fatalf("Got wrong number of services, got %d, expected %d", len(merged.Services), len(expected))
+		}
+		for i, e := range expected {
+			got := merged.Services[i]
+			switch {
+			case got.Entry.ServiceUID != e.uid:
+				t.Errorf("Got wrong service at %d, got %s, expected %s", i, got.Entry.ServiceUID, e.uid)
+			case got.Entry.GBTTBookedDeparture != e.clock:
+				t.Errorf("Got wrong entry for %s, got %s, expected %s", e.uid, got.Entry.GBTTBookedDeparture, e.clock)
+			case !reflect.DeepEqual(got.Origins, e.origins):
+				t.Errorf("Got wrong origins for %s, got %v, expected %v", e.uid, got.Origins, e.origins)
+			}
+		}
+
+		if len(merged.Lineups) != 2 {
+			t.Errorf("Got wrong number of lineups, got %d", len(merged.Lineups))
+		}
+	})
+
+	t.Run("repeated", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		merged, err := client.DeparturesMulti([]string{"WAT", "VXH", "WAT"})
+		switch {
+		case err != nil:
+			t.Fatal(err)
+		case atomic.LoadInt32(&requests) != 2:
+			t.Errorf("Got wrong number of requests, got %d, expected 2", requests)
+		case !reflect.DeepEqual(merged.Services[1].Origins, []string{"WAT", "VXH"}):
+			t.Errorf("Got wrong origins, got %v", merged.Services[1].Origins)
+		}
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		merged, err := client.DeparturesMulti([]string{"WAT", "XXX"})
+		switch {
+		case err == nil:
+			t.Fatal("Got nil error, expected error")
+		case merged.Errors["XXX"] == nil:
+			t.Errorf("Got no error for XXX, got %+v", merged.Errors)
+		case len(merged.Services) != 2:
+			t.Errorf("Got wrong number of services, got %d, expected 2", len(merged.Services))
+		}
+	})
+}
+
+// memoryArchive records what is written through to it
+type memoryArchive struct {
+	mu       sync.Mutex
+	services []model.Service
+	stations []string
+	times    []time.Time
+}
+
+func (a *memoryArchive) PutService(service model.Service) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.services = append(a.services, service)
+	return nil
+}
+
+func (a *memoryArchive) PutLineup(station string, at time.Time, lineup model.Lineup) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.stations = append(a.stations, station)
+	a.times = append(a.times, at)
+	return nil
+}
+
+func TestArchive(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch strings.Split(req.URL.Path, "/")[1] {
+		case "search":
+			fmt.Fprint(rw, `{"location": {"name": "Manchester", "crs": "MAN"}}`)
+		case "service":
+			fmt.Fprint(rw, `{"serviceUid": "S1", "runDate": "2020-02-12"}`)
+		}
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := New(username, password, base, &http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := &memoryArchive{}
+	client.Archive = archive
+
+	date := time.Date(2020, 2, 12, 10, 0, 0, 0, time.UTC)
+	if _, err := client.Departures("MAN"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ServicesForTime("SOU", date); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ServicesForDate("BHM", date); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.DeparturesToDestination("MAN", "EUS"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ServiceInfo("S1", date); err != nil {
+		t.Fatal(err)
+	}
+
+	// lineups are kept for the time they were requested for, and boards filtered by destination are left out
+	midnight := time.Date(2020, 2, 12, 0, 0, 0, 0, time.UTC)
+	switch {
+	case !reflect.DeepEqual(archive.stations, []string{"MAN", "SOU", "BHM"}):
+		t.Errorf("Got wrong lineups archived, got %v", archive.stations)
+	case !archive.times[1].Equal(date) || !archive.times[2].Equal(midnight):
+		t.Errorf("Got wrong lineup times archived, got %v", archive.times)
+	case len(archive.services) != 1 || archive.services[0].ServiceUID != "S1":
+		t.Errorf("Got wrong services archived, got %+v", archive.services)
+	}
+
+	// nothing is archived when the request fails
+	if _, err := client.Departures(""); err == nil {
+		t.Fatal("Got nil error, expected error")
+	}
+	if len(archive.stations) != 3 {
+		t.Errorf("Got failed lineup archived, got %v", archive.stations)
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	for _, key := range []string{"RTT_API", "RTT_USERNAME", "RTT_PASSWORD"} {
+		defer os.Setenv(key, os.Getenv(key))
+	}
+	os.Setenv("RTT_USERNAME", username)
+	os.Setenv("RTT_PASSWORD", password)
+
+	os.Setenv("RTT_API", "")
+	user, err := NewFromEnv()
+	switch {
+	case err != nil:
+		t.Fatal(err)
+	case user.Username != username || user.Password != password:
+		t.Errorf("Got wrong credentials, got %s:%s", user.Username, user.Password)
+	case user.SearchEndpoint.String() != DefaultBaseURL+"/search":
+		t.Errorf("Got wrong search endpoint, got %s", user.SearchEndpoint)
+	}
+
+	os.Setenv("RTT_API", "http://localhost:8080/api")
+	if user, err := NewFromEnv(); err != nil || user.ServiceEndpoint.String() != "http://localhost:8080/api/service" {
+		t.Errorf("Got wrong service endpoint, got %v, %v", user.ServiceEndpoint, err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+
+	var (
+		mu      sync.Mutex
+		limited bool
+	)
+
+	// MAN is served, BAD can't be decoded, anything to a destination is rate limited, and so is LIMITED the first time
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/search/BAD":
+			fmt.Fprint(rw, "{")
+		case strings.Contains(req.URL.Path, "/to/"):
+			rw.WriteHeader(http.StatusTooManyRequests)
+		case strings.HasPrefix(req.URL.Path, "/service/LIMITED"):
+			mu.Lock()
+			first := !limited
+			limited = true
+			mu.Unlock()
+			if first {
+				rw.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			json.NewEncoder(rw).Encode(model.Service{ServiceUID: "LIMITED"})
+		default:
+			json.NewEncoder(rw).Encode(getDeparturesResponse)
+		}
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := New(username, password, base, &http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Metrics = NewMetrics()
+	client.Limiter = NewLimiter(20 * time.Millisecond)
+	expandBackoff = time.Millisecond
+
+	client.Departures("MAN")
+	client.Departures("BAD")
+	client.DeparturesToDestination("MAN", "EUS")
+	client.ExpandLineup(context.Background(), model.Lineup{Services: []model.LocationContainer{
+		{ServiceUID: "LIMITED", RunDate: "2020-02-12"},
+	}}, 1)
+
+	// a request which never gets a response
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closedURL, _ := url.Parse(closed.URL)
+	closed.Close()
+	unreachable, _ := New(username, password, closedURL, &http.Client{})
+	unreachable.Metrics = client.Metrics
+	unreachable.ServicesForDate("MAN", time.Date(2020, 2, 12, 0, 0, 0, 0, model.London))
+
+	registry := metrics.NewRegistry()
+	registry.Register(client.Metrics)
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+
+	for _, expected := range []string{
+		"# TYPE rtt_api_requests_total counter\n",
+		`rtt_api_requests_total{kind="date",status="error"} 1` + "\n",
+		`rtt_api_requests_total{kind="departures",status="200"} 2` + "\n",
+		`rtt_api_requests_total{kind="destination",status="429"} 1` + "\n",
+		`rtt_api_requests_total{kind="service",status="200"} 1` + "\n",
+		`rtt_api_requests_total{kind="service",status="429"} 1` + "\n",
+		"# TYPE rtt_api_request_duration_seconds histogram\n",
+		`rtt_api_request_duration_seconds_bucket{kind="departures",le="+Inf"} 2` + "\n",
+		`rtt_api_request_duration_seconds_count{kind="departures"} 2` + "\n",
+		`rtt_api_decode_failures_total{kind="departures"} 1` + "\n",
+		`rtt_api_retries_total{kind="service"} 1` + "\n",
+		"rtt_api_limiter_waits_total ",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Got metrics without %q, got\n%s", expected, body)
+		}
+	}
+
+	// back to back requests are held up by the limiter
+	if strings.Contains(body, "rtt_api_limiter_waits_total 0\n") {
+		t.Errorf("Got no limiter waits, got\n%s", body)
+	}
+
+	// metrics are optional
+	client.Metrics = nil
+	if _, err := client.Departures("MAN"); err != nil {
+		t.Errorf("Got error without metrics, got %v", err)
+	}
+}
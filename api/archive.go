@@ -0,0 +1,30 @@
+package api
+
+import (
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// Archive keeps what the client fetches, store.FileStore satisfies it
+type Archive interface {
+	PutService(service model.Service) error
+	PutLineup(station string, at time.Time, lineup model.Lineup) error
+}
+
+// archiveLineup writes a fetched lineup through to the archive, if the user has one, keyed by the
+// time the lineup is for. An archive error is returned alongside the lineup, which was still fetched
+func (c User) archiveLineup(station string, at time.Time, lineup model.Lineup, err error) (model.Lineup, error) {
+	if err != nil || c.Archive == nil {
+		return lineup, err
+	}
+	return lineup, c.Archive.PutLineup(station, at, lineup)
+}
+
+// archiveService writes a fetched service through to the archive, if the user has one
+func (c User) archiveService(service model.Service, err error) (model.Service, error) {
+	if err != nil || c.Archive == nil {
+		return service, err
+	}
+	return service, c.Archive.PutService(service)
+}
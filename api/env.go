@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// DefaultBaseURL is where RTT hosts the JSON API
+const DefaultBaseURL = "https://api.rtt.io/api/v1/json"
+
+// NewFromEnv creates a user from the RTT_USERNAME and RTT_PASSWORD environment variables, against the
+// API at RTT_API or DefaultBaseURL when unset. Requests time out after 30 seconds
+func NewFromEnv() (User, error) {
+	base := os.Getenv("RTT_API")
+	if base == "" {
+		base = DefaultBaseURL
+	}
+
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return User{}, err
+	}
+
+	return New(os.Getenv("RTT_USERNAME"), os.Getenv("RTT_PASSWORD"), baseURL, &http.Client{
+		Timeout: 30 * time.Second,
+	})
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+var (
+	// expandRetries is how many times a rate limited service is retried when expanding a lineup
+	expandRetries = 3
+
+	// expandBackoff is how long to wait before the first retry, doubling for each after
+	expandBackoff = time.Second
+)
+
+// Expansion is the full service for a single entry on a lineup, or the error from fetching it
+type Expansion struct {
+	Entry   model.LocationContainer
+	Service model.Service
+	Err     error
+}
+
+// ExpandLineup fetches the full service for every entry on a lineup, running up to concurrency requests at once.
+// Results are in lineup order, with any per-service errors kept on each result; the returned error is only set
+// when the context is done before every service has been fetched
+func (c User) ExpandLineup(ctx context.Context, lineup model.Lineup, concurrency int) ([]Expansion, error) {
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	results := make([]Expansion, len(lineup.Services))
+	indexes := make(chan int)
+
+	// workers fill in results by index, so the order is kept without any more locking
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i].Service, results[i].Err = c.expand(ctx, lineup.Services[i])
+			}
+		}()
+	}
+
+	// hand out work until everything is queued or the context is done
+	for i, container := range lineup.Services {
+		results[i].Entry = container
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	return results, ctx.Err()
+}
+
+// expand fetches the service for a lineup entry, backing off and retrying when rate limited
+func (c User) expand(ctx context.Context, container model.LocationContainer) (model.Service, error) {
+
+	if err := ctx.Err(); err != nil {
+		return model.Service{}, err
+	}
+
+	date, err := time.ParseInLocation("2006-01-02", container.RunDate, model.London)
+	if err != nil {
+		return model.Service{}, err
+	}
+
+	backoff := expandBackoff
+	for attempt := 0; ; attempt++ {
+		service, err := c.serviceInfo(ctx, container.ServiceUID, date)
+		if err != ErrRateLimited || attempt == expandRetries {
+			return service, err
+		}
+		c.Metrics.retry(KindService)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return model.Service{}, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
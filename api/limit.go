@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Limiter spaces out requests to the API so they stay within a rate limit, it is safe for concurrent use
+type Limiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+
+	// free are slots before next given back by cancelled callers, in order, for the next callers to take
+	free []time.Time
+}
+
+// NewLimiter creates a limiter allowing a request every interval, e.g. time.Minute / 30 for 30 requests a minute
+func NewLimiter(interval time.Duration) *Limiter {
+	return &Limiter{interval: interval}
+}
+
+// Wait blocks until the next request is allowed, or the context is done. A caller whose context is done
+// gives its slot back, so it doesn't hold up the callers behind it
+func (l *Limiter) Wait(ctx context.Context) error {
+	_, err := l.wait(ctx)
+	return err
+}
+
+// wait is Wait, also returning how long the request was held back for
+func (l *Limiter) wait(ctx context.Context) (time.Duration, error) {
+	now := time.Now()
+	slot := l.reserve(now)
+
+	wait := slot.Sub(now)
+	if wait <= 0 {
+		return 0, ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return wait, nil
+	case <-ctx.Done():
+		l.release(slot)
+		return time.Since(now), ctx.Err()
+	}
+}
+
+// reserve books the next free slot, so concurrent callers queue up behind each other
+func (l *Limiter) reserve(now time.Time) time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// slots given back which have already gone can't be used without crowding the ones around them
+	for len(l.free) > 0 {
+		slot := l.free[0]
+		l.free = l.free[1:]
+		if !slot.Before(now) {
+			return slot
+		}
+	}
+
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	return slot
+}
+
+// release gives back a slot which won't be used
+func (l *Limiter) release(slot time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// the last slot booked can just be taken off the end, along with any given back before it
+	if l.next.Equal(slot.Add(l.interval)) {
+		l.next = slot
+		for n := len(l.free); n > 0 && l.free[n-1].Add(l.interval).Equal(l.next); n-- {
+			l.next = l.free[n-1]
+			l.free = l.free[:n-1]
+		}
+		return
+	}
+
+	i := sort.Search(len(l.free), func(i int) bool { return l.free[i].After(slot) })
+	l.free = append(l.free, time.Time{})
+	copy(l.free[i+1:], l.free[i:])
+	l.free[i] = slot
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/metrics"
+)
+
+// Kind is the kind of endpoint a request is for, labelling its metrics
+type Kind string
+
+// The kinds of endpoint, one for each of User's methods
+const (
+	KindDepartures  Kind = "departures"
+	KindDestination Kind = "destination"
+	KindDate        Kind = "date"
+	KindTime        Kind = "time"
+	KindService     Kind = "service"
+)
+
+// statusError labels requests which failed before the API responded
+const statusError = "error"
+
+// requestKey labels a request count
+type requestKey struct {
+	kind   Kind
+	status string
+}
+
+// Metrics records what a User does, set it on a User and register it with a metrics.Registry to have
+// it scraped by Prometheus. It is safe for concurrent use, and a nil *Metrics records nothing
+type Metrics struct {
+	mu             sync.Mutex
+	requests       map[requestKey]uint64
+	latency        map[Kind]*metrics.Histogram
+	decodeFailures map[Kind]uint64
+	retries        map[Kind]uint64
+	limiterWaits   uint64
+	limiterWaited  time.Duration
+}
+
+// NewMetrics creates an empty set of metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests:       make(map[requestKey]uint64),
+		latency:        make(map[Kind]*metrics.Histogram),
+		decodeFailures: make(map[Kind]uint64),
+		retries:        make(map[Kind]uint64),
+	}
+}
+
+// request records a request which got a response with a status code, or 0 when it failed before one
+func (m *Metrics) request(kind Kind, status int, took time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	label := statusError
+	if status != 0 {
+		label = strconv.Itoa(status)
+	}
+	m.requests[requestKey{kind, label}]++
+
+	h, ok := m.latency[kind]
+	if !ok {
+		h = metrics.NewHistogram(metrics.DefaultBuckets)
+		m.latency[kind] = h
+	}
+	h.Observe(took.Seconds())
+}
+
+func (m *Metrics) decodeFailure(kind Kind) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.decodeFailures[kind]++
+}
+
+func (m *Metrics) retry(kind Kind) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retries[kind]++
+}
+
+func (m *Metrics) limiterWait(waited time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limiterWaits++
+	m.limiterWaited += waited
+}
+
+// kinds lists the kinds in a count, in order so the metrics are written the same way each time
+func kinds(counts map[Kind]uint64) []Kind {
+	var kinds []Kind
+	for kind := range counts {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+	return kinds
+}
+
+// Collect writes the metrics, implementing metrics.Collector
+func (m *Metrics) Collect(e *metrics.Encoder) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e.Header("rtt_api_requests_total", "Requests made to the RTT API, by endpoint kind and response status.", "counter")
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].kind != keys[j].kind {
+			return keys[i].kind < keys[j].kind
+		}
+		return keys[i].status < keys[j].status
+	})
+	for _, key := range keys {
+		e.Sample("rtt_api_requests_total", metrics.Labels{"kind": string(key.kind), "status": key.status},
+			float64(m.requests[key]))
+	}
+
+	e.Header("rtt_api_request_duration_seconds", "How long requests to the RTT API took to respond, by endpoint kind.", "histogram")
+	latencyKinds := make([]Kind, 0, len(m.latency))
+	for kind := range m.latency {
+		latencyKinds = append(latencyKinds, kind)
+	}
+	sort.Slice(latencyKinds, func(i, j int) bool { return latencyKinds[i] < latencyKinds[j] })
+	for _, kind := range latencyKinds {
+		e.Histogram("rtt_api_request_duration_seconds", metrics.Labels{"kind": string(kind)}, m.latency[kind])
+	}
+
+	for _, counter := range []struct {
+		name, help string
+		counts     map[Kind]uint64
+	}{
+		{"rtt_api_decode_failures_total", "Responses from the RTT API which couldn't be decoded, by endpoint kind.", m.decodeFailures},
+		{"rtt_api_retries_total", "Requests to the RTT API retried after being rate limited, by endpoint kind.", m.retries},
+	} {
+		e.Header(counter.name, counter.help, "counter")
+		for _, kind := range kinds(counter.counts) {
+			e.Sample(counter.name, metrics.Labels{"kind": string(kind)}, float64(counter.counts[kind]))
+		}
+	}
+
+	e.Header("rtt_api_limiter_waits_total", "Requests held back by the rate limiter.", "counter")
+	e.Sample("rtt_api_limiter_waits_total", nil, float64(m.limiterWaits))
+	e.Header("rtt_api_limiter_wait_seconds_total", "Time spent waiting for the rate limiter.", "counter")
+	e.Sample("rtt_api_limiter_wait_seconds_total", nil, m.limiterWaited.Seconds())
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// MultiLineup is a departure board merged from several stations, e.g. a group of London terminals
+type MultiLineup struct {
+
+	// Lineups holds each station's board as it was fetched, keyed by the requested CRS
+	Lineups map[string]model.Lineup
+
+	// Errors holds the error for each station which couldn't be fetched
+	Errors map[string]error
+
+	// Services lists every service departing any of the stations once, in booked time order
+	Services []MultiService
+}
+
+// MultiService is a service on a merged board, along with each of the requested stations it departs from
+type MultiService struct {
+
+	// Entry is the service as it appears at the first of the stations it departs from
+	Entry model.LocationContainer
+
+	// Origins lists the requested stations the service departs from, in the order it calls at them
+	Origins []string
+}
+
+// DeparturesMulti fetches the departures from several stations at once, merging them into a single board.
+// Services calling at more than one of the stations appear once; if any station fails the error for the
+// first is returned along with the board merged from the rest. Stations given more than once are only fetched once
+func (c User) DeparturesMulti(origins []string) (MultiLineup, error) {
+
+	origins = unique(origins)
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		merged = MultiLineup{
+			Lineups: make(map[string]model.Lineup),
+			Errors:  make(map[string]error),
+		}
+	)
+
+	for _, origin := range origins {
+		wg.Add(1)
+		go func(origin string) {
+			defer wg.Done()
+			lineup, err := c.Departures(origin)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				merged.Errors[origin] = err
+				return
+			}
+			merged.Lineups[origin] = lineup
+		}(origin)
+	}
+	wg.Wait()
+
+	merged.Services = mergeLineups(origins, merged.Lineups)
+
+	for _, origin := range origins {
+		if err, ok := merged.Errors[origin]; ok {
+			return merged, fmt.Errorf("departures from %s: %v", origin, err)
+		}
+	}
+	return merged, nil
+}
+
+// unique drops repeated stations, keeping the first of each in order
+func unique(origins []string) []string {
+	seen := make(map[string]bool, len(origins))
+	var kept []string
+	for _, origin := range origins {
+		if !seen[origin] {
+			seen[origin] = true
+			kept = append(kept, origin)
+		}
+	}
+	return kept
+}
+
+// boardEntry is a service at one of the stations on a merged board
+type boardEntry struct {
+	origin    string
+	container model.LocationContainer
+	time      time.Time
+	ok        bool
+}
+
+// before orders entries by booked time, entries without a time come last
+func (e boardEntry) before(other boardEntry) bool {
+	switch {
+	case e.ok && other.ok:
+		return e.time.Before(other.time)
+	default:
+		return e.ok && !other.ok
+	}
+}
+
+// mergeLineups combines the boards of several stations, de-duplicating services by UID and run date
+func mergeLineups(origins []string, lineups map[string]model.Lineup) []MultiService {
+
+	// group each service's entries across the stations, keeping the order services were first seen
+	var (
+		keys    []string
+		grouped = make(map[string][]boardEntry)
+	)
+	for _, origin := range origins {
+		for _, container := range lineups[origin].Services {
+			key := container.ServiceUID + "/" + container.RunDate
+			if _, seen := grouped[key]; !seen {
+				keys = append(keys, key)
+			}
+
+			t, err := container.BookedTime()
+			grouped[key] = append(grouped[key], boardEntry{origin: origin, container: container, time: t, ok: err == nil})
+		}
+	}
+
+	// each service is shown as it departs the first of the stations, then the board is put in time order
+	firsts := make([]boardEntry, len(keys))
+	services := make([]MultiService, len(keys))
+	for i, key := range keys {
+		entries := grouped[key]
+		sort.SliceStable(entries, func(a, b int) bool {
+			return entries[a].before(entries[b])
+		})
+
+		firsts[i] = entries[0]
+		services[i].Entry = entries[0].container
+		for _, e := range entries {
+			services[i].Origins = append(services[i].Origins, e.origin)
+		}
+	}
+
+	sort.Stable(byFirstEntry{firsts, services})
+	return services
+}
+
+// byFirstEntry sorts merged services by the time of their first entry
+type byFirstEntry struct {
+	firsts   []boardEntry
+	services []MultiService
+}
+
+func (s byFirstEntry) Len() int           { return len(s.services) }
+func (s byFirstEntry) Less(i, j int) bool { return s.firsts[i].before(s.firsts[j]) }
+func (s byFirstEntry) Swap(i, j int) {
+	s.firsts[i], s.firsts[j] = s.firsts[j], s.firsts[i]
+	s.services[i], s.services[j] = s.services[j], s.services[i]
+}
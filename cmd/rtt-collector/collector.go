@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/api"
+	"github.com/georgeprice/realtime-trains-golang/model"
+	"github.com/georgeprice/realtime-trains-golang/store"
+)
+
+// backoff limits how long the collector pauses for when the API says it's being rate limited
+const (
+	minBackoff = time.Minute
+	maxBackoff = 15 * time.Minute
+)
+
+// collector polls stations for lineups, then fetches each service once it has finished running
+type collector struct {
+	config  config
+	user    api.User
+	archive store.Store
+	state   state
+
+	// paused is when requests can start again after being rate limited
+	paused  time.Time
+	backoff time.Duration
+}
+
+// run collects until the context is cancelled, saving progress after every round of requests
+func (c *collector) run(ctx context.Context) error {
+	for {
+		c.step(ctx, time.Now())
+		if err := c.state.save(c.config.State); err != nil {
+			return err
+		}
+
+		timer := time.NewTimer(time.Until(c.next()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// step polls every station and fetches every service which is due, stopping early when
+// the context is cancelled or the API starts turning requests down
+func (c *collector) step(ctx context.Context, now time.Time) {
+	if now.Before(c.paused) {
+		return
+	}
+
+	for _, s := range c.config.Stations {
+		if ctx.Err() != nil || now.Before(c.paused) {
+			return
+		}
+		if polled, ok := c.state.Polled[s.CRS]; ok && now.Sub(polled) < time.Duration(s.Interval) {
+			continue
+		}
+		c.poll(s, now)
+	}
+
+	for key, p := range c.state.Pending {
+		if ctx.Err() != nil || now.Before(c.paused) {
+			return
+		}
+		if now.Before(p.Due) {
+			continue
+		}
+		c.check(key, p, now)
+	}
+}
+
+// next returns when there will next be something to do
+func (c *collector) next() time.Time {
+	var next time.Time
+	earliest := func(t time.Time) {
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+
+	for _, s := range c.config.Stations {
+		earliest(c.state.Polled[s.CRS].Add(time.Duration(s.Interval)))
+	}
+	for _, p := range c.state.Pending {
+		earliest(p.Due)
+	}
+
+	if next.Before(c.paused) {
+		next = c.paused
+	}
+	return next
+}
+
+// failed handles an error from the API, pausing for longer each time requests are rate limited
+func (c *collector) failed(what string, err error, now time.Time) {
+	if err != api.ErrRateLimited {
+		log.Printf("%s: %v", what, err)
+		return
+	}
+
+	switch {
+	case c.backoff == 0:
+		c.backoff = minBackoff
+	case c.backoff < maxBackoff:
+		c.backoff *= 2
+		if c.backoff > maxBackoff {
+			c.backoff = maxBackoff
+		}
+	}
+	c.paused = now.Add(c.backoff)
+	log.Printf("%s: rate limited, pausing for %v", what, c.backoff)
+}
+
+// lineup fetches a station's live departures, or the services at the station ahead of now if it looks ahead,
+// along with the time the lineup is for
+func (c *collector) lineup(s station, now time.Time) (model.Lineup, time.Time, error) {
+	if s.Ahead == 0 {
+		lineup, err := c.user.Departures(s.CRS)
+		return lineup, now, err
+	}
+
+	at := now.Add(time.Duration(s.Ahead)).In(model.London)
+	lineup, err := c.user.ServicesForTime(s.CRS, at)
+	return lineup, at, err
+}
+
+// poll fetches the lineup for a station, adding any new services to those waiting to be fetched
+func (c *collector) poll(s station, now time.Time) {
+	crs := s.CRS
+	lineup, at, err := c.lineup(s, now)
+	if err != nil {
+		c.failed("departures from "+crs, err, now)
+
+		// other errors wait for the station's next poll, rather than retrying straight away
+		if err != api.ErrRateLimited {
+			c.state.Polled[crs] = now
+		}
+		return
+	}
+	c.backoff = 0
+	c.state.Polled[crs] = now
+
+	if err := c.archive.PutLineup(crs, at, lineup); err != nil {
+		log.Printf("storing departures from %s: %v", crs, err)
+	}
+
+	added := 0
+	for _, entry := range lineup.Services {
+		key := entry.ServiceUID + "/" + entry.RunDate
+		if _, ok := c.state.Pending[key]; ok {
+			continue
+		}
+		if _, err := c.archive.Service(entry.ServiceUID, entry.RunDate); err == nil {
+			continue
+		}
+
+		c.state.Pending[key] = pending{
+			UID:     entry.ServiceUID,
+			RunDate: entry.RunDate,
+			Seen:    now,
+			Due:     expectedArrival(entry, now.Add(time.Duration(c.config.Recheck))),
+		}
+		added++
+	}
+	log.Printf("departures from %s: %d services, %d new", crs, len(lineup.Services), added)
+}
+
+// check fetches a waiting service, storing it if it has finished or has been waited on too long
+func (c *collector) check(key string, p pending, now time.Time) {
+	date, err := time.ParseInLocation("2006-01-02", p.RunDate, model.London)
+	if err != nil {
+		log.Printf("service %s: %v", key, err)
+		delete(c.state.Pending, key)
+		return
+	}
+
+	service, err := c.user.ServiceInfo(p.UID, date)
+	if err != nil {
+		c.failed("service "+key, err, now)
+		if err != api.ErrRateLimited {
+			c.reschedule(key, p, now)
+		}
+		return
+	}
+	c.backoff = 0
+
+	if !finished(service) && now.Sub(p.Seen) < time.Duration(c.config.GiveUp) {
+		c.reschedule(key, p, now)
+		return
+	}
+
+	if err := c.archive.PutService(service); err != nil {
+		log.Printf("storing service %s: %v", key, err)
+		c.reschedule(key, p, now)
+		return
+	}
+	delete(c.state.Pending, key)
+	log.Printf("service %s: stored", key)
+}
+
+// reschedule tries a service again later, giving up on it once it has been waited on too long
+func (c *collector) reschedule(key string, p pending, now time.Time) {
+	if now.Sub(p.Seen) >= time.Duration(c.config.GiveUp) {
+		log.Printf("service %s: giving up", key)
+		delete(c.state.Pending, key)
+		return
+	}
+	p.Due = now.Add(time.Duration(c.config.Recheck))
+	c.state.Pending[key] = p
+}
+
+// expectedArrival works out when a service on a lineup should reach its destination, or fallback if it can't tell
+func expectedArrival(entry model.LocationContainer, fallback time.Time) time.Time {
+
+	// RTT gives destinations within the location detail, but check the container's too
+	destinations := entry.LocationDetail.Destination
+	if len(destinations) == 0 {
+		destinations = entry.Destination
+	}
+	if len(destinations) == 0 {
+		return fallback
+	}
+
+	destination := destinations[len(destinations)-1]
+	clock := destination.PublicTime
+	if clock == "" {
+		clock = destination.WorkingTime
+	}
+	arrival, err := model.ParseTime(entry.RunDate, clock, false)
+	if err != nil {
+		return fallback
+	}
+
+	// services running past midnight arrive the day after they are booked to call here
+	if booked, err := entry.BookedTime(); err == nil && arrival.Before(booked) {
+		arrival = arrival.AddDate(0, 0, 1)
+	}
+	return arrival
+}
+
+// finished reports whether a service has reached its destination, or won't be running any further
+func finished(service model.Service) bool {
+	if service.PlannedCancel || len(service.Locations) == 0 {
+		return true
+	}
+
+	last := service.Locations[len(service.Locations)-1]
+	return last.Cancelled() || last.RealTimeArrivalActual || last.RealTimeArrivalNoReport
+}
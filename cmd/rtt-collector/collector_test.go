@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/api"
+	"github.com/georgeprice/realtime-trains-golang/model"
+	"github.com/georgeprice/realtime-trains-golang/store"
+)
+
+// memoryStore is a store.Store keeping everything in memory
+type memoryStore struct {
+	mu       sync.Mutex
+	services map[string]model.Service
+	lineups  []store.Snapshot
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{services: make(map[string]model.Service)}
+}
+
+func (s *memoryStore) PutService(service model.Service) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.services[service.ServiceUID+"/"+service.RunDate] = service
+	return nil
+}
+
+func (s *memoryStore) Service(uid, runDate string) (model.Service, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	service, ok := s.services[uid+"/"+runDate]
+	if !ok {
+		return service, store.ErrNotFound
+	}
+	return service, nil
+}
+
+func (s *memoryStore) Services(query store.Query) ([]model.Service, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *memoryStore) PutLineup(station string, at time.Time, lineup model.Lineup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lineups = append(s.lineups, store.Snapshot{Station: station, At: at, Lineup: lineup})
+	return nil
+}
+
+func (s *memoryStore) Lineups(station string, from, to time.Time) ([]store.Snapshot, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+// testConfig is a config with the defaults filled in, polling MAN and BHM
+func testConfig() config {
+	return config{
+		RequestsPerMinute: 30,
+		Recheck:           duration(15 * time.Minute),
+		GiveUp:            duration(12 * time.Hour),
+		Stations: []station{
+			{CRS: "MAN", Interval: duration(5 * time.Minute)},
+			{CRS: "BHM", Interval: duration(10 * time.Minute)},
+		},
+	}
+}
+
+func TestFinished(t *testing.T) {
+
+	arrived := model.LocationDetail{RealTimeArrival: "1000", RealTimeArrivalActual: true}
+	running := model.LocationDetail{RealTimeArrival: "1000"}
+
+	ts := []struct {
+		name     string
+		service  model.Service
+		expected bool
+	}{
+		{"arrived", model.Service{Locations: []model.LocationDetail{running, arrived}}, true},
+		{"running", model.Service{Locations: []model.LocationDetail{arrived, running}}, false},
+		{"no-report", model.Service{Locations: []model.LocationDetail{{RealTimeArrivalNoReport: true}}}, true},
+		{"cancelled-call", model.Service{Locations: []model.LocationDetail{{DisplayAs: "CANCELLED_CALL"}}}, true},
+		{"planned-cancel", model.Service{PlannedCancel: true, Locations: []model.LocationDetail{running}}, true},
+		{"no-locations", model.Service{}, true},
+	}
+
+	for _, tc := range ts {
+		if got := finished(tc.service); got != tc.expected {
+			t.Errorf("%s: Got wrong result, got %t, expected %t", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestExpectedArrival(t *testing.T) {
+
+	fallback := time.Date(2020, 2, 12, 12, 0, 0, 0, model.London)
+	entry := func(departure string, detail, container []model.Pair) model.LocationContainer {
+		return model.LocationContainer{
+			RunDate:        "2020-02-12",
+			LocationDetail: model.LocationDetail{GBTTBookedDeparture: departure, Destination: detail},
+			Destination:    container,
+		}
+	}
+
+	ts := []struct {
+		name     string
+		entry    model.LocationContainer
+		expected time.Time
+	}{
+		{"detail", entry("0800", []model.Pair{{PublicTime: "1000"}}, nil),
+			time.Date(2020, 2, 12, 10, 0, 0, 0, model.London)},
+		{"detail-first", entry("0800", []model.Pair{{PublicTime: "1000"}}, []model.Pair{{PublicTime: "1100"}}),
+			time.Date(2020, 2, 12, 10, 0, 0, 0, model.London)},
+		{"container", entry("0800", nil, []model.Pair{{PublicTime: "1100"}}),
+			time.Date(2020, 2, 12, 11, 0, 0, 0, model.London)},
+		{"last-destination", entry("0800", []model.Pair{{PublicTime: "0930"}, {PublicTime: "1000"}}, nil),
+			time.Date(2020, 2, 12, 10, 0, 0, 0, model.London)},
+		{"working-time", entry("0800", []model.Pair{{WorkingTime: "101530"}}, nil),
+			time.Date(2020, 2, 12, 10, 15, 30, 0, model.London)},
+		{"after-midnight", entry("2330", []model.Pair{{PublicTime: "0015"}}, nil),
+			time.Date(2020, 2, 13, 0, 15, 0, 0, model.London)},
+		{"no-destination", entry("0800", nil, nil), fallback},
+		{"no-time", entry("0800", []model.Pair{{TIPLOC: "MNCRPIC"}}, nil), fallback},
+	}
+
+	for _, tc := range ts {
+		if got := expectedArrival(tc.entry, fallback); !got.Equal(tc.expected) {
+			t.Errorf("%s: Got wrong arrival, got %v, expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestReschedule(t *testing.T) {
+
+	now := time.Date(2020, 2, 12, 12, 0, 0, 0, model.London)
+	ts := []struct {
+		name string
+		seen time.Time
+		kept bool
+	}{
+		{"recent", now.Add(-time.Hour), true},
+		{"nearly-given-up", now.Add(-12*time.Hour + time.Minute), true},
+		{"given-up", now.Add(-12 * time.Hour), false},
+	}
+
+	for _, tc := range ts {
+		c := &collector{config: testConfig(), state: newState()}
+		p := pending{UID: "S1", RunDate: "2020-02-12", Seen: tc.seen, Due: now}
+		c.state.Pending["S1/2020-02-12"] = p
+
+		c.reschedule("S1/2020-02-12", p, now)
+		got, ok := c.state.Pending["S1/2020-02-12"]
+		switch {
+		case ok != tc.kept:
+			t.Errorf("%s: Got wrong pending, got %t, expected %t", tc.name, ok, tc.kept)
+		case ok && !got.Due.Equal(now.Add(15*time.Minute)):
+			t.Errorf("%s: Got wrong due time, got %v", tc.name, got.Due)
+		}
+	}
+}
+
+func TestFailed(t *testing.T) {
+
+	now := time.Date(2020, 2, 12, 12, 0, 0, 0, model.London)
+	c := &collector{config: testConfig(), state: newState()}
+
+	// other errors are logged, without pausing
+	c.failed("departures from MAN", errors.New("connection refused"), now)
+	if c.backoff != 0 || !c.paused.IsZero() {
+		t.Fatalf("Got paused after a failed request, got %v until %v", c.backoff, c.paused)
+	}
+
+	// rate limits pause for longer each time, up to the maximum
+	for i, expected := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 15 * time.Minute, 15 * time.Minute} {
+		c.failed("departures from MAN", api.ErrRateLimited, now)
+		switch {
+		case c.backoff != expected:
+			t.Errorf("%d: Got wrong backoff, got %v, expected %v", i, c.backoff, expected)
+		case !c.paused.Equal(now.Add(expected)):
+			t.Errorf("%d: Got wrong pause, got %v", i, c.paused)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+
+	now := time.Date(2020, 2, 12, 12, 0, 0, 0, model.London)
+	ts := []struct {
+		name     string
+		polled   map[string]time.Time
+		due      []time.Time
+		paused   time.Time
+		expected time.Time
+	}{
+		{"station", map[string]time.Time{"MAN": now, "BHM": now}, nil, time.Time{}, now.Add(5 * time.Minute)},
+		{"slower-station", map[string]time.Time{"MAN": now, "BHM": now.Add(-8 * time.Minute)}, nil, time.Time{}, now.Add(2 * time.Minute)},
+		{"pending", map[string]time.Time{"MAN": now, "BHM": now}, []time.Time{now.Add(3 * time.Minute), now.Add(time.Minute)}, time.Time{}, now.Add(time.Minute)},
+		{"paused", map[string]time.Time{"MAN": now, "BHM": now}, []time.Time{now.Add(time.Minute)}, now.Add(10 * time.Minute), now.Add(10 * time.Minute)},
+		{"never-polled", map[string]time.Time{"MAN": now}, nil, time.Time{}, time.Time{}.Add(10 * time.Minute)},
+	}
+
+	for _, tc := range ts {
+		c := &collector{config: testConfig(), state: newState(), paused: tc.paused}
+		c.state.Polled = tc.polled
+		for i, due := range tc.due {
+			c.state.Pending[fmt.Sprint(i)] = pending{Due: due}
+		}
+		if got := c.next(); !got.Equal(tc.expected) {
+			t.Errorf("%s: Got wrong next time, got %v, expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestStep(t *testing.T) {
+
+	// MAN lists a service already archived and one which has arrived, BHM is rate limited the first time
+	var (
+		mu       sync.Mutex
+		requests []string
+		limited  bool
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		requests = append(requests, req.URL.Path)
+		mu.Unlock()
+
+		switch {
+		case req.URL.Path == "/search/MAN":
+			fmt.Fprint(rw, `{"location": {"crs": "MAN"}, "services": [
+				{"serviceUid": "S1", "runDate": "2020-02-12", "locationDetail": {"gbttBookedDeparture": "0800"}},
+				{"serviceUid": "S2", "runDate": "2020-02-12", "locationDetail": {"gbttBookedDeparture": "0900",
+					"destination": [{"publicTime": "1000"}]}}]}`)
+		case req.URL.Path == "/search/BHM" && !limited:
+			limited = true
+			rw.WriteHeader(http.StatusTooManyRequests)
+		case req.URL.Path == "/search/BHM":
+			fmt.Fprint(rw, `{"location": {"crs": "BHM"}}`)
+		case strings.HasPrefix(req.URL.Path, "/service/S2/"):
+			fmt.Fprint(rw, `{"serviceUid": "S2", "runDate": "2020-02-12", "locations": [
+				{"crs": "MAN", "realtimeDeparture": "0900", "realtimeDepartureActual": true},
+				{"crs": "EUS", "realtimeArrival": "1002", "realtimeArrivalActual": true}]}`)
+		default:
+			http.NotFound(rw, req)
+		}
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := api.New("", "", base, &http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive := newMemoryStore()
+	if err := archive.PutService(model.Service{ServiceUID: "S1", RunDate: "2020-02-12"}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2020, 2, 12, 11, 0, 0, 0, model.London)
+	c := &collector{config: testConfig(), user: user, archive: archive, state: newState()}
+	c.step(context.Background(), now)
+
+	switch {
+	case len(archive.lineups) != 1 || archive.lineups[0].Station != "MAN" || !archive.lineups[0].At.Equal(now):
+		t.Errorf("Got wrong lineups archived, got %+v", archive.lineups)
+	case !c.state.Polled["MAN"].Equal(now):
+		t.Errorf("Got wrong poll time for MAN, got %v", c.state.Polled["MAN"])
+	case !c.paused.Equal(now.Add(minBackoff)):
+		t.Errorf("Got wrong pause after being rate limited, got %v", c.paused)
+	}
+
+	// being rate limited stops the step before S2 is fetched
+	if _, ok := c.state.Pending["S2/2020-02-12"]; !ok || len(c.state.Pending) != 1 {
+		t.Errorf("Got wrong services pending, got %+v", c.state.Pending)
+	}
+
+	// nothing is requested while paused
+	mu.Lock()
+	before := len(requests)
+	mu.Unlock()
+	c.step(context.Background(), now.Add(30*time.Second))
+	if len(requests) != before {
+		t.Errorf("Got requests while paused, got %v", requests[before:])
+	}
+
+	// after the pause BHM is polled, then S2 has arrived so is stored
+	c.step(context.Background(), now.Add(minBackoff))
+	switch {
+	case c.backoff != 0:
+		t.Errorf("Got backoff kept after a request succeeded, got %v", c.backoff)
+	case len(archive.lineups) != 2 || archive.lineups[1].Station != "BHM":
+		t.Errorf("Got wrong lineups archived, got %+v", archive.lineups)
+	case len(c.state.Pending) != 0:
+		t.Errorf("Got services still pending, got %+v", c.state.Pending)
+	}
+	if _, err := archive.Service("S2", "2020-02-12"); err != nil {
+		t.Errorf("Got S2 missing from the archive, got %v", err)
+	}
+}
+
+func TestPollFailure(t *testing.T) {
+
+	// the API is down, which shouldn't have the collector polling again straight away
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		rw.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := api.New("", "", base, &http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2020, 2, 12, 11, 0, 0, 0, model.London)
+	c := &collector{config: testConfig(), user: user, archive: newMemoryStore(), state: newState()}
+	c.step(context.Background(), now)
+	c.step(context.Background(), now.Add(time.Second))
+
+	switch {
+	case atomic.LoadInt32(&requests) != 2:
+		t.Errorf("Got wrong number of requests, got %d, expected one for each station", requests)
+	case !c.paused.IsZero():
+		t.Errorf("Got paused after a failed request, got %v", c.paused)
+	case !c.next().Equal(now.Add(5 * time.Minute)):
+		t.Errorf("Got wrong next time, got %v, expected %v", c.next(), now.Add(5*time.Minute))
+	}
+}
+
+func TestPollAhead(t *testing.T) {
+
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		paths = append(paths, req.URL.Path)
+		fmt.Fprint(rw, `{"location": {"crs": "BHM"}, "services": [
+			{"serviceUid": "S1", "runDate": "2020-02-12", "locationDetail": {"gbttBookedDeparture": "1305"}}]}`)
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := api.New("", "", base, &http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2020, 2, 12, 11, 0, 0, 0, model.London)
+	archive := newMemoryStore()
+	c := &collector{config: testConfig(), user: user, archive: archive, state: newState()}
+	c.poll(station{CRS: "BHM", Interval: duration(10 * time.Minute), Ahead: duration(2 * time.Hour)}, now)
+
+	switch {
+	case len(paths) != 1 || paths[0] != "/search/BHM/2020/02/12/1300":
+		t.Errorf("Got wrong requests, got %v", paths)
+	case len(archive.lineups) != 1 || !archive.lineups[0].At.Equal(now.Add(2*time.Hour)):
+		t.Errorf("Got wrong lineups archived, got %+v", archive.lineups)
+	case !c.state.Polled["BHM"].Equal(now):
+		t.Errorf("Got wrong poll time, got %v", c.state.Polled["BHM"])
+	case len(c.state.Pending) != 1:
+		t.Errorf("Got wrong services pending, got %+v", c.state.Pending)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// duration is a time.Duration read from a string like "5m" in the config file
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	*d = duration(parsed)
+	return err
+}
+
+// station is a station to poll, and how often
+type station struct {
+	CRS      string   `json:"crs"`
+	Interval duration `json:"interval"`
+
+	// Ahead polls the services at the station this far ahead with ServicesForTime, rather than its live
+	// departures, so services are seen well before they run
+	Ahead duration `json:"ahead,omitempty"`
+}
+
+// config is read from the JSON file given to the collector
+type config struct {
+
+	// Archive is the directory services and lineups are stored in
+	Archive string `json:"archive"`
+
+	// State is the file progress is kept in, so the collector can pick up where it left off
+	State string `json:"state"`
+
+	// RequestsPerMinute limits calls to the API, defaults to 30
+	RequestsPerMinute int `json:"requestsPerMinute"`
+
+	// Recheck is how long to wait before fetching a service again when it hasn't finished, defaults to 15m
+	Recheck duration `json:"recheck"`
+
+	// GiveUp is how long after a service is first seen to store it as it is, finished or not, defaults to 12h
+	GiveUp duration `json:"giveUp"`
+
+	Stations []station `json:"stations"`
+}
+
+// loadConfig reads a config file, filling in defaults
+func loadConfig(path string) (config, error) {
+	var c config
+
+	f, err := os.Open(path)
+	if err != nil {
+		return c, err
+	}
+	defer f.Close()
+
+	if err := json.NewDecoder(f).Decode(&c); err != nil {
+		return c, fmt.Errorf("reading %s: %v", path, err)
+	}
+
+	switch {
+	case c.Archive == "":
+		return c, errors.New("no archive directory given")
+	case len(c.Stations) == 0:
+		return c, errors.New("no stations given")
+	}
+	for i, s := range c.Stations {
+		switch {
+		case s.CRS == "":
+			return c, fmt.Errorf("station %d has no CRS code", i)
+		case s.Ahead < 0:
+			return c, fmt.Errorf("station %s looks behind rather than ahead", s.CRS)
+		case s.Interval <= 0:
+			c.Stations[i].Interval = duration(5 * time.Minute)
+		}
+	}
+
+	if c.State == "" {
+		c.State = filepath.Join(c.Archive, "collector.json")
+	}
+	if c.RequestsPerMinute <= 0 {
+		c.RequestsPerMinute = 30
+	}
+	if c.Recheck <= 0 {
+		c.Recheck = duration(15 * time.Minute)
+	}
+	if c.GiveUp <= 0 {
+		c.GiveUp = duration(12 * time.Hour)
+	}
+	return c, nil
+}
@@ -0,0 +1,76 @@
+// Command rtt-collector is a daemon building up an archive of RTT data. It polls the departures from
+// each station in its config file, or the services some way ahead for stations with "ahead" set, then
+// fetches every service it sees once it has finished running.
+// Progress is saved to a state file, so it picks up where it left off after being stopped.
+//
+//	rtt-collector -config collector.json
+//
+// with a config file like
+//
+//	{
+//		"archive": "/var/lib/rtt",
+//		"requestsPerMinute": 30,
+//		"recheck": "15m",
+//		"giveUp": "12h",
+//		"stations": [{"crs": "MAN", "interval": "5m"}, {"crs": "BHM", "interval": "10m", "ahead": "2h"}]
+//	}
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/api"
+	"github.com/georgeprice/realtime-trains-golang/store"
+)
+
+func main() {
+	log.SetFlags(log.LstdFlags)
+	log.SetPrefix("rtt-collector: ")
+
+	path := flag.String("config", "collector.json", "config file listing the stations to poll")
+	flag.Parse()
+
+	c, err := loadConfig(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	archive, err := store.Open(c.Archive)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer archive.Close()
+
+	progress, err := loadState(c.State)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	user, err := api.NewFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	user.Limiter = api.NewLimiter(time.Minute / time.Duration(c.RequestsPerMinute))
+
+	// stop between requests on an interrupt, saving progress on the way out
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-signals
+		log.Printf("received %v, shutting down", s)
+		cancel()
+	}()
+
+	log.Printf("collecting from %d stations, %d services pending", len(c.Stations), len(progress.Pending))
+	collect := &collector{config: c, user: user, archive: archive, state: progress}
+	if err := collect.run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
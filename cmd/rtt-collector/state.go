@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/store"
+)
+
+// pending is a service seen on a lineup, waiting to be fetched once it has finished running
+type pending struct {
+	UID     string    `json:"uid"`
+	RunDate string    `json:"runDate"`
+	Seen    time.Time `json:"seen"`
+	Due     time.Time `json:"due"`
+}
+
+// state is what the collector has left to do, saved so it can resume after a restart
+type state struct {
+	Pending map[string]pending `json:"pending"`
+
+	// Polled is when each station was last polled
+	Polled map[string]time.Time `json:"polled"`
+}
+
+func newState() state {
+	return state{Pending: make(map[string]pending), Polled: make(map[string]time.Time)}
+}
+
+// loadState reads the state file, starting afresh if there isn't one yet
+func loadState(path string) (state, error) {
+	s := newState()
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return s, err
+	}
+
+	if s.Pending == nil {
+		s.Pending = make(map[string]pending)
+	}
+	if s.Polled == nil {
+		s.Polled = make(map[string]time.Time)
+	}
+	return s, nil
+}
+
+// save writes the state file, through a temporary file so a crash never leaves half of it
+func (s state) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	return store.WriteFile(path, data, 0644)
+}
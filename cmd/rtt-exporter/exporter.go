@@ -0,0 +1,203 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/metrics"
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// staleAfter is how many polls in a row a board can fail before its summary is dropped, rather than
+// exported as if it were still current
+const staleAfter = 3
+
+// source is where boards come from, an api.User outside of tests
+type source interface {
+	Departures(origin string) (model.Lineup, error)
+}
+
+// operatorStats sums up one operator's services on a board
+type operatorStats struct {
+	services, late, cancelled int
+
+	// delay is the total delay of the services running with realtime data, of which there are timed
+	delay time.Duration
+	timed int
+}
+
+// summarise works out each operator's stats on a board, keyed by ATOC code. Delays are measured from the
+// realtime times RTT has against the booked ones, with early running counted as on time, and services
+// at least lateAfter behind are late. Cancelled services, and those without realtime data, have no delay
+func summarise(lineup model.Lineup, lateAfter time.Duration) map[string]*operatorStats {
+	operators := make(map[string]*operatorStats)
+	for _, c := range lineup.Services {
+		stats, ok := operators[c.ATOCCode]
+		if !ok {
+			stats = &operatorStats{}
+			operators[c.ATOCCode] = stats
+		}
+		stats.services++
+
+		if c.Cancelled() {
+			stats.cancelled++
+			continue
+		}
+		if !c.RealTimeActivated || (c.RealTimeDeparture == "" && c.RealTimeArrival == "" && c.RealTimePass == "") {
+			continue
+		}
+
+		booked, err := c.BookedTime()
+		if err != nil {
+			continue
+		}
+		realtime, err := c.RealtimeTime()
+		if err != nil {
+			continue
+		}
+
+		delay := realtime.Sub(booked)
+		if delay < 0 {
+			delay = 0
+		}
+		stats.delay += delay
+		stats.timed++
+		if delay >= lateAfter {
+			stats.late++
+		}
+	}
+	return operators
+}
+
+// station is the last board seen at a station
+type station struct {
+	operators map[string]*operatorStats
+	updated   time.Time
+	failures  uint64
+
+	// failing is how many polls in a row have failed
+	failing int
+}
+
+// exporter polls stations' boards, keeping a summary of each for Prometheus. It is safe for concurrent use
+type exporter struct {
+	source    source
+	stations  []string
+	lateAfter time.Duration
+	now       func() time.Time
+
+	mu     sync.Mutex
+	boards map[string]*station
+}
+
+// newExporter creates an exporter of stations' boards, each station given more than once is only polled
+// and exported once
+func newExporter(source source, stations []string, lateAfter time.Duration) *exporter {
+	var unique []string
+	boards := make(map[string]*station)
+	for _, crs := range stations {
+		if _, ok := boards[crs]; !ok {
+			unique = append(unique, crs)
+			boards[crs] = &station{}
+		}
+	}
+	return &exporter{source: source, stations: unique, lateAfter: lateAfter, now: time.Now, boards: boards}
+}
+
+// poll fetches every station's board once. A board which can't be fetched keeps its last summary until
+// staleAfter polls in a row have failed, then it is dropped until the board can be fetched again
+func (e *exporter) poll() {
+	for _, crs := range e.stations {
+		lineup, err := e.source.Departures(crs)
+
+		e.mu.Lock()
+		board := e.boards[crs]
+		if err != nil {
+			board.failures++
+			board.failing++
+			if board.failing >= staleAfter {
+				board.operators = nil
+			}
+		} else {
+			board.operators, board.updated = summarise(lineup, e.lateAfter), e.now()
+			board.failing = 0
+		}
+		e.mu.Unlock()
+	}
+}
+
+// run polls every interval until done is closed
+func (e *exporter) run(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		e.poll()
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+	}
+}
+
+// gauge is a per operator metric
+type gauge struct {
+	name, help string
+	value      func(s *operatorStats) (float64, bool)
+}
+
+var gauges = []gauge{
+	{"rtt_board_services", "Services on a station's departure board, by operator.",
+		func(s *operatorStats) (float64, bool) { return float64(s.services), true }},
+	{"rtt_board_late_services", "Services running late on a station's departure board, by operator.",
+		func(s *operatorStats) (float64, bool) { return float64(s.late), true }},
+	{"rtt_board_cancelled_services", "Cancelled services on a station's departure board, by operator.",
+		func(s *operatorStats) (float64, bool) { return float64(s.cancelled), true }},
+	{"rtt_board_average_delay_seconds", "Average delay of services with realtime data on a station's departure board, by operator.",
+		func(s *operatorStats) (float64, bool) {
+			if s.timed == 0 {
+				return 0, false
+			}
+			return (s.delay / time.Duration(s.timed)).Seconds(), true
+		}},
+}
+
+// Collect writes the summary of every board, implementing metrics.Collector
+func (e *exporter) Collect(enc *metrics.Encoder) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	stations := append([]string(nil), e.stations...)
+	sort.Strings(stations)
+
+	for _, g := range gauges {
+		enc.Header(g.name, g.help, "gauge")
+		for _, crs := range stations {
+			board := e.boards[crs]
+			operators := make([]string, 0, len(board.operators))
+			for atoc := range board.operators {
+				operators = append(operators, atoc)
+			}
+			sort.Strings(operators)
+
+			for _, atoc := range operators {
+				if value, ok := g.value(board.operators[atoc]); ok {
+					enc.Sample(g.name, metrics.Labels{"crs": crs, "atoc": atoc}, value)
+				}
+			}
+		}
+	}
+
+	enc.Header("rtt_board_last_update_timestamp_seconds", "When a station's departure board was last fetched.", "gauge")
+	for _, crs := range stations {
+		if updated := e.boards[crs].updated; !updated.IsZero() {
+			enc.Sample("rtt_board_last_update_timestamp_seconds", metrics.Labels{"crs": crs}, float64(updated.Unix()))
+		}
+	}
+
+	enc.Header("rtt_board_poll_failures_total", "Times a station's departure board couldn't be fetched.", "counter")
+	for _, crs := range stations {
+		enc.Sample("rtt_board_poll_failures_total", metrics.Labels{"crs": crs}, float64(e.boards[crs].failures))
+	}
+}
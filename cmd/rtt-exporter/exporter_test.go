@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/metrics"
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// departure builds a service on a board, booked at booked and expected at realtime, which is left
+// out when empty
+func departure(atoc, booked, realtime string) model.LocationContainer {
+	return model.LocationContainer{
+		LocationDetail: model.LocationDetail{
+			RealTimeActivated:   realtime != "",
+			GBTTBookedDeparture: booked,
+			RealTimeDeparture:   realtime,
+		},
+		RunDate:  "2020-02-12",
+		ATOCCode: atoc,
+	}
+}
+
+func TestSummarise(t *testing.T) {
+	cancelled := departure("NT", "1215", "")
+	cancelled.CancelReasonCode = "TG"
+	midnight := departure("VT", "2359", "0006")
+	midnight.RealTimeDepartureNextDay = true
+
+	lineup := model.Lineup{Services: []model.LocationContainer{
+		departure("NT", "1200", "1203"),
+		departure("NT", "1205", "1217"),
+		departure("NT", "1210", ""),
+		cancelled,
+		departure("VT", "1200", "1158"),
+		midnight,
+	}}
+
+	expected := map[string]*operatorStats{
+		"NT": {services: 4, late: 1, cancelled: 1, delay: 15 * time.Minute, timed: 2},
+		"VT": {services: 2, late: 1, delay: 7 * time.Minute, timed: 2},
+	}
+	if got := summarise(lineup, 5*time.Minute); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got wrong stats, got %+v, expected %+v", got, expected)
+	}
+}
+
+// fakeSource serves fixed boards, or err for stations without one
+type fakeSource map[string]model.Lineup
+
+func (s fakeSource) Departures(origin string) (model.Lineup, error) {
+	lineup, ok := s[origin]
+	if !ok {
+		return lineup, errors.New("unavailable")
+	}
+	return lineup, nil
+}
+
+func TestCollect(t *testing.T) {
+	source := fakeSource{
+		"MAN": {Services: []model.LocationContainer{departure("NT", "1200", "1206"), departure("NT", "1205", "1205")}},
+		"BHM": {Services: []model.LocationContainer{departure("XC", "1200", "")}},
+	}
+	e := newExporter(source, []string{"MAN", "BHM", "EUS", "MAN"}, 5*time.Minute)
+	e.now = func() time.Time { return time.Unix(1581508800, 0) }
+	e.poll()
+
+	// BHM's board is gone, so its last summary is kept
+	delete(source, "BHM")
+	e.poll()
+
+	enc := &metrics.Encoder{}
+	e.Collect(enc)
+	got := string(enc.Bytes())
+
+	// a station given twice is only exported once
+	if n := strings.Count(got, `rtt_board_services{atoc="NT",crs="MAN"}`); n != 1 {
+		t.Errorf("Got wrong number of MAN samples, got %d, expected 1", n)
+	}
+
+	for _, line := range []string{
+		`rtt_board_services{atoc="XC",crs="BHM"} 1`,
+		`rtt_board_services{atoc="NT",crs="MAN"} 2`,
+		`rtt_board_late_services{atoc="NT",crs="MAN"} 1`,
+		`rtt_board_cancelled_services{atoc="NT",crs="MAN"} 0`,
+		`rtt_board_average_delay_seconds{atoc="NT",crs="MAN"} 180`,
+		`rtt_board_last_update_timestamp_seconds{crs="MAN"} 1.5815088e+09`,
+		`rtt_board_poll_failures_total{crs="BHM"} 1`,
+		`rtt_board_poll_failures_total{crs="EUS"} 2`,
+	} {
+		if !strings.Contains(got, line+"\n") {
+			t.Errorf("Got wrong metrics, expected %q in\n%s", line, got)
+		}
+	}
+
+	// without realtime data there's no delay to average, and a board never fetched has no update time
+	for _, line := range []string{`rtt_board_average_delay_seconds{atoc="XC"`, `rtt_board_last_update_timestamp_seconds{crs="EUS"}`} {
+		if strings.Contains(got, line) {
+			t.Errorf("Got wrong metrics, didn't expect %q in\n%s", line, got)
+		}
+	}
+}
+
+func TestCollectStale(t *testing.T) {
+	source := fakeSource{"BHM": {Services: []model.LocationContainer{departure("XC", "1200", "")}}}
+	e := newExporter(source, []string{"BHM"}, 5*time.Minute)
+	e.now = func() time.Time { return time.Unix(1581508800, 0) }
+	e.poll()
+
+	collect := func() string {
+		enc := &metrics.Encoder{}
+		e.Collect(enc)
+		return string(enc.Bytes())
+	}
+
+	// the last summary is kept through a few failures, then dropped
+	delete(source, "BHM")
+	for i := 1; i < staleAfter; i++ {
+		e.poll()
+	}
+	if got := collect(); !strings.Contains(got, `rtt_board_services{atoc="XC",crs="BHM"} 1`) {
+		t.Errorf("Got summary dropped after %d failures, got\n%s", staleAfter-1, got)
+	}
+	e.poll()
+	got := collect()
+	if strings.Contains(got, `rtt_board_services{atoc="XC",crs="BHM"}`) {
+		t.Errorf("Got stale summary after %d failures, got\n%s", staleAfter, got)
+	}
+	if !strings.Contains(got, `rtt_board_last_update_timestamp_seconds{crs="BHM"} 1.5815088e+09`) {
+		t.Errorf("Got wrong metrics, expected the last update time in\n%s", got)
+	}
+
+	// and comes back with the board
+	source["BHM"] = model.Lineup{Services: []model.LocationContainer{departure("XC", "1200", "")}}
+	e.poll()
+	if got := collect(); !strings.Contains(got, `rtt_board_services{atoc="XC",crs="BHM"} 1`) {
+		t.Errorf("Got no summary once the board is back, got\n%s", got)
+	}
+}
@@ -0,0 +1,63 @@
+// Command rtt-exporter is a Prometheus exporter of how trains are running. It polls the departure boards
+// of some stations, exposing how many services each operator has on them, how many are late or cancelled
+// and their average delay, along with the API client's own metrics
+//
+//	rtt-exporter -addr :9101 -interval 1m -late 5m MAN BHM EUS
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/api"
+	"github.com/georgeprice/realtime-trains-golang/metrics"
+)
+
+func main() {
+	log.SetFlags(log.LstdFlags)
+	log.SetPrefix("rtt-exporter: ")
+
+	addr := flag.String("addr", ":9101", "address to serve /metrics on")
+	interval := flag.Duration("interval", time.Minute, "how often to poll each station")
+	late := flag.Duration("late", 5*time.Minute, "how far behind a service is before it counts as late")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: rtt-exporter [-addr address] [-interval duration] [-late duration] CRS...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *interval <= 0 || *late <= 0 {
+		log.Fatal("interval and late must be positive")
+	}
+
+	var stations []string
+	for _, crs := range flag.Args() {
+		stations = append(stations, strings.ToUpper(crs))
+	}
+
+	user, err := api.NewFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	user.Metrics = api.NewMetrics()
+
+	e := newExporter(user, stations, *late)
+	registry := metrics.NewRegistry()
+	registry.Register(e)
+	registry.Register(user.Metrics)
+	http.Handle("/metrics", registry)
+
+	go e.run(*interval, nil)
+
+	log.Printf("polling %d stations every %v, serving metrics on %s", len(stations), *interval, *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -0,0 +1,40 @@
+// Command rtt-web serves live departure boards for screens around an office. Open /board/CRS in a
+// browser for a station's board, which updates itself as the trains change, however many screens show it.
+// Apps can subscribe to boards and services over a websocket at /stream
+//
+//	rtt-web -addr :8080 -interval 30s
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/api"
+	"github.com/georgeprice/realtime-trains-golang/web"
+)
+
+func main() {
+	log.SetFlags(log.LstdFlags)
+	log.SetPrefix("rtt-web: ")
+
+	addr := flag.String("addr", ":8080", "address to serve boards on")
+	interval := flag.Duration("interval", 30*time.Second, "how often to refresh each station being watched")
+	flag.Parse()
+
+	if *interval <= 0 {
+		log.Fatal("interval must be positive")
+	}
+
+	user, err := api.NewFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server := web.NewServer(user, *interval)
+	defer server.Close()
+
+	log.Printf("serving boards on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, server))
+}
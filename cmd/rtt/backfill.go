@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/api"
+	"github.com/georgeprice/realtime-trains-golang/model"
+	"github.com/georgeprice/realtime-trains-golang/store"
+)
+
+// backfill populates an archive with every service from some stations over a range of past dates
+func backfill(args []string) error {
+
+	flags := newFlagSet("backfill")
+	dir := flags.String("archive", "", "archive directory to fill")
+	from := flags.String("from", "", "first date to fetch, as 2006-01-02")
+	to := flags.String("to", "", "last date to fetch, defaults to -from")
+	concurrency := flags.Int("concurrency", 4, "dates to fetch at once")
+	rate := flags.Int("rate", 30, "most requests a minute")
+	progress := flags.String("checkpoint", "", "file progress is kept in, defaults to backfill.json in the archive")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	switch {
+	case *dir == "":
+		return errors.New("no archive directory given")
+	case *from == "":
+		return errors.New("no start date given")
+	case flags.NArg() == 0:
+		return errors.New("no stations given")
+	case *rate < 1:
+		return errors.New("rate must be at least one request a minute")
+	}
+	if *to == "" {
+		to = from
+	}
+	if *progress == "" {
+		*progress = filepath.Join(*dir, "backfill.json")
+	}
+
+	dates, err := dateRange(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	archive, err := store.Open(*dir)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	user, err := api.NewFromEnv()
+	if err != nil {
+		return err
+	}
+	user.Limiter = api.NewLimiter(time.Minute / time.Duration(*rate))
+
+	done, err := loadCheckpoint(*progress)
+	if err != nil {
+		return err
+	}
+
+	tasks := pendingTasks(dates, flags.Args(), done)
+	fmt.Fprintf(os.Stderr, "backfilling %d of %d station dates\n", len(tasks), len(dates)*flags.NArg())
+
+	// stop handing out tasks on an interrupt, the checkpoint keeps what has been finished
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case <-signals:
+			fmt.Fprintln(os.Stderr, "interrupted, finishing up")
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	run := &backfillRun{user: user, archive: archive, checkpoint: *progress, done: done, total: len(tasks)}
+	return run.all(ctx, tasks, *concurrency)
+}
+
+// backfillTask is fetching every service from a station on a date
+type backfillTask struct {
+	station string
+	date    time.Time
+}
+
+func (t backfillTask) key() string {
+	return t.station + "/" + t.date.Format("2006-01-02")
+}
+
+// pendingTasks makes every station on every date a task, leaving out those finished on an earlier run
+func pendingTasks(dates []time.Time, stations []string, done checkpoint) []backfillTask {
+	var tasks []backfillTask
+	for _, date := range dates {
+		for _, station := range stations {
+			task := backfillTask{station: station, date: date}
+			if !done.has(task.key()) {
+				tasks = append(tasks, task)
+			}
+		}
+	}
+	return tasks
+}
+
+// backfillRun is the shared state of the workers filling the archive
+type backfillRun struct {
+	user       api.User
+	archive    store.Store
+	checkpoint string
+
+	mu       sync.Mutex
+	done     checkpoint
+	total    int
+	finished int
+	failed   int
+}
+
+// all works through the tasks with up to concurrency at once
+func (r *backfillRun) all(ctx context.Context, tasks []backfillTask, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	queue := make(chan backfillTask)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range queue {
+				r.finish(task, r.one(ctx, task))
+			}
+		}()
+	}
+
+dispatch:
+	for _, task := range tasks {
+		select {
+		case queue <- task:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	switch {
+	case ctx.Err() != nil:
+		return fmt.Errorf("stopped after %d of %d station dates, run again to resume", r.finished, r.total)
+	case r.failed > 0:
+		return fmt.Errorf("%d station dates failed, run again to retry them", r.failed)
+	}
+	return nil
+}
+
+// backfillResult counts what happened to the services from one task
+type backfillResult struct {
+	services, fetched, archived int
+	err                         error
+}
+
+// one fetches a task's lineup, then every service on it which isn't already archived
+func (r *backfillRun) one(ctx context.Context, task backfillTask) backfillResult {
+	var result backfillResult
+
+	lineup, err := r.user.ServicesForDate(task.station, task.date)
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	// services can appear more than once, e.g. when they call at a station twice
+	seen := make(map[string]bool)
+	missing := lineup
+	missing.Services = nil
+	for _, entry := range lineup.Services {
+		key := entry.ServiceUID + "/" + entry.RunDate
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		result.services++
+
+		if _, err := r.archive.Service(entry.ServiceUID, entry.RunDate); err == nil {
+			result.archived++
+			continue
+		}
+		missing.Services = append(missing.Services, entry)
+	}
+
+	expansions, err := r.user.ExpandLineup(ctx, missing, 1)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	for _, expansion := range expansions {
+		if expansion.Err == nil {
+			expansion.Err = r.archive.PutService(expansion.Service)
+		}
+		if expansion.Err != nil {
+			result.err = fmt.Errorf("service %s: %v", expansion.Entry.ServiceUID, expansion.Err)
+			continue
+		}
+		result.fetched++
+	}
+	return result
+}
+
+// finish records a task's result, checkpointing it when everything on it was archived
+func (r *backfillRun) finish(task backfillTask, result backfillResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.finished++
+	if result.err != nil {
+		r.failed++
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s: %v\n", r.finished, r.total, task.key(), result.err)
+		return
+	}
+
+	r.done.add(task.key())
+	if err := r.done.save(r.checkpoint); err != nil {
+		fmt.Fprintf(os.Stderr, "saving checkpoint: %v\n", err)
+	}
+	fmt.Fprintf(os.Stderr, "[%d/%d] %s: %d services, %d fetched, %d already archived\n",
+		r.finished, r.total, task.key(), result.services, result.fetched, result.archived)
+}
+
+// dateRange lists every date from one to another inclusive, given as 2006-01-02
+func dateRange(from, to string) ([]time.Time, error) {
+	start, err := time.ParseInLocation("2006-01-02", from, model.London)
+	if err != nil {
+		return nil, err
+	}
+	end, err := time.ParseInLocation("2006-01-02", to, model.London)
+	if err != nil {
+		return nil, err
+	}
+	if end.Before(start) {
+		return nil, errors.New("end date is before start date")
+	}
+
+	var dates []time.Time
+	for date := start; !date.After(end); date = date.AddDate(0, 0, 1) {
+		dates = append(dates, date)
+	}
+	return dates, nil
+}
+
+// checkpoint is the set of station dates a backfill has finished
+type checkpoint map[string]bool
+
+func (c checkpoint) has(key string) bool {
+	return c[key]
+}
+
+func (c checkpoint) add(key string) {
+	c[key] = true
+}
+
+// loadCheckpoint reads a checkpoint file, starting afresh if there isn't one yet
+func loadCheckpoint(path string) (checkpoint, error) {
+	c := make(checkpoint)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+
+	var keys []string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return c, fmt.Errorf("reading checkpoint %s: %v", path, err)
+	}
+	for _, key := range keys {
+		c.add(key)
+	}
+	return c, nil
+}
+
+// save writes the checkpoint as a sorted list, through a temporary file so a crash never leaves half of it
+func (c checkpoint) save(path string) error {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	data, err := json.MarshalIndent(keys, "", "\t")
+	if err != nil {
+		return err
+	}
+	return store.WriteFile(path, data, 0644)
+}
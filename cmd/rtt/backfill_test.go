@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/api"
+	"github.com/georgeprice/realtime-trains-golang/model"
+	"github.com/georgeprice/realtime-trains-golang/store"
+)
+
+func TestDateRange(t *testing.T) {
+
+	ts := []struct {
+		name, from, to string
+		expected       []string
+		fails          bool
+	}{
+		{"single", "2020-02-12", "2020-02-12", []string{"2020-02-12"}, false},
+		{"month-end", "2020-02-28", "2020-03-01", []string{"2020-02-28", "2020-02-29", "2020-03-01"}, false},
+		{"clocks-change", "2020-03-28", "2020-03-30", []string{"2020-03-28", "2020-03-29", "2020-03-30"}, false},
+		{"backwards", "2020-02-12", "2020-02-11", nil, true},
+		{"bad-date", "2020-02-30", "2020-03-01", nil, true},
+	}
+
+	for _, tc := range ts {
+		dates, err := dateRange(tc.from, tc.to)
+		if (err != nil) != tc.fails {
+			t.Errorf("%s: Got wrong error, got %v", tc.name, err)
+			continue
+		}
+
+		var got []string
+		for _, date := range dates {
+			got = append(got, date.Format("2006-01-02"))
+		}
+		if !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: Got wrong dates, got %v, expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtt-backfill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "backfill.json")
+
+	// a missing checkpoint starts afresh
+	done, err := loadCheckpoint(path)
+	if err != nil || len(done) != 0 {
+		t.Fatalf("Got wrong checkpoint, got %v, %v", done, err)
+	}
+
+	done.add("MAN/2020-02-12")
+	done.add("BHM/2020-02-11")
+	if err := done.save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadCheckpoint(path)
+	switch {
+	case err != nil:
+		t.Fatal(err)
+	case !reflect.DeepEqual(loaded, done):
+		t.Fatalf("Got wrong checkpoint, got %v, expected %v", loaded, done)
+	}
+
+	// resuming leaves out the station dates already finished
+	dates, err := dateRange("2020-02-11", "2020-02-12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, task := range pendingTasks(dates, []string{"MAN", "BHM"}, loaded) {
+		keys = append(keys, task.key())
+	}
+	if expected := []string{"MAN/2020-02-11", "BHM/2020-02-12"}; !reflect.DeepEqual(keys, expected) {
+		t.Errorf("Got wrong tasks, got %v, expected %v", keys, expected)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadCheckpoint(path); err == nil {
+		t.Error("Got nil error for a corrupt checkpoint, expected error")
+	}
+}
+
+func TestBackfillSkipsArchived(t *testing.T) {
+
+	// the server lists three services on the day, counting which are fetched in full
+	var (
+		mu      sync.Mutex
+		fetched []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		parts := strings.Split(req.URL.Path, "/")
+		if parts[1] == "search" {
+			fmt.Fprint(rw, `{"services": [
+				{"serviceUid": "S1", "runDate": "2020-02-12"},
+				{"serviceUid": "S2", "runDate": "2020-02-12"},
+				{"serviceUid": "S3", "runDate": "2020-02-12"},
+				{"serviceUid": "S1", "runDate": "2020-02-12"}]}`)
+			return
+		}
+
+		mu.Lock()
+		fetched = append(fetched, parts[2])
+		mu.Unlock()
+		fmt.Fprintf(rw, `{"serviceUid": "%s", "runDate": "2020-02-12"}`, parts[2])
+	}))
+	defer server.Close()
+
+	base, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := api.New("", "", base, &http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "rtt-backfill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archive, err := store.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := archive.PutService(model.Service{ServiceUID: "S2", RunDate: "2020-02-12"}); err != nil {
+		t.Fatal(err)
+	}
+
+	run := &backfillRun{user: user, archive: archive, checkpoint: filepath.Join(dir, "backfill.json"), done: make(checkpoint), total: 1}
+	task := backfillTask{station: "MAN", date: time.Date(2020, 2, 12, 0, 0, 0, 0, model.London)}
+
+	result := run.one(context.Background(), task)
+	switch {
+	case result.err != nil:
+		t.Fatal(result.err)
+	case result.services != 3 || result.archived != 1 || result.fetched != 2:
+		t.Errorf("Got wrong counts, got %+v", result)
+	case !reflect.DeepEqual(fetched, []string{"S1", "S3"}):
+		t.Errorf("Got wrong services fetched, got %v", fetched)
+	}
+
+	if _, err := archive.Service("S3", "2020-02-12"); err != nil {
+		t.Errorf("Got service missing from the archive, got %v", err)
+	}
+
+	run.finish(task, result)
+	if done, err := loadCheckpoint(run.checkpoint); err != nil || !done.has(task.key()) {
+		t.Errorf("Got task missing from the checkpoint, got %v, %v", done, err)
+	}
+}
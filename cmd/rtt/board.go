@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/api"
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// ANSI escape codes for drawing the board
+const (
+	clearScreen = "\x1b[H\x1b[2J"
+	reset       = "\x1b[0m"
+	red         = "\x1b[31m"
+	yellow      = "\x1b[1;33m"
+	inverse     = "\x1b[7m"
+)
+
+// board shows a live departure board for a station, redrawing it in the terminal on an interval.
+// Commands are typed followed by enter, as reading single key presses needs a raw terminal
+func board(args []string) error {
+
+	flags := newFlagSet("board")
+	interval := flags.Duration("interval", 30*time.Second, "how often to refresh the board")
+	rows := flags.Int("rows", 10, "services on each page")
+	plain := flags.Bool("plain", false, "draw the board without colours")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("expected a station CRS")
+	}
+	if *interval <= 0 || *rows <= 0 {
+		return errors.New("interval and rows must be positive")
+	}
+
+	user, err := api.NewFromEnv()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+
+	b := newLiveBoard(user, flags.Arg(0), *rows, !*plain)
+	return b.run(os.Stdin, os.Stdout, ticker.C)
+}
+
+// boardSource is where the board gets its data, an api.User outside of tests
+type boardSource interface {
+	Departures(origin string) (model.Lineup, error)
+	ServiceInfo(id string, date time.Time) (model.Service, error)
+}
+
+// liveBoard is the state of a departure board between redraws
+type liveBoard struct {
+	source boardSource
+	crs    string
+	rows   int
+	color  bool
+	now    func() time.Time
+
+	lineup  model.Lineup
+	updated time.Time
+
+	// err is from the last refresh, the board keeps showing the lineup from before it
+	err error
+
+	// message answers the last command, e.g. when it isn't understood
+	message string
+
+	page int
+
+	// selected is the UID and run date of the service whose calling points are shown, if any, as
+	// RTT reuses UIDs on other days and a board can span midnight
+	selected string
+	calling  model.Service
+}
+
+func newLiveBoard(source boardSource, crs string, rows int, color bool) *liveBoard {
+	return &liveBoard{source: source, crs: strings.ToUpper(crs), rows: rows, color: color, now: time.Now}
+}
+
+// run refreshes the board on each tick and handles commands read from in, until it is told to quit or
+// tick is closed. Once in ends the board carries on refreshing, so it can run as a station screen with no input
+func (b *liveBoard) run(in io.Reader, out io.Writer, tick <-chan time.Time) error {
+
+	lines := make(chan string)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	b.refresh()
+	for {
+		if _, err := io.WriteString(out, clearScreen+b.render()); err != nil {
+			return err
+		}
+
+		select {
+		case _, ok := <-tick:
+			if !ok {
+				return nil
+			}
+			b.refresh()
+		case line, ok := <-lines:
+			if !ok {
+				lines = nil
+				continue
+			}
+			if !b.command(line) {
+				return nil
+			}
+		}
+	}
+}
+
+// refresh fetches the departures, and the calling points of the selected service
+func (b *liveBoard) refresh() {
+	lineup, err := b.source.Departures(b.crs)
+	if err != nil {
+		b.err = err
+		return
+	}
+	b.lineup, b.updated, b.err = lineup, b.now(), nil
+
+	if last := b.pages() - 1; b.page > last {
+		b.page = last
+	}
+	if b.selected != "" {
+		b.fetchCalling()
+	}
+}
+
+// pages counts the pages of services on the board, there is always at least one
+func (b *liveBoard) pages() int {
+	if n := (len(b.lineup.Services) + b.rows - 1) / b.rows; n > 1 {
+		return n
+	}
+	return 1
+}
+
+// onPage returns the services on the current page
+func (b *liveBoard) onPage() []model.LocationContainer {
+	start := b.page * b.rows
+	if start >= len(b.lineup.Services) {
+		return nil
+	}
+	end := start + b.rows
+	if end > len(b.lineup.Services) {
+		end = len(b.lineup.Services)
+	}
+	return b.lineup.Services[start:end]
+}
+
+// command handles a line typed by the user, returning false when they want to quit
+func (b *liveBoard) command(line string) bool {
+	b.message = ""
+
+	switch line = strings.ToLower(strings.TrimSpace(line)); line {
+	case "q", "quit":
+		return false
+	case "", "r":
+		b.refresh()
+	case "n":
+		if b.page < b.pages()-1 {
+			b.page++
+		}
+	case "p":
+		if b.page > 0 {
+			b.page--
+		}
+	case "c":
+		b.selected, b.calling = "", model.Service{}
+	default:
+		row, err := strconv.Atoi(line)
+		services := b.onPage()
+		if err != nil || row < 1 || row > len(services) {
+			b.message = fmt.Sprintf("unknown command %q", line)
+			return true
+		}
+		b.selected, b.calling = services[row-1].ServiceUID+"/"+services[row-1].RunDate, model.Service{}
+		b.fetchCalling()
+	}
+	return true
+}
+
+// fetchCalling gets the selected service, which must still be on the board
+func (b *liveBoard) fetchCalling() {
+	for _, c := range b.lineup.Services {
+		if c.ServiceUID+"/"+c.RunDate != b.selected {
+			continue
+		}
+
+		date, err := time.ParseInLocation("2006-01-02", c.RunDate, model.London)
+		if err == nil {
+			b.calling, err = b.source.ServiceInfo(c.ServiceUID, date)
+		}
+		if err != nil {
+			b.message = fmt.Sprintf("couldn't get calling points of %s: %v", c.ServiceUID, err)
+		}
+		return
+	}
+	b.selected, b.calling = "", model.Service{}
+}
+
+// paint wraps text in an ANSI colour, when the board is drawn in colour
+func (b *liveBoard) paint(code, text string) string {
+	if !b.color || code == "" {
+		return text
+	}
+	return code + text + reset
+}
+
+// fit pads or cuts text to a width, so columns line up whatever colours are added
+func fit(text string, width int) string {
+	r := []rune(text)
+	if len(r) > width {
+		return string(r[:width])
+	}
+	return text + strings.Repeat(" ", width-len(r))
+}
+
+// status describes a realtime time against the booked one, as boards do
+func status(booked, realtime time.Time, cancelled bool) string {
+	switch {
+	case cancelled:
+		return "Cancelled"
+	case booked.IsZero() || realtime.IsZero():
+		return ""
+	case realtime.Truncate(time.Minute).Equal(booked.Truncate(time.Minute)):
+		return "On time"
+	}
+	return "Exp " + realtime.Format("15:04")
+}
+
+// clock formats a time for the board, leaving missing times blank
+func clock(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("15:04")
+}
+
+// destination names where a service on the board is going
+func destination(c model.LocationContainer) string {
+	destinations := c.LocationDetail.Destination
+	if len(destinations) == 0 {
+		destinations = c.Destination
+	}
+	var names []string
+	for _, d := range destinations {
+		names = append(names, d.Description)
+	}
+	return strings.Join(names, " & ")
+}
+
+// render draws the board, the current page of services then the calling points of the selected service
+func (b *liveBoard) render() string {
+	var s strings.Builder
+
+	name := b.lineup.Location.Name
+	if name == "" {
+		name = b.crs
+	}
+	fmt.Fprintf(&s, "%s (%s)  %s\n\n", name, b.crs, b.now().In(model.London).Format("15:04:05"))
+	fmt.Fprintf(&s, "%-3s %-5s  %-30s %-5s %s\n", "", "TIME", "DESTINATION", "PLAT", "EXPECTED")
+
+	for i, c := range b.onPage() {
+		booked, _ := c.BookedTime()
+		var realtime time.Time
+		if c.RealTimeActivated {
+			realtime, _ = c.RealtimeTime()
+		}
+
+		expected := status(booked, realtime, c.Cancelled())
+		if c.RealTimeDepartureActual {
+			expected = "Departed"
+		}
+
+		platform := fit(c.Platform, 5)
+		if c.PlatformChanged && !c.Cancelled() {
+			platform = b.paint(yellow, fit(c.Platform+"*", 5))
+		}
+
+		selected := c.ServiceUID+"/"+c.RunDate == b.selected
+		marker := " "
+		if selected && !b.color {
+			marker = ">"
+		}
+		row := fmt.Sprintf("%s%-2d %-5s  %s %s %s", marker, i+1, clock(booked), fit(destination(c), 30), platform, expected)
+		row = strings.TrimRight(row, " ")
+		switch {
+		case selected && b.color:
+			row = inverse + strings.Replace(row, reset, reset+inverse, -1) + reset
+		case c.Cancelled():
+			row = b.paint(red, row)
+		}
+		s.WriteString(row + "\n")
+	}
+	if len(b.lineup.Services) == 0 {
+		s.WriteString("No services\n")
+	}
+
+	fmt.Fprintf(&s, "\nPage %d of %d   n next  p previous  1-%d calling points  c close  q quit\n", b.page+1, b.pages(), b.rows)
+	if !b.updated.IsZero() {
+		fmt.Fprintf(&s, "Updated %s\n", b.updated.In(model.London).Format("15:04:05"))
+	}
+	if b.err != nil {
+		s.WriteString(b.paint(red, "Refresh failed: "+b.err.Error()) + "\n")
+	}
+	if b.message != "" {
+		s.WriteString(b.message + "\n")
+	}
+
+	if b.selected != "" && len(b.calling.Locations) > 0 {
+		b.renderCalling(&s)
+	}
+	return s.String()
+}
+
+// renderCalling lists the public calls the selected service makes after the station
+func (b *liveBoard) renderCalling(s *strings.Builder) {
+	fmt.Fprintf(s, "\nCalling points of %s\n", strings.TrimSpace(b.calling.ServiceUID+" "+b.calling.ATOCName))
+
+	start := b.calling.IndexOf(b.crs)
+	for _, d := range b.calling.Locations[start+1:] {
+		if !d.PublicCall() {
+			continue
+		}
+
+		booked, err := d.BookedArrivalTime(b.calling.RunDate)
+		if err != nil {
+			booked, _ = d.BookedDepartureTime(b.calling.RunDate)
+		}
+
+		// like the board, booked times stand in where RTT has no realtime data
+		var realtime time.Time
+		if d.RealTimeActivated {
+			realtime = booked
+			if t, err := d.RealtimeArrivalTime(b.calling.RunDate); err == nil {
+				realtime = t
+			} else if t, err := d.RealtimeDepartureTime(b.calling.RunDate); err == nil {
+				realtime = t
+			}
+		}
+
+		row := fmt.Sprintf("    %-5s  %s %s", clock(booked), fit(d.Description, 30), status(booked, realtime, d.Cancelled()))
+		if d.Cancelled() {
+			row = b.paint(red, row)
+		}
+		s.WriteString(strings.TrimRight(row, " ") + "\n")
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+	"github.com/georgeprice/realtime-trains-golang/model/modeltest"
+)
+
+// fakeSource serves a lineup of services to numbered destinations, and counts requests
+type fakeSource struct {
+	lineup      model.Lineup
+	err         error
+	departures  int
+	serviceInfo []string
+}
+
+func (f *fakeSource) Departures(origin string) (model.Lineup, error) {
+	f.departures++
+	return f.lineup, f.err
+}
+
+func (f *fakeSource) ServiceInfo(id string, date time.Time) (model.Service, error) {
+	f.serviceInfo = append(f.serviceInfo, id+" "+date.Format("2006-01-02"))
+	service := modeltest.Service(id,
+		modeltest.Stop("MAN", "", "1200"),
+		modeltest.Call{CRS: "SPT", Arrival: "1208", Departure: "1209", RealArrival: "1211"},
+		modeltest.Call{CRS: "MAC", Arrival: "1220", Departure: "1221", Cancelled: true},
+		modeltest.Stop("SOT", "1240", ""),
+	)
+	for i, name := range []string{"Manchester Piccadilly", "Stockport", "Macclesfield", "Stoke-on-Trent"} {
+		service.Locations[i].Description = name
+		service.Locations[i].RealTimeActivated = true
+	}
+	return service, nil
+}
+
+// boardLineup has n services leaving MAN a minute apart from 1200
+func boardLineup(n int) model.Lineup {
+	lineup := model.Lineup{Location: model.LocationDetailHeader{Name: "Manchester Piccadilly", CRS: "MAN"}}
+	for i := 0; i < n; i++ {
+		lineup.Services = append(lineup.Services, model.LocationContainer{
+			LocationDetail: model.LocationDetail{
+				RealTimeActivated:   true,
+				GBTTBookedDeparture: fmt.Sprintf("12%02d", i),
+				Platform:            "1",
+				Destination:         []model.Pair{{Description: fmt.Sprintf("Destination %d", i)}},
+			},
+			ServiceUID: fmt.Sprintf("S%d", i),
+			RunDate:    modeltest.RunDate,
+		})
+	}
+	return lineup
+}
+
+func testBoard(source *fakeSource, color bool) *liveBoard {
+	b := newLiveBoard(source, "man", 3, color)
+	b.now = func() time.Time { return time.Date(2020, 2, 12, 12, 0, 0, 0, model.London) }
+	return b
+}
+
+func TestBoardRender(t *testing.T) {
+	source := &fakeSource{lineup: boardLineup(4)}
+	services := source.lineup.Services
+	services[0].RealTimeDeparture = "1200"
+	services[1].RealTimeDeparture = "1204"
+	services[1].Platform, services[1].PlatformChanged = "2", true
+	services[2].CancelReasonCode = "TG"
+
+	b := testBoard(source, false)
+	b.refresh()
+
+	expected := []string{
+		"Manchester Piccadilly (MAN)  12:00:00",
+		"",
+		"    TIME   DESTINATION                    PLAT  EXPECTED",
+		" 1  12:00  Destination 0                  1     On time",
+		" 2  12:01  Destination 1                  2*    Exp 12:04",
+		" 3  12:02  Destination 2                  1     Cancelled",
+		"",
+		"Page 1 of 2   n next  p previous  1-3 calling points  c close  q quit",
+		"Updated 12:00:00",
+	}
+	if got := b.render(); got != strings.Join(expected, "\n")+"\n" {
+		t.Errorf("Got wrong board, got\n%s\nexpected\n%s", got, strings.Join(expected, "\n"))
+	}
+
+	// colours pick out the platform change and cancellation
+	b.color = true
+	got := b.render()
+	for _, highlight := range []string{yellow + "2*   " + reset, red + " 3  12:02"} {
+		if !strings.Contains(got, highlight) {
+			t.Errorf("Got board without %q, got\n%s", highlight, got)
+		}
+	}
+}
+
+func TestBoardCommands(t *testing.T) {
+	source := &fakeSource{lineup: boardLineup(4)}
+	b := testBoard(source, false)
+	b.refresh()
+
+	ts := []struct {
+		command  string
+		page     int
+		selected string
+		message  string
+	}{
+		{"n", 1, "", ""},
+		{"n", 1, "", ""},
+		{"1", 1, "S3/2020-02-12", ""},
+		{"2", 1, "S3/2020-02-12", `unknown command "2"`},
+		{"p", 0, "S3/2020-02-12", ""},
+		{"2", 0, "S1/2020-02-12", ""},
+		{"c", 0, "", ""},
+		{"p", 0, "", ""},
+		{"board", 0, "", `unknown command "board"`},
+	}
+
+	for i, tc := range ts {
+		if !b.command(tc.command) {
+			t.Fatalf("%d: Got quit from %q", i, tc.command)
+		}
+		if b.page != tc.page || b.selected != tc.selected || b.message != tc.message {
+			t.Errorf("%d: Got wrong state after %q, got page %d, selected %q, message %q, expected %d, %q, %q",
+				i, tc.command, b.page, b.selected, b.message, tc.page, tc.selected, tc.message)
+		}
+	}
+
+	expected := []string{"S3 2020-02-12", "S1 2020-02-12"}
+	if strings.Join(source.serviceInfo, ",") != strings.Join(expected, ",") {
+		t.Errorf("Got wrong services fetched, got %v, expected %v", source.serviceInfo, expected)
+	}
+	if b.command("q") {
+		t.Errorf("Got no quit from q")
+	}
+}
+
+func TestBoardCalling(t *testing.T) {
+	source := &fakeSource{lineup: boardLineup(2)}
+	b := testBoard(source, false)
+	b.refresh()
+	b.command("2")
+
+	got := b.render()
+	for _, expected := range []string{
+		"\n>2  12:01  Destination 1                  1     On time\n",
+		strings.Join([]string{
+			"\nCalling points of S1",
+			"    12:08  Stockport                      Exp 12:11",
+			"    12:20  Macclesfield                   Cancelled",
+			"    12:40  Stoke-on-Trent                 On time\n",
+		}, "\n"),
+	} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("Got wrong calling points, got\n%s\nexpected\n%s", got, expected)
+		}
+	}
+
+	// the selection goes once the service leaves the board
+	source.lineup = boardLineup(1)
+	b.refresh()
+	if b.selected != "" || strings.Contains(b.render(), "Calling points") {
+		t.Errorf("Got selection kept after service left the board, got %q", b.selected)
+	}
+}
+
+func TestBoardRefreshFails(t *testing.T) {
+	source := &fakeSource{lineup: boardLineup(4)}
+	b := testBoard(source, false)
+	b.refresh()
+	b.command("n")
+
+	// a failed refresh keeps the board, and a shorter lineup pulls the page back
+	source.err = errors.New("API rate limit exceeded")
+	b.refresh()
+	if got := b.render(); !strings.Contains(got, "Destination 3") || !strings.Contains(got, "Refresh failed: API rate limit exceeded") {
+		t.Errorf("Got wrong board after failed refresh, got\n%s", got)
+	}
+
+	source.lineup, source.err = boardLineup(2), nil
+	b.refresh()
+	if b.page != 0 || b.err != nil {
+		t.Errorf("Got wrong state after refresh, got page %d, error %v", b.page, b.err)
+	}
+}
+
+func TestBoardRun(t *testing.T) {
+	source := &fakeSource{lineup: boardLineup(4)}
+	b := testBoard(source, false)
+
+	var out strings.Builder
+	if err := b.run(strings.NewReader("n\n\nq\nn\n"), &out, nil); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+
+	// drawn at the start and after each command before quitting
+	if got := strings.Count(out.String(), clearScreen); got != 3 {
+		t.Errorf("Got wrong number of redraws, got %d, expected %d", got, 3)
+	}
+	if source.departures != 2 {
+		t.Errorf("Got wrong number of refreshes, got %d, expected %d", source.departures, 2)
+	}
+}
+
+func TestBoardRunWithoutInput(t *testing.T) {
+	source := &fakeSource{lineup: boardLineup(4)}
+	b := testBoard(source, false)
+
+	// with nothing to read the board keeps refreshing on each tick, until the ticks stop
+	tick := make(chan time.Time)
+	go func() {
+		for i := 0; i < 2; i++ {
+			select {
+			case tick <- time.Now():
+			case <-time.After(time.Second):
+			}
+		}
+		close(tick)
+	}()
+
+	var out strings.Builder
+	if err := b.run(strings.NewReader(""), &out, tick); err != nil {
+		t.Fatalf("Got error %v", err)
+	}
+	if source.departures != 3 {
+		t.Errorf("Got wrong number of refreshes, got %d, expected %d", source.departures, 3)
+	}
+}
+
+func TestBoardAcrossMidnight(t *testing.T) {
+
+	// RTT reuses UIDs on other days, so a board spanning midnight can list the same UID twice
+	lineup := boardLineup(2)
+	lineup.Services[1].ServiceUID, lineup.Services[1].RunDate = "S0", "2020-02-13"
+	source := &fakeSource{lineup: lineup}
+	b := testBoard(source, false)
+	b.refresh()
+	b.command("2")
+
+	got := b.render()
+	switch {
+	case strings.Join(source.serviceInfo, ",") != "S0 2020-02-13":
+		t.Errorf("Got wrong services fetched, got %v", source.serviceInfo)
+	case strings.Count(got, "\n>") != 1 || !strings.Contains(got, "\n>2 "):
+		t.Errorf("Got wrong row selected, got\n%s", got)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/georgeprice/realtime-trains-golang/api"
+	"github.com/georgeprice/realtime-trains-golang/filter"
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// departures prints the departure board for a station, optionally only services to a destination
+func departures(args []string) error {
+
+	flags := newFlagSet("departures")
+	expr := flags.String("filter", "", "only show services matching a filter, e.g. 'operator=SW platform in (3,4) !cancelled'")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	e, err := filter.Parse(*expr)
+	if err != nil {
+		return err
+	}
+
+	lineup, err := fetchDepartures(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	return printLineup(filter.Apply(e, lineup))
+}
+
+// fetchDepartures gets the lineup for the CRS and optional destination given as arguments
+func fetchDepartures(args []string) (model.Lineup, error) {
+
+	user, err := api.NewFromEnv()
+	if err != nil {
+		return model.Lineup{}, err
+	}
+
+	switch len(args) {
+	case 1:
+		return user.Departures(args[0])
+	case 2:
+		return user.DeparturesToDestination(args[0], args[1])
+	}
+	return model.Lineup{}, errors.New("expected a station CRS and optional destination")
+}
+
+// printLineup writes a lineup as a table of services
+func printLineup(lineup model.Lineup) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tEXPECTED\tPLAT\tDESTINATION\tOPERATOR\tUID")
+
+	for _, service := range lineup.Services {
+		var destination string
+		if len(service.LocationDetail.Destination) > 0 {
+			destination = service.LocationDetail.Destination[0].Description
+		}
+
+		expected := service.RealTimeDeparture
+		if service.Cancelled() {
+			expected = "Cancelled"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			service.GBTTBookedDeparture, expected, service.Platform, destination, service.ATOCName, service.ServiceUID)
+	}
+	return w.Flush()
+}
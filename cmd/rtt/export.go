@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/api"
+	"github.com/georgeprice/realtime-trains-golang/export"
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// runExport writes the departures from a station, or the locations of a service, as CSV or NDJSON
+func runExport(args []string) error {
+
+	flags := newFlagSet("export")
+	format := flags.String("format", "csv", "output format, "+strings.Join(export.Formats, " or "))
+	columns := flags.String("columns", "", "comma separated columns to write, defaults to all of "+strings.Join(export.Columns(), ","))
+	date := flags.String("date", "", "date to export, as 2006-01-02, defaults to the live departures or today's service")
+	uid := flags.String("service", "", "export the locations of a service instead of a station's departures")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var names []string
+	if *columns != "" {
+		names = strings.Split(*columns, ",")
+	}
+	e, err := export.NewEncoder(*format, os.Stdout, names)
+	if err != nil {
+		return err
+	}
+
+	day := time.Now().In(model.London)
+	if *date != "" {
+		if day, err = time.ParseInLocation("2006-01-02", *date, model.London); err != nil {
+			return err
+		}
+	}
+
+	user, err := api.NewFromEnv()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *uid != "" && flags.NArg() == 0:
+		service, err := user.ServiceInfo(*uid, day)
+		if err != nil {
+			return err
+		}
+		if err := e.Service(service); err != nil {
+			return err
+		}
+
+	case *uid == "" && flags.NArg() == 1:
+		var lineup model.Lineup
+		if *date != "" {
+			lineup, err = user.ServicesForDate(flags.Arg(0), day)
+		} else {
+			lineup, err = user.Departures(flags.Arg(0))
+		}
+		if err != nil {
+			return err
+		}
+		if err := e.Lineup(lineup); err != nil {
+			return err
+		}
+
+	default:
+		return errors.New("expected either a station CRS or -service")
+	}
+	return e.Flush()
+}
@@ -0,0 +1,73 @@
+// Command rtt is a command line client for the Realtime Trains API
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/georgeprice/realtime-trains-golang/api"
+)
+
+// command is a sub-command of the CLI, run with the arguments following its name
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+// commands is filled in by init, as commands look up their own usage
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"backfill":   {"backfill -archive dir -from date [-to date] [-concurrency n] [-rate n] [-checkpoint file] CRS...", backfill},
+		"board":      {"board [-interval duration] [-rows n] [-plain] CRS", board},
+		"departures": {"departures [-filter expr] CRS [DESTINATION]", departures},
+		"export":     {"export [-format csv|ndjson] [-columns list] [-date date] (CRS | -service UID)", runExport},
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: rtt <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  rtt", commands[name].usage)
+	}
+
+	fmt.Fprintln(os.Stderr, "\ncredentials are read from RTT_USERNAME and RTT_PASSWORD, and RTT_API overrides", api.DefaultBaseURL)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "rtt:", err)
+		os.Exit(1)
+	}
+}
+
+// newFlagSet creates the flags for a command, printing its usage line on error
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: rtt", commands[name].usage)
+		flags.PrintDefaults()
+	}
+	return flags
+}
@@ -0,0 +1,206 @@
+package export
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// row is one flattened line of output, a service on a lineup or a location on a service.
+// Service-level fields come from the lineup entry or are repeated from the service
+type row struct {
+
+	// station is the lineup's CRS code, empty for service rows
+	station string
+
+	// index is the position in the service's locations, -1 for lineup rows
+	index int
+
+	uid, runDate                   string
+	trainIdentity, runningIdentity string
+	operator, operatorName, kind   string
+	passenger, plannedCancel       bool
+	origin, destination            []model.Pair
+	detail                         model.LocationDetail
+}
+
+// pairNames joins the descriptions of origins or destinations, falling back on their TIPLOCs
+func pairNames(pairs ...[]model.Pair) interface{} {
+	for _, ps := range pairs {
+		if len(ps) == 0 {
+			continue
+		}
+		var names []string
+		for _, p := range ps {
+			name := p.Description
+			if name == "" {
+				name = p.TIPLOC
+			}
+			names = append(names, name)
+		}
+		return strings.Join(names, " & ")
+	}
+	return nil
+}
+
+// clock parses a time from the row, leaving it out when RTT doesn't have one
+func clock(parse func(model.LocationDetail, string) (time.Time, error)) func(row) interface{} {
+	return func(r row) interface{} {
+		t, err := parse(r.detail, r.runDate)
+		if err != nil {
+			return nil
+		}
+		return t
+	}
+}
+
+// lateness returns a lateness in minutes, only when there's a realtime time for it to be measured from
+func lateness(realtime func(model.LocationDetail) string, minutes func(model.LocationDetail) int) func(row) interface{} {
+	return func(r row) interface{} {
+		if realtime(r.detail) == "" {
+			return nil
+		}
+		return minutes(r.detail)
+	}
+}
+
+// column is a named value read from a row
+type column struct {
+	name  string
+	value func(row) interface{}
+}
+
+// columns lists everything which can be exported, in the default order
+var columns = []column{
+	{"station", func(r row) interface{} {
+		if r.station == "" {
+			return nil
+		}
+		return r.station
+	}},
+	{"index", func(r row) interface{} {
+		if r.index < 0 {
+			return nil
+		}
+		return r.index
+	}},
+	{"uid", func(r row) interface{} { return r.uid }},
+	{"run_date", func(r row) interface{} { return r.runDate }},
+	{"train_identity", func(r row) interface{} { return r.trainIdentity }},
+	{"running_identity", func(r row) interface{} { return r.runningIdentity }},
+	{"operator", func(r row) interface{} { return r.operator }},
+	{"operator_name", func(r row) interface{} { return r.operatorName }},
+	{"service_type", func(r row) interface{} { return r.kind }},
+	{"passenger", func(r row) interface{} { return r.passenger }},
+	{"planned_cancel", func(r row) interface{} { return r.plannedCancel }},
+	{"origin", func(r row) interface{} { return pairNames(r.detail.Origin, r.origin) }},
+	{"destination", func(r row) interface{} { return pairNames(r.detail.Destination, r.destination) }},
+	{"tiploc", func(r row) interface{} { return r.detail.TIPLOC }},
+	{"crs", func(r row) interface{} { return r.detail.CRS }},
+	{"location", func(r row) interface{} { return r.detail.Description }},
+	{"public_call", func(r row) interface{} { return r.detail.IsCallPublic }},
+	{"booked_arrival", clock(model.LocationDetail.BookedArrivalTime)},
+	{"booked_departure", clock(model.LocationDetail.BookedDepartureTime)},
+	{"booked_pass", clock(model.LocationDetail.BookedPassTime)},
+	{"realtime_arrival", clock(model.LocationDetail.RealtimeArrivalTime)},
+	{"realtime_arrival_actual", func(r row) interface{} { return r.detail.RealTimeArrivalActual }},
+	{"realtime_departure", clock(model.LocationDetail.RealtimeDepartureTime)},
+	{"realtime_departure_actual", func(r row) interface{} { return r.detail.RealTimeDepartureActual }},
+	{"realtime_pass", clock(model.LocationDetail.RealtimePassTime)},
+	{"realtime_pass_actual", func(r row) interface{} { return r.detail.RealTimePassActual }},
+	{"arrival_lateness", lateness(func(d model.LocationDetail) string { return d.RealTimeArrival },
+		func(d model.LocationDetail) int { return d.RealTimeGBTTArrivalLateness })},
+	{"departure_lateness", lateness(func(d model.LocationDetail) string { return d.RealTimeDeparture },
+		func(d model.LocationDetail) int { return d.RealTimeGBTTDepartureLateness })},
+	{"platform", func(r row) interface{} { return r.detail.Platform }},
+	{"platform_confirmed", func(r row) interface{} { return r.detail.PlatformConfirmed }},
+	{"platform_changed", func(r row) interface{} { return r.detail.PlatformChanged }},
+	{"cancelled", func(r row) interface{} { return r.plannedCancel || r.detail.Cancelled() }},
+	{"cancel_reason", func(r row) interface{} { return r.detail.CancelReasonShortText }},
+	{"display_as", func(r row) interface{} { return r.detail.DisplayAs }},
+	{"service_location", func(r row) interface{} { return r.detail.ServiceLocation }},
+}
+
+// Columns lists the names of every column, in the order they are written by default
+func Columns() []string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+// selectColumns looks up columns by name, ignoring case, or returns them all when none are given
+func selectColumns(names []string) ([]column, error) {
+	if len(names) == 0 {
+		return columns, nil
+	}
+
+	selected := make([]column, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, c := range columns {
+			if strings.EqualFold(c.name, strings.TrimSpace(name)) {
+				selected = append(selected, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			known := Columns()
+			sort.Strings(known)
+			return nil, fmt.Errorf("export: unknown column %q, expected one of %s", name, strings.Join(known, ", "))
+		}
+	}
+	return selected, nil
+}
+
+// lineupRows flattens a lineup into a row for each service on it
+func lineupRows(lineup model.Lineup) []row {
+	rows := make([]row, 0, len(lineup.Services))
+	for _, c := range lineup.Services {
+		rows = append(rows, row{
+			station:         lineup.Location.CRS,
+			index:           -1,
+			uid:             c.ServiceUID,
+			runDate:         c.RunDate,
+			trainIdentity:   c.TrainIdentity,
+			runningIdentity: c.RunningIdentity,
+			operator:        c.ATOCCode,
+			operatorName:    c.ATOCName,
+			kind:            c.ServiceType,
+			passenger:       c.IsPassenger,
+			plannedCancel:   c.PlannedCancel,
+			origin:          c.Origin,
+			destination:     c.Destination,
+			detail:          c.LocationDetail,
+		})
+	}
+	return rows
+}
+
+// serviceRows flattens a service into a row for each of its locations
+func serviceRows(service model.Service) []row {
+	rows := make([]row, 0, len(service.Locations))
+	for i, location := range service.Locations {
+		rows = append(rows, row{
+			index:           i,
+			uid:             service.ServiceUID,
+			runDate:         service.RunDate,
+			trainIdentity:   service.TrainIdentity,
+			runningIdentity: service.RunningIdentity,
+			operator:        service.ATOCCode,
+			operatorName:    service.ATOCName,
+			kind:            string(service.ServiceType),
+			passenger:       service.IsPassenger,
+			plannedCancel:   service.PlannedCancel,
+			origin:          service.Origin,
+			destination:     service.Destination,
+			detail:          location,
+		})
+	}
+	return rows
+}
@@ -0,0 +1,189 @@
+// Package export flattens lineups and services into rows for spreadsheets and data pipelines, writing them
+// as CSV or newline delimited JSON. A lineup has a row for each service on it, and a service a row for
+// each of its locations with the service's own fields repeated on every row. Times are parsed from RTT's
+// clock times into RFC 3339 timestamps, and missing values are left empty or null
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// Encoder writes lineups and services as rows, Flush must be called once everything has been written
+type Encoder interface {
+	Lineup(lineup model.Lineup) error
+	Service(service model.Service) error
+	Flush() error
+}
+
+// Formats lists the formats NewEncoder accepts
+var Formats = []string{"csv", "ndjson"}
+
+// NewEncoder creates an encoder for a format, "csv" or "ndjson", writing the named columns.
+// Every column is written when none are given, see Columns
+func NewEncoder(format string, w io.Writer, names []string) (Encoder, error) {
+	switch format {
+	case "csv":
+		return NewCSVEncoder(w, names)
+	case "ndjson":
+		return NewNDJSONEncoder(w, names)
+	}
+	return nil, fmt.Errorf("export: unknown format %q, expected csv or ndjson", format)
+}
+
+// formatTime is how times are written, in the UK's timezone as RTT gives them
+func formatTime(t time.Time) string {
+	return t.In(model.London).Format(time.RFC3339)
+}
+
+// CSVEncoder writes rows as CSV, with a header row naming the columns before the first row
+type CSVEncoder struct {
+	w       *csv.Writer
+	columns []column
+	started bool
+}
+
+// NewCSVEncoder creates an encoder writing the named columns as CSV, or every column when none are given
+func NewCSVEncoder(w io.Writer, names []string) (*CSVEncoder, error) {
+	selected, err := selectColumns(names)
+	if err != nil {
+		return nil, err
+	}
+	return &CSVEncoder{w: csv.NewWriter(w), columns: selected}, nil
+}
+
+// Lineup writes a row for each service on a lineup
+func (e *CSVEncoder) Lineup(lineup model.Lineup) error {
+	return e.write(lineupRows(lineup))
+}
+
+// Service writes a row for each location on a service
+func (e *CSVEncoder) Service(service model.Service) error {
+	return e.write(serviceRows(service))
+}
+
+// Flush writes out anything buffered, including the header when no rows have been written
+func (e *CSVEncoder) Flush() error {
+	if err := e.header(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *CSVEncoder) header() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+
+	names := make([]string, len(e.columns))
+	for i, c := range e.columns {
+		names[i] = c.name
+	}
+	return e.w.Write(names)
+}
+
+func (e *CSVEncoder) write(rows []row) error {
+	if err := e.header(); err != nil {
+		return err
+	}
+
+	record := make([]string, len(e.columns))
+	for _, r := range rows {
+		for i, c := range e.columns {
+			record[i] = csvValue(c.value(r))
+		}
+		if err := e.w.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvValue formats a column's value as a CSV field
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case time.Time:
+		return formatTime(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// NDJSONEncoder writes each row as a JSON object on a line of its own, with its properties in column order
+type NDJSONEncoder struct {
+	w       io.Writer
+	columns []column
+}
+
+// NewNDJSONEncoder creates an encoder writing the named columns as newline delimited JSON, or every column
+// when none are given
+func NewNDJSONEncoder(w io.Writer, names []string) (*NDJSONEncoder, error) {
+	selected, err := selectColumns(names)
+	if err != nil {
+		return nil, err
+	}
+	return &NDJSONEncoder{w: w, columns: selected}, nil
+}
+
+// Lineup writes a line for each service on a lineup
+func (e *NDJSONEncoder) Lineup(lineup model.Lineup) error {
+	return e.write(lineupRows(lineup))
+}
+
+// Service writes a line for each location on a service
+func (e *NDJSONEncoder) Service(service model.Service) error {
+	return e.write(serviceRows(service))
+}
+
+// Flush does nothing, lines are written as they are encoded
+func (e *NDJSONEncoder) Flush() error {
+	return nil
+}
+
+func (e *NDJSONEncoder) write(rows []row) error {
+	var buf bytes.Buffer
+	for _, r := range rows {
+		buf.Reset()
+		buf.WriteByte('{')
+		for i, c := range e.columns {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+
+			value := c.value(r)
+			if t, ok := value.(time.Time); ok {
+				value = formatTime(t)
+			}
+			name, _ := json.Marshal(c.name)
+			data, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			buf.Write(name)
+			buf.WriteByte(':')
+			buf.Write(data)
+		}
+		buf.WriteString("}\n")
+
+		if _, err := e.w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
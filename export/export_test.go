@@ -0,0 +1,143 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+	"github.com/georgeprice/realtime-trains-golang/model/modeltest"
+)
+
+var lineup = model.Lineup{
+	Location: model.LocationDetailHeader{Name: "Bournemouth", CRS: "BMH"},
+	Services: []model.LocationContainer{
+		{
+			ServiceUID: "S1",
+			RunDate:    "2020-06-12",
+			ATOCCode:   "SW",
+			ATOCName:   "South Western Railway",
+			LocationDetail: model.LocationDetail{
+				CRS:                           "BMH",
+				GBTTBookedDeparture:           "2350",
+				RealTimeDeparture:             "0003",
+				RealTimeDepartureNextDay:      true,
+				RealTimeGBTTDepartureLateness: 13,
+				Platform:                      "3",
+				Destination:                   []model.Pair{{TIPLOC: "WATRLMN", Description: "London Waterloo"}},
+			},
+		},
+		{
+			ServiceUID:    "S2",
+			RunDate:       "2020-06-12",
+			ATOCCode:      "XC",
+			PlannedCancel: true,
+			LocationDetail: model.LocationDetail{
+				CRS:                 "BMH",
+				GBTTBookedDeparture: "0800",
+				Destination:         []model.Pair{{TIPLOC: "MNCRPIC"}},
+			},
+		},
+	},
+}
+
+func TestCSV(t *testing.T) {
+
+	var buf bytes.Buffer
+	e, err := NewCSVEncoder(&buf, []string{"station", "uid", "destination", "booked_departure", "realtime_departure", "departure_lateness", "Cancelled"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Lineup(lineup); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		"station,uid,destination,booked_departure,realtime_departure,departure_lateness,cancelled",
+		"BMH,S1,London Waterloo,2020-06-12T23:50:00+01:00,2020-06-13T00:03:00+01:00,13,false",
+		"BMH,S2,MNCRPIC,2020-06-12T08:00:00+01:00,,,true",
+	}, "\n") + "\n"
+	if buf.String() != expected {
+		t.Errorf("Got wrong CSV, got\n%s\nexpected\n%s", buf.String(), expected)
+	}
+
+	t.Run("service", func(t *testing.T) {
+		service := modeltest.Service("S3",
+			modeltest.Call{CRS: "BMH", Departure: "0800", RealDeparture: "0801", Actual: true},
+			modeltest.Stop("WAT", "0930", ""))
+		service.ATOCCode = "SW"
+
+		var buf bytes.Buffer
+		e, err := NewCSVEncoder(&buf, []string{"index", "uid", "operator", "crs", "realtime_departure_actual"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Service(service); err != nil {
+			t.Fatal(err)
+		}
+		e.Flush()
+
+		expected := "index,uid,operator,crs,realtime_departure_actual\n0,S3,SW,BMH,true\n1,S3,SW,WAT,false\n"
+		if buf.String() != expected {
+			t.Errorf("Got wrong CSV, got\n%s\nexpected\n%s", buf.String(), expected)
+		}
+	})
+
+	t.Run("header", func(t *testing.T) {
+		var buf bytes.Buffer
+		e, err := NewCSVEncoder(&buf, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e.Flush()
+		if expected := strings.Join(Columns(), ",") + "\n"; buf.String() != expected {
+			t.Errorf("Got wrong header, got %q, expected %q", buf.String(), expected)
+		}
+	})
+}
+
+func TestNDJSON(t *testing.T) {
+
+	var buf bytes.Buffer
+	e, err := NewEncoder("ndjson", &buf, []string{"uid", "platform", "realtime_departure", "departure_lateness", "planned_cancel"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Lineup(lineup); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"uid":"S1","platform":"3","realtime_departure":"2020-06-13T00:03:00+01:00","departure_lateness":13,"planned_cancel":false}
+{"uid":"S2","platform":"","realtime_departure":null,"departure_lateness":null,"planned_cancel":true}
+`
+	if buf.String() != expected {
+		t.Errorf("Got wrong NDJSON, got\n%s\nexpected\n%s", buf.String(), expected)
+	}
+
+	// every line is valid JSON, with every column when none are picked
+	buf.Reset()
+	e, _ = NewEncoder("ndjson", &buf, nil)
+	e.Lineup(lineup)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var row map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			t.Fatalf("Got invalid JSON %s, %v", line, err)
+		}
+		if len(row) != len(Columns()) {
+			t.Errorf("Got wrong number of columns, got %d, expected %d", len(row), len(Columns()))
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := NewEncoder("xml", &bytes.Buffer{}, nil); err == nil {
+		t.Error("Got nil error for an unknown format, expected error")
+	}
+	if _, err := NewEncoder("csv", &bytes.Buffer{}, []string{"uid", "colour"}); err == nil || !strings.Contains(err.Error(), "colour") {
+		t.Errorf("Got wrong error for an unknown column, got %v", err)
+	}
+}
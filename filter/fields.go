@@ -0,0 +1,128 @@
+package filter
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// fieldKind describes the type of value a field holds, which decides the operators it supports
+type fieldKind int
+
+const (
+	textField fieldKind = iota
+	flagField
+	durationField
+)
+
+func (k fieldKind) String() string {
+	switch k {
+	case flagField:
+		return "flag"
+	case durationField:
+		return "duration"
+	default:
+		return "text"
+	}
+}
+
+// field is a property of a service on a lineup which can be used in a filter
+type field struct {
+	name string
+	kind fieldKind
+
+	// text fields can match any of several values, e.g. a destination's TIPLOC or its name
+	text func(model.LocationContainer) []string
+
+	flag func(model.LocationContainer) bool
+
+	// durations are in minutes, returning false when the service doesn't have one
+	duration func(model.LocationContainer) (float64, bool)
+}
+
+// pairText lists the TIPLOCs and descriptions of origins or destinations
+func pairText(pairs ...[]model.Pair) []string {
+	var text []string
+	for _, ps := range pairs {
+		for _, p := range ps {
+			text = append(text, p.TIPLOC, p.Description)
+		}
+	}
+	return text
+}
+
+// fields lists everything which can be filtered on, keyed by lower case name
+var fields = map[string]field{
+	"operator": {kind: textField, text: func(c model.LocationContainer) []string {
+		return []string{c.ATOCCode, c.ATOCName}
+	}},
+	"platform": {kind: textField, text: func(c model.LocationContainer) []string {
+		return []string{c.Platform}
+	}},
+	"type": {kind: textField, text: func(c model.LocationContainer) []string {
+		return []string{c.ServiceType}
+	}},
+	"uid": {kind: textField, text: func(c model.LocationContainer) []string {
+		return []string{c.ServiceUID}
+	}},
+	"headcode": {kind: textField, text: func(c model.LocationContainer) []string {
+		return []string{c.TrainIdentity, c.RunningIdentity}
+	}},
+	"origin": {kind: textField, text: func(c model.LocationContainer) []string {
+		return pairText(c.LocationDetail.Origin, c.Origin)
+	}},
+	"destination": {kind: textField, text: func(c model.LocationContainer) []string {
+		return pairText(c.LocationDetail.Destination, c.Destination)
+	}},
+	"cancelled": {kind: flagField, flag: model.LocationContainer.Cancelled},
+	"passenger": {kind: flagField, flag: func(c model.LocationContainer) bool {
+		return c.IsPassenger
+	}},
+	"platformchanged": {kind: flagField, flag: func(c model.LocationContainer) bool {
+		return c.PlatformChanged
+	}},
+	"platformconfirmed": {kind: flagField, flag: func(c model.LocationContainer) bool {
+		return c.PlatformConfirmed
+	}},
+	"call": {kind: flagField, flag: func(c model.LocationContainer) bool {
+		return c.IsCallPublic
+	}},
+	"pass": {kind: flagField, flag: func(c model.LocationContainer) bool {
+		return c.DisplayAs == "PASS" || c.WTTBookedPass != ""
+	}},
+	"delay": {kind: durationField, duration: func(c model.LocationContainer) (float64, bool) {
+		if !c.HasRealtime() {
+			return 0, false
+		}
+		booked, err := c.BookedTime()
+		if err != nil {
+			return 0, false
+		}
+		realtime, err := c.RealtimeTime()
+		if err != nil {
+			return 0, false
+		}
+		return realtime.Sub(booked).Minutes(), true
+	}},
+	"countdown": {kind: durationField, duration: func(c model.LocationContainer) (float64, bool) {
+		return float64(c.CountdownMinutes), true
+	}},
+}
+
+// fieldNames lists the names of all fields, for error messages
+func fieldNames() string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// lookupField finds a field by name, ignoring case
+func lookupField(name string) (field, bool) {
+	f, ok := fields[strings.ToLower(name)]
+	f.name = strings.ToLower(name)
+	return f, ok
+}
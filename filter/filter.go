@@ -0,0 +1,169 @@
+// Package filter parses and evaluates text filters over the services on a lineup,
+// e.g. `operator=SW platform in (3,4) delay>5m !cancelled`
+package filter
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// QueryParameter is the URL query parameter HTTP handlers read filters from
+const QueryParameter = "filter"
+
+// Expression is a parsed filter, matching services on a lineup
+type Expression interface {
+	Match(model.LocationContainer) bool
+	String() string
+}
+
+// SyntaxError describes why a filter couldn't be parsed, and where
+type SyntaxError struct {
+	Input string
+	Pos   int
+	Msg   string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("filter: %s at column %d of %q", e.Msg, e.Pos+1, e.Input)
+}
+
+// All is the expression for an empty filter, matching every service
+var All Expression = all{}
+
+type all struct{}
+
+func (all) Match(model.LocationContainer) bool { return true }
+func (all) String() string                     { return "" }
+
+// Apply returns a new lineup with only the services matching the expression
+func Apply(e Expression, lineup model.Lineup) model.Lineup {
+	return lineup.Where(e.Match)
+}
+
+// FromQuery parses the filter given in a URL query, matching everything when there isn't one
+func FromQuery(values url.Values) (Expression, error) {
+	return Parse(values.Get(QueryParameter))
+}
+
+type and struct{ left, right Expression }
+
+func (e and) Match(c model.LocationContainer) bool { return e.left.Match(c) && e.right.Match(c) }
+func (e and) String() string                       { return "(" + e.left.String() + " and " + e.right.String() + ")" }
+
+type or struct{ left, right Expression }
+
+func (e or) Match(c model.LocationContainer) bool { return e.left.Match(c) || e.right.Match(c) }
+func (e or) String() string                       { return "(" + e.left.String() + " or " + e.right.String() + ")" }
+
+type not struct{ expr Expression }
+
+func (e not) Match(c model.LocationContainer) bool { return !e.expr.Match(c) }
+func (e not) String() string                       { return "!" + e.expr.String() }
+
+// flag matches services where a flag field is set
+type flag struct{ field field }
+
+func (e flag) Match(c model.LocationContainer) bool { return e.field.flag(c) }
+func (e flag) String() string                       { return e.field.name }
+
+// text compares a text field to one or more values, ignoring case
+type text struct {
+	field  field
+	op     string
+	values []string
+}
+
+func (e text) Match(c model.LocationContainer) bool {
+
+	// a field matches when any of its values matches any of the given values
+	matched := false
+	for _, got := range e.field.text(c) {
+		if got == "" {
+			continue
+		}
+		for _, value := range e.values {
+			switch e.op {
+			case "~":
+				matched = strings.Contains(strings.ToLower(got), strings.ToLower(value))
+			default:
+				matched = strings.EqualFold(got, value)
+			}
+			if matched {
+				break
+			}
+		}
+		if matched {
+			break
+		}
+	}
+
+	if e.op == "!=" {
+		return !matched
+	}
+	return matched
+}
+
+func (e text) String() string {
+	return compareString(e.field.name, e.op, e.values, strconv.Quote)
+}
+
+// duration compares a duration field, in minutes, to one or more values
+type duration struct {
+	field  field
+	op     string
+	values []float64
+}
+
+func (e duration) Match(c model.LocationContainer) bool {
+
+	// services without the field never match, whatever the comparison
+	got, ok := e.field.duration(c)
+	if !ok {
+		return false
+	}
+
+	switch e.op {
+	case "in", "=":
+		for _, value := range e.values {
+			if got == value {
+				return true
+			}
+		}
+		return false
+	case "!=":
+		return got != e.values[0]
+	case "<":
+		return got < e.values[0]
+	case "<=":
+		return got <= e.values[0]
+	case ">":
+		return got > e.values[0]
+	case ">=":
+		return got >= e.values[0]
+	}
+	return false
+}
+
+func (e duration) String() string {
+	values := make([]string, len(e.values))
+	for i, value := range e.values {
+		values[i] = strconv.FormatFloat(value, 'f', -1, 64) + "m"
+	}
+	return compareString(e.field.name, e.op, values, func(s string) string { return s })
+}
+
+// compareString renders a comparison, listing the values for in
+func compareString(name, op string, values []string, format func(string) string) string {
+	formatted := make([]string, len(values))
+	for i, value := range values {
+		formatted[i] = format(value)
+	}
+	if op == "in" {
+		return name + " in (" + strings.Join(formatted, ", ") + ")"
+	}
+	return name + op + formatted[0]
+}
@@ -0,0 +1,166 @@
+package filter
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+var lineup = model.Lineup{
+	Services: []model.LocationContainer{
+		{
+			ServiceUID: "A", RunDate: "2020-02-12", ATOCCode: "SW", ATOCName: "South Western Railway",
+			ServiceType: "train", IsPassenger: true,
+			LocationDetail: model.LocationDetail{
+				RealTimeActivated:   true,
+				GBTTBookedDeparture: "0118",
+				RealTimeDeparture:   "0126",
+				Platform:            "3",
+				PlatformChanged:     true,
+				Destination:         []model.Pair{{TIPLOC: "POOLE", Description: "Poole"}},
+			},
+		},
+		{
+			ServiceUID: "B", RunDate: "2020-02-12", ATOCCode: "XC", ATOCName: "CrossCountry",
+			ServiceType: "train", IsPassenger: true,
+			LocationDetail: model.LocationDetail{
+				RealTimeActivated:   true,
+				GBTTBookedDeparture: "0120",
+				RealTimeDeparture:   "0121",
+				Platform:            "4",
+				Destination:         []model.Pair{{TIPLOC: "MNCRPIC", Description: "Manchester Piccadilly"}},
+			},
+		},
+		{
+			ServiceUID: "C", RunDate: "2020-02-12", ATOCCode: "SW", ATOCName: "South Western Railway",
+			ServiceType: "bus", IsPassenger: true, PlannedCancel: true,
+			LocationDetail: model.LocationDetail{
+				GBTTBookedDeparture: "0130",
+				Destination:         []model.Pair{{TIPLOC: "POOLE", Description: "Poole"}},
+			},
+		},
+		{
+			ServiceUID: "D", RunDate: "2020-02-12", ATOCCode: "SW",
+			ServiceType: "train",
+			LocationDetail: model.LocationDetail{
+				WTTBookedPass: "013000",
+				Platform:      "4",
+				DisplayAs:     "PASS",
+			},
+		},
+	},
+}
+
+// matches lists the UIDs of services matching a filter
+func matches(e Expression) string {
+	var s string
+	for _, service := range Apply(e, lineup).Services {
+		s += service.ServiceUID
+	}
+	return s
+}
+
+func TestParse(t *testing.T) {
+
+	ts := []struct {
+		filter   string
+		expected string
+	}{
+		{"", "ABCD"},
+		{"operator=SW", "ACD"},
+		{"operator == sw", "ACD"},
+		{"operator != SW", "B"},
+		{"operator~western", "AC"},
+		{"platform in (3,4)", "ABD"},
+		{"platform IN ( 3 , 4 )", "ABD"},
+		{"delay>5m", "A"},
+		{"delay<=1", "B"},
+		{"delay in (0, 1m)", "B"},
+		{"delay>=90s", "A"},
+		{"!cancelled", "ABD"},
+		{"not cancelled", "ABD"},
+		{"cancelled=false", "ABD"},
+		{"cancelled != false", "C"},
+		{"passenger && !pass", "ABC"},
+		{"platformChanged", "A"},
+		{"destination=Poole", "AC"},
+		{"destination='Manchester Piccadilly'", "B"},
+		{`destination="MNCRPIC"`, "B"},
+		{"type=bus or platform=3", "AC"},
+		{"operator=SW and (platform=3 or cancelled)", "AC"},
+		{"operator=SW platform in (3,4) delay>5m !cancelled", "A"},
+		{"!(operator=SW || platform=4)", ""},
+	}
+
+	for _, tc := range ts {
+		e, err := Parse(tc.filter)
+		if err != nil {
+			t.Errorf("Got error parsing %q, got %s", tc.filter, err.Error())
+			continue
+		}
+		if got := matches(e); got != tc.expected {
+			t.Errorf("Got wrong services for %q (parsed as %s), got %q, expected %q", tc.filter, e, got, tc.expected)
+		}
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+
+	ts := []struct {
+		filter   string
+		pos      int
+		contains string
+	}{
+		{"operater=SW", 0, "unknown field 'operater'"},
+		{"operator>SW", 8, "expected one of"},
+		{"delay>", 6, "expected a value after '>'"},
+		{"delay>soon", 6, "expected a duration"},
+		{"platform in 3", 12, "expected '('"},
+		{"platform in (3,4", 16, "expected ',' or ')'"},
+		{"(operator=SW", 12, "expected ')' to close '(' at column 1"},
+		{"operator=SW)", 11, "unexpected ')'"},
+		{"destination='Poole", 12, "unterminated string"},
+		{"cancelled=maybe", 10, "expected true or false"},
+		{"platform=3 or", 13, "expected a field name, got end of filter"},
+		{"platform=3 $", 11, "unexpected character '$'"},
+	}
+
+	for _, tc := range ts {
+		_, err := Parse(tc.filter)
+		syntaxErr, ok := err.(*SyntaxError)
+		switch {
+		case !ok:
+			t.Errorf("Got wrong error for %q, got %v, expected syntax error", tc.filter, err)
+		case syntaxErr.Pos != tc.pos:
+			t.Errorf("Got wrong position for %q, got %d, expected %d (%s)", tc.filter, syntaxErr.Pos, tc.pos, err)
+		case !strings.Contains(err.Error(), tc.contains):
+			t.Errorf("Got wrong message for %q, got %q, expected it to contain %q", tc.filter, err, tc.contains)
+		}
+	}
+}
+
+func TestFromQuery(t *testing.T) {
+
+	values, err := url.ParseQuery("filter=platform+in+(3,4)+!cancelled")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := FromQuery(values)
+	switch {
+	case err != nil:
+		t.Fatal(err)
+	case matches(e) != "ABD":
+		t.Errorf("Got wrong services, got %q, expected %q", matches(e), "ABD")
+	}
+
+	e, err = FromQuery(url.Values{})
+	switch {
+	case err != nil:
+		t.Fatal(err)
+	case e != All:
+		t.Errorf("Got wrong expression for missing filter, got %s", e)
+	}
+}
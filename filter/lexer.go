@@ -0,0 +1,108 @@
+package filter
+
+import (
+	"strings"
+	"unicode"
+)
+
+// tokenKind describes what sort of text a token holds
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenWord
+	tokenString
+	tokenSymbol
+)
+
+// token is a single piece of an expression, with its position for error reporting
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEnd:
+		return "end of filter"
+	case tokenString:
+		return "\"" + t.text + "\""
+	default:
+		return "'" + t.text + "'"
+	}
+}
+
+// is checks whether the token is the given symbol or keyword, keywords ignore case
+func (t token) is(text string) bool {
+	switch t.kind {
+	case tokenSymbol:
+		return t.text == text
+	case tokenWord:
+		return strings.EqualFold(t.text, text)
+	}
+	return false
+}
+
+// symbols lists the operators and punctuation of the language, longest first so they match greedily
+var symbols = []string{"&&", "||", "==", "!=", "<=", ">=", "(", ")", ",", "!", "=", "<", ">", "~"}
+
+// isWordRune checks whether r can be part of a bare word, e.g. operator, 5m, 2N or -3
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.:+-", r)
+}
+
+// lex splits an expression into tokens, finishing with an end token
+func lex(input string) ([]token, error) {
+
+	var (
+		tokens []token
+		runes  = []rune(input)
+	)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+
+		// whitespace separates tokens but is otherwise ignored
+		case unicode.IsSpace(r):
+			i++
+
+		// quoted strings allow spaces and symbols within values
+		case r == '"' || r == '\'':
+			start := i
+			i++
+			for i < len(runes) && runes[i] != r {
+				i++
+			}
+			if i == len(runes) {
+				return nil, &SyntaxError{Input: input, Pos: start, Msg: "unterminated string"}
+			}
+			tokens = append(tokens, token{kind: tokenString, text: string(runes[start+1 : i]), pos: start})
+			i++
+
+		case isWordRune(r):
+			start := i
+			for i < len(runes) && isWordRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, text: string(runes[start:i]), pos: start})
+
+		default:
+			matched := false
+			for _, symbol := range symbols {
+				if strings.HasPrefix(string(runes[i:]), symbol) {
+					tokens = append(tokens, token{kind: tokenSymbol, text: symbol, pos: i})
+					i += len([]rune(symbol))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, &SyntaxError{Input: input, Pos: i, Msg: "unexpected character '" + string(r) + "'"}
+			}
+		}
+	}
+
+	return append(tokens, token{kind: tokenEnd, pos: len(runes)}), nil
+}
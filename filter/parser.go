@@ -0,0 +1,264 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parser walks through the tokens of an expression, building it up by precedence: or, and, then not
+type parser struct {
+	input  string
+	tokens []token
+	next   int
+}
+
+// Parse reads a filter expression. Terms separated by spaces must all match, or can be joined with
+// "or", grouped with brackets and negated with "!". An empty filter matches everything
+func Parse(input string) (Expression, error) {
+
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	if tokens[0].kind == tokenEnd {
+		return All, nil
+	}
+
+	p := &parser{input: input, tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	// anything left over means brackets don't line up or an operator is missing
+	if t := p.peek(); t.kind != tokenEnd {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+	return expr, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEnd {
+		p.next++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return &SyntaxError{Input: p.input, Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) parseOr() (Expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().is("or") || p.peek().is("||") {
+		p.take()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = or{left, right}
+	}
+	return left, nil
+}
+
+// startsTerm checks whether a token can begin a term, allowing "and" to be left out between terms
+func startsTerm(t token) bool {
+	switch {
+	case t.is("or"), t.is("and"), t.is("in"):
+		return false
+	case t.kind == tokenWord:
+		return true
+	}
+	return t.is("!") || t.is("(")
+}
+
+func (p *parser) parseAnd() (Expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		switch t := p.peek(); {
+		case t.is("and") || t.is("&&"):
+			p.take()
+		case startsTerm(t):
+		default:
+			return left, nil
+		}
+
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = and{left, right}
+	}
+}
+
+func (p *parser) parseUnary() (Expression, error) {
+	t := p.take()
+	switch {
+	case t.is("!") || t.is("not"):
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return not{expr}, nil
+
+	case t.is("("):
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.take(); !closing.is(")") {
+			return nil, p.errorf(closing, "expected ')' to close '(' at column %d, got %s", t.pos+1, closing)
+		}
+		return expr, nil
+
+	case t.kind == tokenWord:
+		return p.parseComparison(t)
+	}
+	return nil, p.errorf(t, "expected a field name, got %s", t)
+}
+
+// operators lists the comparisons each kind of field supports, besides in
+var operators = map[fieldKind][]string{
+	textField:     {"=", "==", "!=", "~"},
+	flagField:     {"=", "==", "!="},
+	durationField: {"=", "==", "!=", "<", "<=", ">", ">="},
+}
+
+func (p *parser) parseComparison(name token) (Expression, error) {
+
+	f, ok := lookupField(name.text)
+	if !ok {
+		return nil, p.errorf(name, "unknown field %s, expected one of %s", name, fieldNames())
+	}
+
+	// flags can be used on their own, e.g. cancelled
+	op := p.peek()
+	if f.kind == flagField && !(op.kind == tokenSymbol && contains(operators[flagField], op.text)) {
+		return flag{f}, nil
+	}
+
+	var values []token
+	switch {
+	case op.is("in") && f.kind != flagField:
+		p.take()
+		list, err := p.parseList(op)
+		if err != nil {
+			return nil, err
+		}
+		values = list
+
+	case op.kind == tokenSymbol && contains(operators[f.kind], op.text):
+		p.take()
+		value := p.take()
+		if value.kind != tokenWord && value.kind != tokenString {
+			return nil, p.errorf(value, "expected a value after %s, got %s", op, value)
+		}
+		values = []token{value}
+
+	default:
+		return nil, p.errorf(op, "expected one of %s after %s field %s, got %s",
+			strings.Join(append(operators[f.kind], "in"), " "), f.kind, name, op)
+	}
+
+	// == is the same as =, and in just checks for equality with any of a list
+	opText := op.text
+	switch {
+	case opText == "==":
+		opText = "="
+	case op.is("in"):
+		opText = "in"
+	}
+
+	return p.buildComparison(f, opText, values)
+}
+
+// parseList reads a bracketed, comma separated list of values following in
+func (p *parser) parseList(in token) ([]token, error) {
+
+	if open := p.take(); !open.is("(") {
+		return nil, p.errorf(open, "expected '(' after %s, got %s", in, open)
+	}
+
+	var values []token
+	for {
+		value := p.take()
+		if value.kind != tokenWord && value.kind != tokenString {
+			return nil, p.errorf(value, "expected a value in list, got %s", value)
+		}
+		values = append(values, value)
+
+		switch next := p.take(); {
+		case next.is(")"):
+			return values, nil
+		case !next.is(","):
+			return nil, p.errorf(next, "expected ',' or ')' in list, got %s", next)
+		}
+	}
+}
+
+// buildComparison checks the values suit the field, converting them to the field's type
+func (p *parser) buildComparison(f field, op string, values []token) (Expression, error) {
+	switch f.kind {
+
+	case flagField:
+		set, err := strconv.ParseBool(values[0].text)
+		if err != nil {
+			return nil, p.errorf(values[0], "expected true or false for %s, got %s", f.name, values[0])
+		}
+		var expr Expression = flag{f}
+		if set == (op == "!=") {
+			expr = not{expr}
+		}
+		return expr, nil
+
+	case durationField:
+		minutes := make([]float64, len(values))
+		for i, value := range values {
+			m, err := parseMinutes(value.text)
+			if err != nil {
+				return nil, p.errorf(value, "expected a duration like 5m or 1h30m for %s, got %s", f.name, value)
+			}
+			minutes[i] = m
+		}
+		return duration{field: f, op: op, values: minutes}, nil
+	}
+
+	text := text{field: f, op: op}
+	for _, value := range values {
+		text.values = append(text.values, value.text)
+	}
+	return text, nil
+}
+
+// parseMinutes reads a duration as minutes, plain numbers are already in minutes
+func parseMinutes(s string) (float64, error) {
+	if minutes, err := strconv.ParseFloat(s, 64); err == nil {
+		return minutes, nil
+	}
+	d, err := time.ParseDuration(s)
+	return d.Minutes(), err
+}
+
+func contains(options []string, s string) bool {
+	for _, option := range options {
+		if option == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+// Package geo maps services and lineups as GeoJSON, using a gazetteer of coordinates for TIPLOC and CRS codes.
+// A gazetteer of major stations is built in, which can be added to or replaced by a complete one loaded from a file
+package geo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// Coordinate is a WGS 84 position in degrees
+type Coordinate struct {
+	Lat, Lon float64
+}
+
+// point returns the coordinate in GeoJSON's longitude, latitude order
+func (c Coordinate) point() []float64 {
+	return []float64{c.Lon, c.Lat}
+}
+
+// Place is a location in a gazetteer
+type Place struct {
+	CRS, TIPLOC, Name string
+	Coordinate
+}
+
+// Gazetteer finds places by their TIPLOC or CRS codes, in upper case
+type Gazetteer map[string]Place
+
+// Stations is the built in gazetteer of major stations, keyed by both CRS code and TIPLOC. It only has
+// a few dozen stations, Load a complete one for maps of anything beyond the main lines
+var Stations = parseGazetteer(stationData)
+
+// parseGazetteer reads the built in gazetteer
+func parseGazetteer(data string) Gazetteer {
+	g, err := Load(strings.NewReader(data))
+	if err != nil {
+		panic("geo: " + err.Error())
+	}
+	return g
+}
+
+// Load reads a gazetteer from CSV lines of CRS code, TIPLOC, latitude, longitude and name, e.g.
+//
+//	BCU,BRKNHRST,50.8165,-1.5736,Brockenhurst
+//
+// Either code can be left empty. Blank lines, lines starting with # and a header line are skipped
+func Load(r io.Reader) (Gazetteer, error) {
+	g := make(Gazetteer)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(text, ",", 5)
+		if len(parts) != 5 {
+			return nil, fmt.Errorf("line %d: expected CRS, TIPLOC, latitude, longitude and name", line)
+		}
+		lat, err := strconv.ParseFloat(strings.TrimSpace(parts[2]), 64)
+		if err != nil && line == 1 {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad latitude %q", line, parts[2])
+		}
+		lon, err := strconv.ParseFloat(strings.TrimSpace(parts[3]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad longitude %q", line, parts[3])
+		}
+
+		g.Add(Place{
+			CRS:        strings.TrimSpace(parts[0]),
+			TIPLOC:     strings.TrimSpace(parts[1]),
+			Name:       strings.TrimSpace(parts[4]),
+			Coordinate: Coordinate{lat, lon},
+		})
+	}
+	return g, scanner.Err()
+}
+
+// LoadFile reads a gazetteer from a file, see Load
+func LoadFile(path string) (Gazetteer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Add puts a place in the gazetteer under its CRS code and TIPLOC, replacing any already there
+func (g Gazetteer) Add(p Place) {
+	for _, code := range []string{p.CRS, p.TIPLOC} {
+		if code != "" {
+			g[strings.ToUpper(code)] = p
+		}
+	}
+}
+
+// Lookup finds a place by a TIPLOC or CRS code
+func (g Gazetteer) Lookup(code string) (Place, bool) {
+	p, ok := g[strings.ToUpper(code)]
+	return p, ok && code != ""
+}
+
+// locate finds a location on a service, by its TIPLOC then its CRS code
+func (g Gazetteer) locate(d model.LocationDetail) (Place, bool) {
+	if p, ok := g.Lookup(d.TIPLOC); ok {
+		return p, true
+	}
+	return g.Lookup(d.CRS)
+}
@@ -0,0 +1,165 @@
+package geo
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+	"github.com/georgeprice/realtime-trains-golang/model/modeltest"
+)
+
+func TestGazetteer(t *testing.T) {
+	for _, code := range []string{"BMH", "bomo", "WATRLMN"} {
+		if _, ok := Stations.Lookup(code); !ok {
+			t.Errorf("Got %s missing from the built in gazetteer", code)
+		}
+	}
+	if bmh, _ := Stations.Lookup("BMH"); bmh.TIPLOC != "BOMO" || bmh.Lat < 50 || bmh.Lat > 51 || bmh.Lon > -1 {
+		t.Errorf("Got wrong place for BMH, got %+v", bmh)
+	}
+	if _, ok := Stations.Lookup(""); ok {
+		t.Error("Got a place for an empty code")
+	}
+
+	g := make(Gazetteer)
+	g.Add(Place{CRS: "brk", TIPLOC: "BRKNHRST", Coordinate: Coordinate{50.8164, -1.5737}})
+	if p, ok := g.Lookup("BRK"); !ok || p.TIPLOC != "BRKNHRST" {
+		t.Errorf("Got wrong place added, got %+v", p)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	g, err := Load(strings.NewReader(`crs,tiploc,lat,lon,name
+# stations on the New Forest line
+BCU, BRKNHRST, 50.8165, -1.5736, Brockenhurst
+
+,LYMNTH,50.7585,-1.5379,Lymington Town, a halt`))
+	switch {
+	case err != nil:
+		t.Fatal(err)
+	case len(g) != 3:
+		t.Errorf("Got wrong number of codes, got %d, expected 3", len(g))
+	}
+	if p, ok := g.Lookup("brknhrst"); !ok || p.CRS != "BCU" || p.Name != "Brockenhurst" || p.Lat != 50.8165 {
+		t.Errorf("Got wrong place for BRKNHRST, got %+v", p)
+	}
+	if p, ok := g.Lookup("LYMNTH"); !ok || p.Name != "Lymington Town, a halt" {
+		t.Errorf("Got wrong place for LYMNTH, got %+v", p)
+	}
+
+	ts := []struct {
+		data     string
+		expected string
+	}{
+		{"BCU,BRKNHRST,50.8", "line 1: expected CRS, TIPLOC, latitude, longitude and name"},
+		{"BMH,BOMO,50.7,-1.8,Bournemouth\nBCU,BRKNHRST,north,-1.5,Brockenhurst", `line 2: bad latitude "north"`},
+		{"BCU,BRKNHRST,50.8,west,Brockenhurst", `line 1: bad longitude "west"`},
+	}
+	for _, tc := range ts {
+		if _, err := Load(strings.NewReader(tc.data)); err == nil || err.Error() != tc.expected {
+			t.Errorf("Got wrong error, got %v, expected %s", err, tc.expected)
+		}
+	}
+}
+
+func TestRoute(t *testing.T) {
+
+	service := modeltest.Service("W12345",
+		modeltest.Call{CRS: "BMH", Departure: "0800", RealDeparture: "0801", Actual: true},
+		modeltest.Stop("BRK", "0810", "0811"),
+		modeltest.Call{CRS: "SOU", Arrival: "0830", Departure: "0832", Cancelled: true},
+		modeltest.Stop("WAT", "0930", ""))
+	service.Locations[0].Platform = "3"
+	service.Locations = append(service.Locations[:3], model.LocationDetail{
+		TIPLOC: "WINCHST", WTTBookedPass: "0845", RealTimePass: "0847",
+	}, service.Locations[3])
+
+	collection := Stations.Route(service)
+	if collection.Type != "FeatureCollection" || len(collection.Features) != 5 {
+		t.Fatalf("Got wrong features, got %+v", collection)
+	}
+
+	line := collection.Features[0]
+	bmh, _ := Stations.Lookup("BMH")
+	switch {
+	case line.Geometry.Type != "LineString":
+		t.Errorf("Got wrong geometry, got %s", line.Geometry.Type)
+	case len(line.Geometry.Coordinates.([][]float64)) != 4:
+		t.Errorf("Got wrong line, got %v", line.Geometry.Coordinates)
+	case !reflect.DeepEqual(line.Geometry.Coordinates.([][]float64)[0], []float64{bmh.Lon, bmh.Lat}):
+		t.Errorf("Got wrong start of line, got %v", line.Geometry.Coordinates.([][]float64)[0])
+	case line.Properties["serviceUid"] != "W12345":
+		t.Errorf("Got wrong line properties, got %v", line.Properties)
+	}
+
+	ts := []struct {
+		feature  int
+		property string
+		expected interface{}
+	}{
+		{1, "crs", "BMH"},
+		{1, "name", "Bournemouth"},
+		{1, "status", "call"},
+		{1, "platform", "3"},
+		{1, "realtimeDeparture", "2020-02-12T08:01:00Z"},
+		{1, "realtimeDepartureActual", true},
+		{2, "index", 2},
+		{2, "status", "cancelled"},
+		{3, "status", "pass"},
+		{3, "publicCall", false},
+		{3, "realtimePass", "2020-02-12T08:47:00Z"},
+		{4, "bookedArrival", "2020-02-12T09:30:00Z"},
+		{4, "bookedDeparture", nil},
+	}
+	for _, tc := range ts {
+		if got := collection.Features[tc.feature].Properties[tc.property]; got != tc.expected {
+			t.Errorf("%d %s: Got wrong property, got %v, expected %v", tc.feature, tc.property, got, tc.expected)
+		}
+	}
+
+	data, err := json.Marshal(collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"geometry":{"type":"Point","coordinates":[-1.8645,50.7273]}`) {
+		t.Errorf("Got wrong GeoJSON, got %s", data)
+	}
+
+	// a single known location can't make a line
+	if features := Stations.Route(modeltest.Service("S", modeltest.Stop("BMH", "", "0800"))).Features; len(features) != 1 {
+		t.Errorf("Got wrong features for a single location, got %+v", features)
+	}
+}
+
+func TestDestinations(t *testing.T) {
+
+	entry := func(uid string, destinations ...model.Pair) model.LocationContainer {
+		return model.LocationContainer{ServiceUID: uid, LocationDetail: model.LocationDetail{Destination: destinations}}
+	}
+	lineup := model.Lineup{
+		Location: model.LocationDetailHeader{CRS: "BMH"},
+		Services: []model.LocationContainer{
+			entry("S1", model.Pair{TIPLOC: "WATRLMN", Description: "London Waterloo"}),
+			entry("S2", model.Pair{TIPLOC: "MNCRPIC"}),
+			entry("S3", model.Pair{TIPLOC: "WATRLMN", Description: "London Waterloo"}),
+			entry("S4", model.Pair{TIPLOC: "NOWHERE"}),
+		},
+	}
+
+	collection := Stations.Destinations(lineup)
+	if len(collection.Features) != 3 {
+		t.Fatalf("Got wrong features, got %+v", collection.Features)
+	}
+
+	station, waterloo, manchester := collection.Features[0].Properties, collection.Features[1].Properties, collection.Features[2].Properties
+	switch {
+	case station["role"] != "station" || station["crs"] != "BMH":
+		t.Errorf("Got wrong station, got %v", station)
+	case waterloo["name"] != "London Waterloo" || !reflect.DeepEqual(waterloo["services"], []string{"S1", "S3"}):
+		t.Errorf("Got wrong destination, got %v", waterloo)
+	case manchester["name"] != "Manchester Piccadilly" || manchester["crs"] != "MAN":
+		t.Errorf("Got wrong destination, got %v", manchester)
+	}
+}
@@ -0,0 +1,172 @@
+package geo
+
+import (
+	"strings"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// FeatureCollection is a GeoJSON feature collection, marshal it with encoding/json
+type FeatureCollection struct {
+	Type     string    `json:"type"`
+	Features []Feature `json:"features"`
+}
+
+// Feature is a GeoJSON feature
+type Feature struct {
+	Type       string                 `json:"type"`
+	Geometry   Geometry               `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Geometry is a GeoJSON Point, with a single position, or LineString, with a list of them
+type Geometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+func newCollection() FeatureCollection {
+	return FeatureCollection{Type: "FeatureCollection", Features: []Feature{}}
+}
+
+func pointFeature(c Coordinate, properties map[string]interface{}) Feature {
+	return Feature{Type: "Feature", Geometry: Geometry{Type: "Point", Coordinates: c.point()}, Properties: properties}
+}
+
+// status describes what a service does at a location
+func status(d model.LocationDetail) string {
+	switch {
+	case d.Cancelled():
+		return "cancelled"
+	case d.WTTBookedPass != "" || d.DisplayAs == "PASS" || !d.IsCall:
+		return "pass"
+	}
+	return "call"
+}
+
+// setTime adds a time to a feature's properties when RTT has one
+func setTime(properties map[string]interface{}, name string, parse func(string) (time.Time, error), runDate string) {
+	if t, err := parse(runDate); err == nil {
+		properties[name] = t.Format(time.RFC3339)
+	}
+}
+
+// Route maps a service as a LineString through every location the gazetteer knows, followed by a
+// Point for each of those locations with its times, platform and whether the service calls or passes.
+// Locations the gazetteer doesn't know are left out, so the line cuts straight across between the ones
+// it does; with the built in Stations most services are only drawn between major stations
+func (g Gazetteer) Route(service model.Service) FeatureCollection {
+	collection := newCollection()
+
+	var line [][]float64
+	var points []Feature
+	for i, location := range service.Locations {
+		place, ok := g.locate(location)
+		if !ok {
+			continue
+		}
+		line = append(line, place.point())
+
+		name := location.Description
+		if name == "" {
+			name = place.Name
+		}
+		properties := map[string]interface{}{
+			"index":      i,
+			"tiploc":     location.TIPLOC,
+			"crs":        location.CRS,
+			"name":       name,
+			"status":     status(location),
+			"publicCall": location.PublicCall(),
+		}
+		setTime(properties, "bookedArrival", location.BookedArrivalTime, service.RunDate)
+		setTime(properties, "bookedDeparture", location.BookedDepartureTime, service.RunDate)
+		setTime(properties, "bookedPass", location.BookedPassTime, service.RunDate)
+		setTime(properties, "realtimeArrival", location.RealtimeArrivalTime, service.RunDate)
+		setTime(properties, "realtimeDeparture", location.RealtimeDepartureTime, service.RunDate)
+		setTime(properties, "realtimePass", location.RealtimePassTime, service.RunDate)
+		if location.RealTimeArrival != "" {
+			properties["realtimeArrivalActual"] = location.RealTimeArrivalActual
+		}
+		if location.RealTimeDeparture != "" {
+			properties["realtimeDepartureActual"] = location.RealTimeDepartureActual
+		}
+		if location.Platform != "" {
+			properties["platform"] = location.Platform
+			properties["platformConfirmed"] = location.PlatformConfirmed
+			properties["platformChanged"] = location.PlatformChanged
+		}
+		points = append(points, pointFeature(place.Coordinate, properties))
+	}
+
+	// a line needs at least two positions
+	if len(line) >= 2 {
+		collection.Features = append(collection.Features, Feature{
+			Type:     "Feature",
+			Geometry: Geometry{Type: "LineString", Coordinates: line},
+			Properties: map[string]interface{}{
+				"serviceUid": service.ServiceUID,
+				"runDate":    service.RunDate,
+				"operator":   service.ATOCCode,
+			},
+		})
+	}
+	collection.Features = append(collection.Features, points...)
+	return collection
+}
+
+// Destinations maps where the services on a lineup are going, as a Point for the lineup's station followed
+// by one for each destination the gazetteer knows, listing the services heading there
+func (g Gazetteer) Destinations(lineup model.Lineup) FeatureCollection {
+	collection := newCollection()
+
+	for _, code := range []string{lineup.Location.TIPLOC, lineup.Location.CRS} {
+		if place, ok := g.Lookup(code); ok {
+			collection.Features = append(collection.Features, pointFeature(place.Coordinate, map[string]interface{}{
+				"role": "station",
+				"crs":  place.CRS,
+				"name": place.Name,
+			}))
+			break
+		}
+	}
+
+	// group the services by destination, in the order the destinations first appear
+	var order []string
+	services := make(map[string][]string)
+	names := make(map[string]string)
+	for _, entry := range lineup.Services {
+		destinations := entry.LocationDetail.Destination
+		if len(destinations) == 0 {
+			destinations = entry.Destination
+		}
+		for _, destination := range destinations {
+			tiploc := strings.ToUpper(destination.TIPLOC)
+			if _, ok := g.Lookup(tiploc); !ok {
+				continue
+			}
+			if _, ok := services[tiploc]; !ok {
+				order = append(order, tiploc)
+				names[tiploc] = destination.Description
+			}
+			services[tiploc] = append(services[tiploc], entry.ServiceUID)
+		}
+	}
+
+	for _, tiploc := range order {
+		place, _ := g.Lookup(tiploc)
+		name := names[tiploc]
+		if name == "" {
+			name = place.Name
+		}
+		collection.Features = append(collection.Features, pointFeature(place.Coordinate, map[string]interface{}{
+			"role":     "destination",
+			"tiploc":   tiploc,
+			"crs":      place.CRS,
+			"name":     name,
+			"services": services[tiploc],
+		}))
+	}
+	return collection
+}
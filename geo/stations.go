@@ -0,0 +1,40 @@
+package geo
+
+// stationData is the built in gazetteer, major stations by CRS code and TIPLOC with their latitude and longitude
+const stationData = `
+BHM,BHAMNWS,52.4778,-1.8989,Birmingham New Street
+BMH,BOMO,50.7273,-1.8645,Bournemouth
+BRI,BRSTLTM,51.4491,-2.5813,Bristol Temple Meads
+BSK,BSNGSTK,51.2685,-1.0873,Basingstoke
+BTN,BRGHTN,50.8290,-0.1412,Brighton
+CAR,CARLILE,54.8906,-2.9335,Carlisle
+CBG,CAMBDGE,52.1942,0.1374,Cambridge
+CDF,CRDFCEN,51.4760,-3.1792,Cardiff Central
+CLJ,CLPHMJC,51.4642,-0.1703,Clapham Junction
+CRE,CREWE,53.0891,-2.4329,Crewe
+DON,DONC,53.5220,-1.1398,Doncaster
+EDB,EDINBUR,55.9521,-3.1889,Edinburgh
+EUS,EUSTON,51.5282,-0.1337,London Euston
+GLC,GLGC,55.8590,-4.2581,Glasgow Central
+KGX,KNGX,51.5320,-0.1233,London Kings Cross
+LDS,LEEDS,53.7945,-1.5475,Leeds
+LIV,LVRPLSH,53.4074,-2.9779,Liverpool Lime Street
+LST,LIVST,51.5188,-0.0814,London Liverpool Street
+MAN,MNCRPIC,53.4774,-2.2309,Manchester Piccadilly
+NCL,NWCSTLE,54.9683,-1.6173,Newcastle
+NOT,NTNG,52.9470,-1.1462,Nottingham
+OXF,OXFD,51.7535,-1.2700,Oxford
+PAD,PADTON,51.5154,-0.1755,London Paddington
+PBO,PBRO,52.5750,-0.2502,Peterborough
+POO,POOLE,50.7194,-1.9834,Poole
+PRE,PRST,53.7555,-2.7077,Preston
+RDG,RDNGSTN,51.4586,-0.9719,Reading
+SAL,SLSBRY,51.0705,-1.8063,Salisbury
+SHF,SHEFFLD,53.3781,-1.4621,Sheffield
+SOU,SOTON,50.9075,-1.4138,Southampton Central
+VIC,VICTRIC,51.4952,-0.1441,London Victoria
+WAT,WATRLMN,51.5031,-0.1132,London Waterloo
+WIN,WINCHST,51.0672,-1.3198,Winchester
+WOK,WOKING,51.3185,-0.5569,Woking
+YRK,YORK,53.9580,-1.0931,York
+`
@@ -0,0 +1,159 @@
+package gtfsrt
+
+import (
+	"strings"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// Converter turns RTT services into trip updates, its zero value uses CRS codes as stop_ids and UIDs as trip_ids
+type Converter struct {
+
+	// Stops maps TIPLOC or CRS codes to GTFS stop_ids, trying the TIPLOC first. Locations which
+	// aren't in it use their CRS code, or their TIPLOC when they don't have one
+	Stops map[string]string
+
+	// OnlyMapped leaves out locations which aren't in Stops
+	OnlyMapped bool
+
+	// TripID names the GTFS trip for a service, defaults to its UID
+	TripID func(model.Service) string
+}
+
+// stopID looks up the stop_id for a location, reporting false when it should be left out
+func (c Converter) stopID(location model.LocationDetail) (string, bool) {
+	for _, code := range []string{location.TIPLOC, location.CRS} {
+		if id, ok := c.Stops[code]; ok && code != "" {
+			return id, true
+		}
+	}
+	if c.OnlyMapped {
+		return "", false
+	}
+
+	if location.CRS != "" {
+		return location.CRS, true
+	}
+	return location.TIPLOC, location.TIPLOC != ""
+}
+
+func (c Converter) tripID(service model.Service) string {
+	if c.TripID != nil {
+		return c.TripID(service)
+	}
+	return service.ServiceUID
+}
+
+// event builds a stop time event from a realtime time, with its delay against the booked time. RTT's
+// lateness in minutes is used when there's no booked time, e.g. at non-passenger calls
+func event(realtime, booked func(string) (time.Time, error), lateness int, runDate string) *StopTimeEvent {
+	t, err := realtime(runDate)
+	if err != nil {
+		return nil
+	}
+
+	e := &StopTimeEvent{Time: t.Unix(), Delay: int32(lateness * 60)}
+	if b, err := booked(runDate); err == nil {
+		e.Delay = int32(t.Sub(b).Seconds())
+	}
+	return e
+}
+
+// TripUpdate converts a service into a trip update with a stop time update for each public call. Calls
+// cancelled at a location are skipped, and a service cancelled in the timetable or at every call is cancelled
+func (c Converter) TripUpdate(service model.Service, now time.Time) TripUpdate {
+
+	update := TripUpdate{
+		Trip: TripDescriptor{
+			TripID:    c.tripID(service),
+			StartDate: strings.Replace(service.RunDate, "-", "", -1),
+		},
+		Timestamp: uint64(now.Unix()),
+	}
+	label := service.RunningIdentity
+	if label == "" {
+		label = service.TrainIdentity
+	}
+	if label != "" {
+		update.Vehicle = &VehicleDescriptor{Label: label}
+	}
+
+	if len(service.Locations) > 0 {
+		origin := service.Locations[0]
+		start, err := origin.BookedDepartureTime(service.RunDate)
+		if err != nil {
+			start, err = origin.WorkingDepartureTime(service.RunDate)
+		}
+		if err == nil {
+			update.Trip.StartTime = start.Format("15:04:05")
+		}
+	}
+
+	calls, cancelled := 0, 0
+	for _, location := range service.Locations {
+		if !location.PublicCall() {
+			continue
+		}
+		calls++
+
+		id, ok := c.stopID(location)
+		if !ok {
+			if location.Cancelled() {
+				cancelled++
+			}
+			continue
+		}
+
+		stop := StopTimeUpdate{StopSequence: uint32(calls), StopID: id}
+		switch {
+		case location.Cancelled():
+			cancelled++
+			stop.ScheduleRelationship = StopSkipped
+		default:
+			stop.Arrival = event(location.RealtimeArrivalTime, location.BookedArrivalTime,
+				location.RealTimeGBTTArrivalLateness, service.RunDate)
+			stop.Departure = event(location.RealtimeDepartureTime, location.BookedDepartureTime,
+				location.RealTimeGBTTDepartureLateness, service.RunDate)
+			if stop.Arrival == nil && stop.Departure == nil {
+				stop.ScheduleRelationship = StopNoData
+			}
+
+			// the trip's delay is from its latest actual report
+			switch {
+			case location.RealTimeDepartureActual && stop.Departure != nil:
+				delay := stop.Departure.Delay
+				update.Delay = &delay
+			case location.RealTimeArrivalActual && stop.Arrival != nil:
+				delay := stop.Arrival.Delay
+				update.Delay = &delay
+			}
+		}
+		update.StopTimeUpdate = append(update.StopTimeUpdate, stop)
+	}
+
+	if service.PlannedCancel || (calls > 0 && cancelled == calls) {
+		update.Trip.ScheduleRelationship = TripCanceled
+		update.StopTimeUpdate = nil
+		update.Delay = nil
+	}
+	return update
+}
+
+// Feed builds a full dataset feed with a trip update for each service
+func (c Converter) Feed(services []model.Service, now time.Time) FeedMessage {
+	feed := FeedMessage{Header: FeedHeader{
+		GTFSRealtimeVersion: Version,
+		Incrementality:      FullDataset,
+		Timestamp:           uint64(now.Unix()),
+	}}
+
+	for _, service := range services {
+		update := c.TripUpdate(service, now)
+		feed.Entity = append(feed.Entity, FeedEntity{
+			ID:         update.Trip.TripID + "_" + update.Trip.StartDate,
+			TripUpdate: &update,
+		})
+	}
+	return feed
+}
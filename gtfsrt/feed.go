@@ -0,0 +1,151 @@
+// Package gtfsrt converts RTT services into GTFS-Realtime TripUpdates, for apps which speak GTFS rather than RTT.
+// Feeds are written as protocol buffers with Marshal, or as JSON following the protobuf JSON mapping with
+// encoding/json. Only the parts of the GTFS-Realtime schema used for trip updates are modelled
+package gtfsrt
+
+import "encoding/json"
+
+// Version is the GTFS-Realtime version feeds are written as
+const Version = "2.0"
+
+// Incrementality says whether a feed is a full dataset or differences from the last one
+type Incrementality int
+
+// FullDataset feeds replace everything from previous feeds
+// Differential feeds only hold what has changed
+const (
+	FullDataset Incrementality = iota
+	Differential
+)
+
+func (i Incrementality) String() string {
+	if i == Differential {
+		return "DIFFERENTIAL"
+	}
+	return "FULL_DATASET"
+}
+
+// MarshalJSON writes the enum by name, as the protobuf JSON mapping does
+func (i Incrementality) MarshalJSON() ([]byte, error) {
+	return json.Marshal(i.String())
+}
+
+// TripRelationship is how a trip relates to the static timetable
+type TripRelationship int
+
+// TripScheduled runs to the static timetable
+// TripAdded is an extra trip
+// TripUnscheduled runs without a timetable
+// TripCanceled was in the timetable but has been cancelled
+const (
+	TripScheduled TripRelationship = iota
+	TripAdded
+	TripUnscheduled
+	TripCanceled
+)
+
+func (r TripRelationship) String() string {
+	switch r {
+	case TripAdded:
+		return "ADDED"
+	case TripUnscheduled:
+		return "UNSCHEDULED"
+	case TripCanceled:
+		return "CANCELED"
+	default:
+		return "SCHEDULED"
+	}
+}
+
+// MarshalJSON writes the enum by name, as the protobuf JSON mapping does
+func (r TripRelationship) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// StopRelationship is how a stop time update relates to the static timetable
+type StopRelationship int
+
+// StopScheduled has realtime data for the stop
+// StopSkipped means the trip no longer calls at the stop
+// StopNoData has no realtime data, consumers should use the static timetable
+const (
+	StopScheduled StopRelationship = iota
+	StopSkipped
+	StopNoData
+)
+
+func (r StopRelationship) String() string {
+	switch r {
+	case StopSkipped:
+		return "SKIPPED"
+	case StopNoData:
+		return "NO_DATA"
+	default:
+		return "SCHEDULED"
+	}
+}
+
+// MarshalJSON writes the enum by name, as the protobuf JSON mapping does
+func (r StopRelationship) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// FeedMessage is a whole GTFS-Realtime feed
+type FeedMessage struct {
+	Header FeedHeader   `json:"header"`
+	Entity []FeedEntity `json:"entity,omitempty"`
+}
+
+// FeedHeader describes a feed, Timestamp is in seconds since the Unix epoch
+type FeedHeader struct {
+	GTFSRealtimeVersion string         `json:"gtfsRealtimeVersion"`
+	Incrementality      Incrementality `json:"incrementality"`
+	Timestamp           uint64         `json:"timestamp,omitempty,string"`
+}
+
+// FeedEntity is an item in a feed, here always a trip update
+type FeedEntity struct {
+	ID         string      `json:"id"`
+	IsDeleted  bool        `json:"isDeleted,omitempty"`
+	TripUpdate *TripUpdate `json:"tripUpdate,omitempty"`
+}
+
+// TripUpdate is the realtime progress of a trip. Delay is in seconds, nil when the trip has no reports yet
+type TripUpdate struct {
+	Trip           TripDescriptor     `json:"trip"`
+	Vehicle        *VehicleDescriptor `json:"vehicle,omitempty"`
+	StopTimeUpdate []StopTimeUpdate   `json:"stopTimeUpdate,omitempty"`
+	Timestamp      uint64             `json:"timestamp,omitempty,string"`
+	Delay          *int32             `json:"delay,omitempty"`
+}
+
+// TripDescriptor identifies a trip, StartTime is HH:MM:SS and StartDate is YYYYMMDD
+type TripDescriptor struct {
+	TripID               string           `json:"tripId,omitempty"`
+	RouteID              string           `json:"routeId,omitempty"`
+	StartTime            string           `json:"startTime,omitempty"`
+	StartDate            string           `json:"startDate,omitempty"`
+	ScheduleRelationship TripRelationship `json:"scheduleRelationship,omitempty"`
+}
+
+// VehicleDescriptor identifies the train running a trip, Label is its headcode
+type VehicleDescriptor struct {
+	ID    string `json:"id,omitempty"`
+	Label string `json:"label,omitempty"`
+}
+
+// StopTimeUpdate is the realtime arrival and departure at a stop on a trip
+type StopTimeUpdate struct {
+	StopSequence         uint32           `json:"stopSequence,omitempty"`
+	StopID               string           `json:"stopId,omitempty"`
+	Arrival              *StopTimeEvent   `json:"arrival,omitempty"`
+	Departure            *StopTimeEvent   `json:"departure,omitempty"`
+	ScheduleRelationship StopRelationship `json:"scheduleRelationship,omitempty"`
+}
+
+// StopTimeEvent is when a trip arrives at or departs from a stop. Delay is in seconds against the
+// timetable, and Time is in seconds since the Unix epoch
+type StopTimeEvent struct {
+	Delay int32 `json:"delay"`
+	Time  int64 `json:"time,omitempty,string"`
+}
@@ -0,0 +1,243 @@
+package gtfsrt
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+	"github.com/georgeprice/realtime-trains-golang/model/modeltest"
+)
+
+var now = time.Date(2020, 2, 12, 9, 0, 0, 0, model.London)
+
+// fields is a decoded protocol buffer message, the varints and byte strings held under each field number
+type fields map[int][]interface{}
+
+// decode reads a protocol buffer message, enough to check what Marshal writes
+func decode(t *testing.T, data []byte) fields {
+	f := make(fields)
+	varint := func() uint64 {
+		var v uint64
+		for shift := uint(0); ; shift += 7 {
+			if len(data) == 0 {
+				t.Fatal("Got truncated varint")
+			}
+			b := data[0]
+			data = data[1:]
+			v |= uint64(b&0x7f) << shift
+			if b < 0x80 {
+				return v
+			}
+		}
+	}
+
+	for len(data) > 0 {
+		key := varint()
+		field := int(key >> 3)
+		switch key & 7 {
+		case wireVarint:
+			f[field] = append(f[field], varint())
+		case wireBytes:
+			n := int(varint())
+			if n > len(data) {
+				t.Fatal("Got truncated bytes")
+			}
+			f[field] = append(f[field], data[:n])
+			data = data[n:]
+		default:
+			t.Fatalf("Got unexpected wire type %d", key&7)
+		}
+	}
+	return f
+}
+
+func (f fields) message(t *testing.T, field, i int) fields {
+	if len(f[field]) <= i {
+		t.Fatalf("Got no message %d of field %d", i, field)
+	}
+	return decode(t, f[field][i].([]byte))
+}
+
+func (f fields) string(field int) string {
+	if len(f[field]) == 0 {
+		return ""
+	}
+	return string(f[field][0].([]byte))
+}
+
+func (f fields) int(field int) int64 {
+	if len(f[field]) == 0 {
+		return 0
+	}
+	return int64(f[field][0].(uint64))
+}
+
+// running is a service which left BMH a minute late, is forecast 5 minutes late at SOU, doesn't call at
+// WIN any more and has no realtime data for WAT
+func running() model.Service {
+	service := modeltest.Service("W12345",
+		modeltest.Call{CRS: "BMH", Departure: "0800", RealDeparture: "0801", Actual: true},
+		modeltest.Call{CRS: "SOU", Arrival: "0830", Departure: "0832", RealArrival: "0835", RealDeparture: "0837"},
+		modeltest.Call{CRS: "WIN", Arrival: "0845", Departure: "0846", Cancelled: true},
+		modeltest.Stop("WAT", "0930", ""))
+	service.TrainIdentity = "1W23"
+	return service
+}
+
+func TestTripUpdate(t *testing.T) {
+
+	update := Converter{}.TripUpdate(running(), now)
+
+	switch {
+	case update.Trip != TripDescriptor{TripID: "W12345", StartTime: "08:00:00", StartDate: "20200212"}:
+		t.Errorf("Got wrong trip, got %+v", update.Trip)
+	case update.Vehicle == nil || update.Vehicle.Label != "1W23":
+		t.Errorf("Got wrong vehicle, got %+v", update.Vehicle)
+	case update.Delay == nil || *update.Delay != 60:
+		t.Errorf("Got wrong delay, got %v", update.Delay)
+	case update.Timestamp != uint64(now.Unix()):
+		t.Errorf("Got wrong timestamp, got %d", update.Timestamp)
+	case len(update.StopTimeUpdate) != 4:
+		t.Fatalf("Got wrong number of stop time updates, got %+v", update.StopTimeUpdate)
+	}
+
+	at := func(clock string) int64 {
+		return time.Date(2020, 2, 12, 0, 0, 0, 0, model.London).Add(mustDuration(t, clock)).Unix()
+	}
+	expected := []StopTimeUpdate{
+		{StopSequence: 1, StopID: "BMH", Departure: &StopTimeEvent{Delay: 60, Time: at("8h01m")}},
+		{StopSequence: 2, StopID: "SOU", Arrival: &StopTimeEvent{Delay: 300, Time: at("8h35m")},
+			Departure: &StopTimeEvent{Delay: 300, Time: at("8h37m")}},
+		{StopSequence: 3, StopID: "WIN", ScheduleRelationship: StopSkipped},
+		{StopSequence: 4, StopID: "WAT", ScheduleRelationship: StopNoData},
+	}
+	if !reflect.DeepEqual(update.StopTimeUpdate, expected) {
+		t.Errorf("Got wrong stop time updates, got %+v, expected %+v", update.StopTimeUpdate, expected)
+	}
+
+	t.Run("cancelled", func(t *testing.T) {
+		planned := running()
+		planned.PlannedCancel = true
+
+		everywhere := modeltest.Service("W2",
+			modeltest.Call{CRS: "BMH", Departure: "0800", Cancelled: true},
+			modeltest.Call{CRS: "WAT", Arrival: "0930", Cancelled: true})
+
+		for _, service := range []model.Service{planned, everywhere} {
+			update := Converter{}.TripUpdate(service, now)
+			if update.Trip.ScheduleRelationship != TripCanceled || update.StopTimeUpdate != nil || update.Delay != nil {
+				t.Errorf("%s: Got wrong cancelled trip, got %+v", service.ServiceUID, update)
+			}
+		}
+	})
+
+	t.Run("stops", func(t *testing.T) {
+		c := Converter{
+			Stops:      map[string]string{"BMHX": "9100BOMO", "WAT": "9100WATRLMN"},
+			OnlyMapped: true,
+			TripID: func(s model.Service) string {
+				return s.ServiceUID + "-" + s.RunDate
+			},
+		}
+		update := c.TripUpdate(running(), now)
+
+		var ids []string
+		for _, stop := range update.StopTimeUpdate {
+			ids = append(ids, stop.StopID)
+		}
+		switch {
+		case !reflect.DeepEqual(ids, []string{"9100BOMO", "9100WATRLMN"}):
+			t.Errorf("Got wrong stops, got %v", ids)
+		case update.StopTimeUpdate[1].StopSequence != 4:
+			t.Errorf("Got wrong stop sequence, got %d", update.StopTimeUpdate[1].StopSequence)
+		case update.Trip.TripID != "W12345-2020-02-12":
+			t.Errorf("Got wrong trip ID, got %s", update.Trip.TripID)
+		}
+	})
+}
+
+func mustDuration(t *testing.T, s string) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestMarshal(t *testing.T) {
+
+	feed := Converter{}.Feed([]model.Service{running()}, now)
+	data, err := feed.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := decode(t, data)
+	header := message.message(t, 1, 0)
+	switch {
+	case header.string(1) != "2.0":
+		t.Errorf("Got wrong version, got %q", header.string(1))
+	case header.int(3) != now.Unix():
+		t.Errorf("Got wrong timestamp, got %d", header.int(3))
+	case len(message[2]) != 1:
+		t.Fatalf("Got wrong number of entities, got %d", len(message[2]))
+	}
+
+	entity := message.message(t, 2, 0)
+	update := entity.message(t, 3, 0)
+	trip := update.message(t, 1, 0)
+	switch {
+	case entity.string(1) != "W12345_20200212":
+		t.Errorf("Got wrong entity ID, got %q", entity.string(1))
+	case trip.string(1) != "W12345" || trip.string(2) != "08:00:00" || trip.string(3) != "20200212":
+		t.Errorf("Got wrong trip, got %v", trip)
+	case update.message(t, 3, 0).string(2) != "1W23":
+		t.Errorf("Got wrong vehicle label")
+	case update.int(5) != 60:
+		t.Errorf("Got wrong delay, got %d", update.int(5))
+	case len(update[2]) != 4:
+		t.Fatalf("Got wrong number of stop time updates, got %d", len(update[2]))
+	}
+
+	sou := update.message(t, 2, 1)
+	switch {
+	case sou.int(1) != 2 || sou.string(4) != "SOU":
+		t.Errorf("Got wrong stop, got %v", sou)
+	case sou.message(t, 2, 0).int(1) != 300 || sou.message(t, 3, 0).int(2) != feed.Entity[0].TripUpdate.StopTimeUpdate[1].Departure.Time:
+		t.Errorf("Got wrong events, got %v", sou)
+	}
+	if win := update.message(t, 2, 2); win.int(5) != int64(StopSkipped) || len(win[2]) != 0 {
+		t.Errorf("Got wrong skipped stop, got %v", win)
+	}
+
+	t.Run("negative", func(t *testing.T) {
+		var e encoder
+		StopTimeEvent{Delay: -60}.encode(&e)
+		if len(e.buf) != 11 || decode(t, e.buf).int(1) != -60 {
+			t.Errorf("Got wrong encoding of a negative delay, got %x", e.buf)
+		}
+	})
+}
+
+func TestJSON(t *testing.T) {
+
+	feed := Converter{}.Feed([]model.Service{running()}, now)
+	data, err := json.Marshal(feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		`"header":{"gtfsRealtimeVersion":"2.0","incrementality":"FULL_DATASET","timestamp":"1581498000"}`,
+		`"trip":{"tripId":"W12345","startTime":"08:00:00","startDate":"20200212"}`,
+		`{"stopSequence":3,"stopId":"WIN","scheduleRelationship":"SKIPPED"}`,
+		`"departure":{"delay":60,"time":"1581494460"}`,
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Got JSON missing %s, got %s", expected, data)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package gtfsrt
+
+// Protocol buffer wire types used by the GTFS-Realtime schema
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// encoder builds up a protocol buffer message. Optional fields holding their zero value are left out,
+// so the field numbers below follow gtfs-realtime.proto
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) varint(v uint64) {
+	for v >= 0x80 {
+		e.buf = append(e.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *encoder) key(field, wire int) {
+	e.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (e *encoder) uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.key(field, wireVarint)
+	e.varint(v)
+}
+
+// int writes a signed int32 or int64, negative numbers taking ten bytes as protobuf sign extends them
+func (e *encoder) int(field int, v int64) {
+	e.key(field, wireVarint)
+	e.varint(uint64(v))
+}
+
+func (e *encoder) bool(field int, v bool) {
+	if v {
+		e.uint(field, 1)
+	}
+}
+
+func (e *encoder) string(field int, s string) {
+	if s == "" {
+		return
+	}
+	e.key(field, wireBytes)
+	e.varint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// message writes a nested message, encoded by fn
+func (e *encoder) message(field int, fn func(*encoder)) {
+	var nested encoder
+	fn(&nested)
+	e.key(field, wireBytes)
+	e.varint(uint64(len(nested.buf)))
+	e.buf = append(e.buf, nested.buf...)
+}
+
+// Marshal encodes the feed as a GTFS-Realtime protocol buffer
+func (m FeedMessage) Marshal() ([]byte, error) {
+	var e encoder
+	m.encode(&e)
+	return e.buf, nil
+}
+
+func (m FeedMessage) encode(e *encoder) {
+	e.message(1, m.Header.encode)
+	for _, entity := range m.Entity {
+		e.message(2, entity.encode)
+	}
+}
+
+func (h FeedHeader) encode(e *encoder) {
+	e.string(1, h.GTFSRealtimeVersion)
+	e.uint(2, uint64(h.Incrementality))
+	e.uint(3, h.Timestamp)
+}
+
+func (f FeedEntity) encode(e *encoder) {
+	e.string(1, f.ID)
+	e.bool(2, f.IsDeleted)
+	if f.TripUpdate != nil {
+		e.message(3, f.TripUpdate.encode)
+	}
+}
+
+func (u TripUpdate) encode(e *encoder) {
+	e.message(1, u.Trip.encode)
+	for _, update := range u.StopTimeUpdate {
+		e.message(2, update.encode)
+	}
+	if u.Vehicle != nil {
+		e.message(3, u.Vehicle.encode)
+	}
+	e.uint(4, u.Timestamp)
+	if u.Delay != nil {
+		e.int(5, int64(*u.Delay))
+	}
+}
+
+func (d TripDescriptor) encode(e *encoder) {
+	e.string(1, d.TripID)
+	e.string(2, d.StartTime)
+	e.string(3, d.StartDate)
+	e.uint(4, uint64(d.ScheduleRelationship))
+	e.string(5, d.RouteID)
+}
+
+func (v VehicleDescriptor) encode(e *encoder) {
+	e.string(1, v.ID)
+	e.string(2, v.Label)
+}
+
+func (u StopTimeUpdate) encode(e *encoder) {
+	e.uint(1, uint64(u.StopSequence))
+	if u.Arrival != nil {
+		e.message(2, u.Arrival.encode)
+	}
+	if u.Departure != nil {
+		e.message(3, u.Departure.encode)
+	}
+	e.string(4, u.StopID)
+	e.uint(5, uint64(u.ScheduleRelationship))
+}
+
+func (t StopTimeEvent) encode(e *encoder) {
+	e.int(1, int64(t.Delay))
+	if t.Time != 0 {
+		e.int(2, t.Time)
+	}
+}
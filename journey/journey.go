@@ -0,0 +1,112 @@
+// Package journey plans journeys between stations, including ones which change trains, from RTT data
+package journey
+
+import (
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// Source is where the planner gets its timetable data from, api.User satisfies it
+type Source interface {
+	ServicesForTime(origin string, date time.Time) (model.Lineup, error)
+	ServiceInfo(id string, date time.Time) (model.Service, error)
+}
+
+// Leg is a ride on a single service from one station to another
+type Leg struct {
+	Service model.Service
+
+	// From and To are the CRS codes of where the leg starts and ends
+	From, To string
+
+	// FromIndex and ToIndex are the positions of the boarding and alighting calls in the service's Locations
+	FromIndex, ToIndex int
+
+	Departure, Arrival time.Time
+}
+
+// Board returns the call the leg boards at
+func (l Leg) Board() model.LocationDetail {
+	return l.Service.Locations[l.FromIndex]
+}
+
+// Alight returns the call the leg alights at
+func (l Leg) Alight() model.LocationDetail {
+	return l.Service.Locations[l.ToIndex]
+}
+
+// Duration is the time spent on the service
+func (l Leg) Duration() time.Duration {
+	return l.Arrival.Sub(l.Departure)
+}
+
+// Itinerary is a journey made up of one or more legs, changing between them at interchange stations
+type Itinerary struct {
+	Legs []Leg
+}
+
+// Departure is when the first leg leaves
+func (i Itinerary) Departure() time.Time {
+	return i.Legs[0].Departure
+}
+
+// Arrival is when the last leg arrives
+func (i Itinerary) Arrival() time.Time {
+	return i.Legs[len(i.Legs)-1].Arrival
+}
+
+// Duration is the time from departing to arriving, including time spent changing
+func (i Itinerary) Duration() time.Duration {
+	return i.Arrival().Sub(i.Departure())
+}
+
+// Changes is the number of interchanges
+func (i Itinerary) Changes() int {
+	return len(i.Legs) - 1
+}
+
+// Interchanges lists the CRS codes of the stations changed at
+func (i Itinerary) Interchanges() []string {
+	var stations []string
+	for _, leg := range i.Legs[1:] {
+		stations = append(stations, leg.From)
+	}
+	return stations
+}
+
+// Ranking orders itineraries, returning true when a should come before b
+type Ranking func(a, b Itinerary) bool
+
+// ByArrival ranks the earliest arrivals first, then the shortest journeys, then the fewest changes
+func ByArrival(a, b Itinerary) bool {
+	switch {
+	case !a.Arrival().Equal(b.Arrival()):
+		return a.Arrival().Before(b.Arrival())
+	case a.Duration() != b.Duration():
+		return a.Duration() < b.Duration()
+	}
+	return a.Changes() < b.Changes()
+}
+
+// ByDuration ranks the shortest journeys first, then the earliest arrivals, then the fewest changes
+func ByDuration(a, b Itinerary) bool {
+	switch {
+	case a.Duration() != b.Duration():
+		return a.Duration() < b.Duration()
+	case !a.Arrival().Equal(b.Arrival()):
+		return a.Arrival().Before(b.Arrival())
+	}
+	return a.Changes() < b.Changes()
+}
+
+// ByChanges ranks the fewest changes first, then the earliest arrivals, then the shortest journeys
+func ByChanges(a, b Itinerary) bool {
+	switch {
+	case a.Changes() != b.Changes():
+		return a.Changes() < b.Changes()
+	case !a.Arrival().Equal(b.Arrival()):
+		return a.Arrival().Before(b.Arrival())
+	}
+	return a.Duration() < b.Duration()
+}
@@ -0,0 +1,156 @@
+package journey
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/api"
+	"github.com/georgeprice/realtime-trains-golang/model"
+	"github.com/georgeprice/realtime-trains-golang/model/modeltest"
+)
+
+// the API client is the usual source of data for planning
+var _ Source = api.User{}
+
+// timetable is a fake source of RTT data, building lineups from its services
+type timetable struct {
+	services []model.Service
+	missing  map[string]bool
+	lineups  int
+}
+
+func (tt *timetable) ServicesForTime(origin string, date time.Time) (model.Lineup, error) {
+	tt.lineups++
+	var lineup model.Lineup
+	for _, service := range tt.services {
+		for _, location := range service.Locations {
+			if location.CRS != origin || location.GBTTBookedDeparture == "" {
+				continue
+			}
+			lineup.Services = append(lineup.Services, model.LocationContainer{
+				ServiceUID:     service.ServiceUID,
+				RunDate:        service.RunDate,
+				IsPassenger:    service.IsPassenger,
+				LocationDetail: location,
+			})
+		}
+	}
+	return lineup.BookedBetween(date, date.Add(24*time.Hour)), nil
+}
+
+func (tt *timetable) ServiceInfo(id string, date time.Time) (model.Service, error) {
+	for _, service := range tt.services {
+		if service.ServiceUID == id && !tt.missing[id] {
+			return service, nil
+		}
+	}
+	return model.Service{}, ErrNoJourney
+}
+
+// summary describes an itinerary by its services and arrival, e.g. S1+S2@1100
+func summary(itineraries []Itinerary) []string {
+	var s []string
+	for _, itinerary := range itineraries {
+		var uids string
+		for i, leg := range itinerary.Legs {
+			if i > 0 {
+				uids += "+"
+			}
+			uids += leg.Service.ServiceUID
+		}
+		s = append(s, uids+"@"+itinerary.Arrival().Format("1504"))
+	}
+	return s
+}
+
+func TestPlan(t *testing.T) {
+
+	tt := &timetable{services: []model.Service{
+		modeltest.Service("S1", modeltest.Stop("BMH", "", "0800"), modeltest.Stop("SOU", "0830", "0832"), modeltest.Stop("WAT", "0930", "")),
+		modeltest.Service("S2", modeltest.Stop("SOU", "", "0840"), modeltest.Stop("BHM", "1000", "1002"), modeltest.Stop("MAN", "1100", "")),
+		modeltest.Service("S3", modeltest.Stop("BMH", "", "0930"), modeltest.Stop("MAN", "1140", "")),
+		modeltest.Service("S4", modeltest.Stop("SOU", "", "0833"), modeltest.Stop("MAN", "1030", "")),
+		modeltest.Service("S5", modeltest.Stop("BMH", "", "0700"), modeltest.Stop("MAN", "0900", "")),
+		modeltest.Service("S6", modeltest.Stop("WAT", "", "0945"), modeltest.Stop("EUS", "1000", "1001"), modeltest.Stop("MAN", "1130", "")),
+		modeltest.Service("S7", modeltest.Stop("BHM", "", "1010"), modeltest.Stop("MAN", "1050", "")),
+	}}
+	after := time.Date(2020, 2, 12, 7, 55, 0, 0, model.London)
+
+	ts := []struct {
+		name     string
+		options  Options
+		expected []string
+	}{
+		{"direct", Options{}, []string{"S3@1140"}},
+		{"one-change", Options{MaxChanges: 1}, []string{"S1+S2@1100", "S1+S6@1130", "S3@1140"}},
+		{"tight-connection", Options{MaxChanges: 1, Connections: map[string]time.Duration{"SOU": time.Minute}},
+			[]string{"S1+S4@1030", "S1+S2@1100", "S1+S6@1130", "S3@1140"}},
+		{"two-changes", Options{MaxChanges: 2}, []string{"S1+S2+S7@1050", "S1+S2@1100", "S1+S6@1130", "S3@1140"}},
+		{"by-changes", Options{MaxChanges: 2, Rank: ByChanges}, []string{"S3@1140", "S1+S2@1100", "S1+S6@1130", "S1+S2+S7@1050"}},
+		{"by-duration", Options{MaxChanges: 2, Rank: ByDuration}, []string{"S3@1140", "S1+S2+S7@1050", "S1+S2@1100", "S1+S6@1130"}},
+		{"limit", Options{MaxChanges: 2, Limit: 1}, []string{"S1+S2+S7@1050"}},
+		{"window", Options{MaxChanges: 1, Window: 10 * time.Minute}, []string{"S1+S2@1100"}},
+	}
+
+	for _, tc := range ts {
+		itineraries, err := New(tt, tc.options).Plan("BMH", "MAN", after)
+		if err != nil {
+			t.Errorf("%s: Got error %v", tc.name, err)
+			continue
+		}
+		if got := summary(itineraries); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: Got wrong itineraries, got %v, expected %v", tc.name, got, tc.expected)
+		}
+	}
+
+	t.Run("itinerary", func(t *testing.T) {
+		itineraries, err := New(tt, Options{MaxChanges: 1}).Plan("BMH", "MAN", after)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		itinerary := itineraries[0]
+		switch {
+		case itinerary.Changes() != 1:
+			t.Errorf("Got wrong number of changes, got %d", itinerary.Changes())
+		case !reflect.DeepEqual(itinerary.Interchanges(), []string{"SOU"}):
+			t.Errorf("Got wrong interchanges, got %v", itinerary.Interchanges())
+		case itinerary.Duration() != 3*time.Hour:
+			t.Errorf("Got wrong duration, got %v", itinerary.Duration())
+		case itinerary.Legs[0].Alight().CRS != "SOU" || itinerary.Legs[1].Board().CRS != "SOU":
+			t.Errorf("Got wrong interchange calls, got %+v", itinerary.Legs)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		if _, err := New(tt, Options{}).Plan("BMH", "bmh", after); err != ErrSameStation {
+			t.Errorf("Got wrong error, got %v, expected %v", err, ErrSameStation)
+		}
+		if _, err := New(tt, Options{MaxChanges: 2}).Plan("MAN", "BMH", after); err != ErrNoJourney {
+			t.Errorf("Got wrong error, got %v, expected %v", err, ErrNoJourney)
+		}
+	})
+
+	t.Run("missing-service", func(t *testing.T) {
+		broken := &timetable{services: tt.services, missing: map[string]bool{"S3": true}}
+		itineraries, err := New(broken, Options{MaxChanges: 1}).Plan("BMH", "MAN", after)
+		if err != nil {
+			t.Fatalf("Got error %v", err)
+		}
+		if got, expected := summary(itineraries), []string{"S1+S2@1100", "S1+S6@1130"}; !reflect.DeepEqual(got, expected) {
+			t.Errorf("Got wrong itineraries, got %v, expected %v", got, expected)
+		}
+	})
+
+	t.Run("cache", func(t *testing.T) {
+		planner := New(tt, Options{MaxChanges: 1})
+		tt.lineups = 0
+		planner.Plan("BMH", "MAN", after)
+		first := tt.lineups
+		planner.Plan("BMH", "MAN", after)
+		if tt.lineups != first {
+			t.Errorf("Got lineups fetched again, got %d requests, expected %d", tt.lineups, first)
+		}
+	})
+}
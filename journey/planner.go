@@ -0,0 +1,295 @@
+package journey
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+var (
+	// ErrNoJourney is returned when no itinerary reaches the destination within the search limits
+	ErrNoJourney = errors.New("No journey found")
+
+	// ErrSameStation is returned when the origin and destination are the same
+	ErrSameStation = errors.New("Origin station is equal destination")
+)
+
+// DefaultConnection is the minimum connection time used at stations without their own
+const DefaultConnection = 5 * time.Minute
+
+// DefaultWindow is how far ahead of being ready to depart a station services are considered
+const DefaultWindow = 2 * time.Hour
+
+// Options limits and tunes a journey search
+type Options struct {
+
+	// MaxChanges is the most interchanges an itinerary can have, zero only finds direct services
+	MaxChanges int
+
+	// MinConnection is the minimum time to change trains, DefaultConnection when zero
+	MinConnection time.Duration
+
+	// Connections overrides MinConnection for stations, keyed by CRS
+	Connections map[string]time.Duration
+
+	// Window is how far ahead of being ready to depart a station services are considered, DefaultWindow when zero
+	Window time.Duration
+
+	// Realtime plans with actual and forecast times where RTT has them, rather than booked times
+	Realtime bool
+
+	// Rank orders the results, ByArrival when nil
+	Rank Ranking
+
+	// Limit is the most itineraries returned, all of them when zero
+	Limit int
+}
+
+// connection returns the minimum connection time at a station
+func (o Options) connection(crs string) time.Duration {
+	if d, ok := o.Connections[strings.ToUpper(crs)]; ok {
+		return d
+	}
+	if o.MinConnection > 0 {
+		return o.MinConnection
+	}
+	return DefaultConnection
+}
+
+func (o Options) window() time.Duration {
+	if o.Window > 0 {
+		return o.Window
+	}
+	return DefaultWindow
+}
+
+// Planner searches for itineraries using a source of timetable data, caching what it fetches
+type Planner struct {
+	Source  Source
+	Options Options
+
+	lineups  map[string]model.Lineup
+	services map[string]model.Service
+}
+
+// New creates a planner fetching data from source, e.g. an api.User
+func New(source Source, options Options) *Planner {
+	return &Planner{
+		Source:   source,
+		Options:  options,
+		lineups:  make(map[string]model.Lineup),
+		services: make(map[string]model.Service),
+	}
+}
+
+// label is a partial itinerary reaching a station, ready to depart again from a given time
+type label struct {
+	legs    []Leg
+	station string
+	ready   time.Time
+}
+
+// visited checks whether a partial itinerary has already been to a station, to avoid going round in circles
+func (l label) visited(crs string) bool {
+	for _, leg := range l.legs {
+		if strings.EqualFold(leg.From, crs) || strings.EqualFold(leg.To, crs) {
+			return true
+		}
+	}
+	return false
+}
+
+// Plan finds itineraries from one station to another, given as CRS codes, leaving after a time.
+// Each round of the search rides every service from the stations reached in the previous round,
+// carrying on from a station only when it is reached earlier than before
+func (p *Planner) Plan(from, to string, after time.Time) ([]Itinerary, error) {
+
+	if strings.EqualFold(from, to) {
+		return nil, ErrSameStation
+	}
+
+	var (
+		itineraries []Itinerary
+		frontier    = []label{{station: strings.ToUpper(from), ready: after}}
+		best        = map[string]time.Time{strings.ToUpper(from): after}
+	)
+
+	for round := 0; round <= p.Options.MaxChanges && len(frontier) > 0; round++ {
+		var next []label
+
+		for _, start := range frontier {
+			legs, err := p.legsFrom(start.station, start.ready)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, leg := range legs {
+				if start.visited(leg.To) {
+					continue
+				}
+
+				reached := label{
+					legs:    append(append([]Leg{}, start.legs...), leg),
+					station: leg.To,
+					ready:   leg.Arrival.Add(p.Options.connection(leg.To)),
+				}
+
+				// reaching the destination completes an itinerary, anywhere else might be an interchange
+				if strings.EqualFold(leg.To, to) {
+					itineraries = append(itineraries, Itinerary{Legs: reached.legs})
+					continue
+				}
+				if previous, ok := best[leg.To]; ok && !leg.Arrival.Before(previous) {
+					continue
+				}
+				best[leg.To] = leg.Arrival
+				next = append(next, reached)
+			}
+		}
+
+		frontier = next
+	}
+
+	if len(itineraries) == 0 {
+		return nil, ErrNoJourney
+	}
+
+	rank := p.Options.Rank
+	if rank == nil {
+		rank = ByArrival
+	}
+	sort.SliceStable(itineraries, func(i, j int) bool {
+		return rank(itineraries[i], itineraries[j])
+	})
+
+	if p.Options.Limit > 0 && len(itineraries) > p.Options.Limit {
+		itineraries = itineraries[:p.Options.Limit]
+	}
+	return itineraries, nil
+}
+
+// legsFrom returns every ride from a station on services departing within the window after ready,
+// to each later public call on those services
+func (p *Planner) legsFrom(station string, ready time.Time) ([]Leg, error) {
+
+	lineup, err := p.lineup(station, ready)
+	if err != nil {
+		return nil, err
+	}
+
+	var legs []Leg
+	end := ready.Add(p.Options.window())
+	for _, entry := range lineup.PassengerOnly().WithoutCancelled().Services {
+
+		departure, err := p.departure(entry.LocationDetail, entry.RunDate)
+		if err != nil || departure.Before(ready) || !departure.Before(end) {
+			continue
+		}
+
+		// a service RTT can't give us is left out, rather than failing the whole search
+		service, err := p.service(entry.ServiceUID, entry.RunDate)
+		if err != nil {
+			continue
+		}
+
+		// find the call matching the lineup entry, loop services can call at a station more than once
+		board := -1
+		for _, i := range service.IndexesOf(station) {
+			if t, err := p.departure(service.Locations[i], service.RunDate); err == nil && t.Equal(departure) {
+				board = i
+				break
+			}
+		}
+		if board == -1 {
+			continue
+		}
+
+		for i := board + 1; i < len(service.Locations); i++ {
+			location := service.Locations[i]
+			if location.CRS == "" || !location.PublicCall() || location.Cancelled() {
+				continue
+			}
+
+			arrival, err := p.arrival(location, service.RunDate)
+			if err != nil {
+				continue
+			}
+
+			legs = append(legs, Leg{
+				Service:   service,
+				From:      station,
+				To:        strings.ToUpper(location.CRS),
+				FromIndex: board,
+				ToIndex:   i,
+				Departure: departure,
+				Arrival:   arrival,
+			})
+		}
+	}
+	return legs, nil
+}
+
+// departure returns when a service leaves a call, realtime if planning with it and RTT has it
+func (p *Planner) departure(location model.LocationDetail, runDate string) (time.Time, error) {
+	if p.Options.Realtime {
+		if t, err := location.RealtimeDepartureTime(runDate); err == nil {
+			return t, nil
+		}
+	}
+	return location.BookedDepartureTime(runDate)
+}
+
+// arrival returns when a service reaches a call, realtime if planning with it and RTT has it
+func (p *Planner) arrival(location model.LocationDetail, runDate string) (time.Time, error) {
+	if p.Options.Realtime {
+		if t, err := location.RealtimeArrivalTime(runDate); err == nil {
+			return t, nil
+		}
+	}
+	return location.BookedArrivalTime(runDate)
+}
+
+// lineup fetches the services from a station at a time, caching the result
+func (p *Planner) lineup(station string, at time.Time) (model.Lineup, error) {
+	at = at.In(model.London).Truncate(time.Minute)
+	key := station + "/" + at.Format("200601021504")
+	if lineup, ok := p.lineups[key]; ok {
+		return lineup, nil
+	}
+
+	lineup, err := p.Source.ServicesForTime(station, at)
+	if err != nil {
+		return lineup, err
+	}
+	if p.lineups == nil {
+		p.lineups = make(map[string]model.Lineup)
+	}
+	p.lineups[key] = lineup
+	return lineup, nil
+}
+
+// service fetches a service by UID and run date, caching the result
+func (p *Planner) service(uid, runDate string) (model.Service, error) {
+	key := uid + "/" + runDate
+	if service, ok := p.services[key]; ok {
+		return service, nil
+	}
+
+	date, err := time.ParseInLocation("2006-01-02", runDate, model.London)
+	if err != nil {
+		return model.Service{}, err
+	}
+
+	service, err := p.Source.ServiceInfo(uid, date)
+	if err != nil {
+		return service, err
+	}
+	if p.services == nil {
+		p.services = make(map[string]model.Service)
+	}
+	p.services[key] = service
+	return service, nil
+}
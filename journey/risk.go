@@ -0,0 +1,135 @@
+package journey
+
+import (
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// Risk describes how likely a connection between two services is to be missed
+type Risk int
+
+// RiskLow leaves comfortably more than the minimum connection time
+// RiskMedium leaves the minimum connection time, but less than RiskBuffer spare
+// RiskHigh leaves less than the minimum connection time, though the second service hasn't left yet
+// RiskMissed means the second service leaves before the first arrives, or one of them is cancelled
+const (
+	RiskLow Risk = iota
+	RiskMedium
+	RiskHigh
+	RiskMissed
+)
+
+func (r Risk) String() string {
+	switch r {
+	case RiskLow:
+		return "low"
+	case RiskMedium:
+		return "medium"
+	case RiskHigh:
+		return "high"
+	default:
+		return "missed"
+	}
+}
+
+// RiskBuffer is the spare time over the minimum connection below which a connection is RiskMedium
+const RiskBuffer = 5 * time.Minute
+
+// Connection is the assessment of changing from one service to another at an interchange
+type Connection struct {
+	Station string
+
+	// Arrival and Departure are the projected times, realtime where RTT has them and booked otherwise
+	Arrival, Departure time.Time
+
+	// BookedMargin is the time between services in the timetable, Margin is between the projected times
+	BookedMargin, Margin time.Duration
+
+	MinConnection time.Duration
+	Risk          Risk
+
+	// Alternative is the next service which can still be made if this connection is missed, nil if there isn't one
+	Alternative *model.LocationContainer
+}
+
+// projected returns a realtime time where RTT has one, otherwise the booked time
+func projected(realtime, booked func(string) (time.Time, error), runDate string) (time.Time, error) {
+	if t, err := realtime(runDate); err == nil {
+		return t, nil
+	}
+	return booked(runDate)
+}
+
+// AssessConnection works out the risk of missing a change from the first service to the second at a station, given
+// as a TIPLOC or CRS code, using the minimum connection time or DefaultConnection when zero. The next alternative is
+// picked from a lineup of departures from the station, e.g. from DeparturesToDestination for the onward journey
+func AssessConnection(first, second model.Service, station string, minConnection time.Duration, alternatives model.Lineup) (Connection, error) {
+
+	if minConnection <= 0 {
+		minConnection = DefaultConnection
+	}
+	connection := Connection{Station: station, MinConnection: minConnection}
+
+	visits, j := first.IndexesOf(station), second.IndexOf(station)
+	if len(visits) == 0 || j == -1 {
+		return connection, model.ErrLocationNotFound
+	}
+	board := second.Locations[j]
+	bookedDeparture, err := board.BookedDepartureTime(second.RunDate)
+	if err != nil {
+		return connection, err
+	}
+
+	// loop services can visit the station more than once, alight at the last visit before the connection
+	i := visits[0]
+	for _, visit := range visits {
+		if t, err := first.Locations[visit].BookedArrivalTime(first.RunDate); err == nil && !t.After(bookedDeparture) {
+			i = visit
+		}
+	}
+	alight := first.Locations[i]
+
+	// timetabled margin, then the margin from the latest realtime data
+	bookedArrival, err := alight.BookedArrivalTime(first.RunDate)
+	if err != nil {
+		return connection, err
+	}
+	connection.BookedMargin = bookedDeparture.Sub(bookedArrival)
+
+	connection.Arrival, err = projected(alight.RealtimeArrivalTime, alight.BookedArrivalTime, first.RunDate)
+	if err != nil {
+		return connection, err
+	}
+	connection.Departure, err = projected(board.RealtimeDepartureTime, board.BookedDepartureTime, second.RunDate)
+	if err != nil {
+		return connection, err
+	}
+	connection.Margin = connection.Departure.Sub(connection.Arrival)
+
+	switch {
+	case alight.Cancelled() || board.Cancelled() || first.PlannedCancel || second.PlannedCancel || connection.Margin < 0:
+		connection.Risk = RiskMissed
+	case connection.Margin < minConnection:
+		connection.Risk = RiskHigh
+	case connection.Margin < minConnection+RiskBuffer:
+		connection.Risk = RiskMedium
+	default:
+		connection.Risk = RiskLow
+	}
+
+	// the alternative is the first other service leaving once there's been time to change
+	ready := connection.Arrival.Add(minConnection)
+	for _, entry := range alternatives.WithoutCancelled().SortByRealtime().Services {
+		if entry.ServiceUID == second.ServiceUID && entry.RunDate == second.RunDate {
+			continue
+		}
+		if t, err := entry.RealtimeTime(); err == nil && !t.Before(ready) {
+			alternative := entry
+			connection.Alternative = &alternative
+			break
+		}
+	}
+
+	return connection, nil
+}
@@ -0,0 +1,96 @@
+package journey
+
+import (
+	"testing"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+	"github.com/georgeprice/realtime-trains-golang/model/modeltest"
+)
+
+func TestAssessConnection(t *testing.T) {
+
+	// first arrives at SOU at the given realtime, with a 10 minute booked connection onto second
+	arriving := func(realtime string) model.Service {
+		service := modeltest.Service("S1", modeltest.Stop("BMH", "", "0800"), modeltest.Stop("SOU", "0830", "0832"))
+		service.Locations[1].RealTimeArrival = realtime
+		return service
+	}
+	second := modeltest.Service("S2", modeltest.Stop("SOU", "", "0840"), modeltest.Stop("MAN", "1100", ""))
+
+	cancelled := modeltest.Service("S2", modeltest.Stop("SOU", "", "0840"), modeltest.Stop("MAN", "1100", ""))
+	cancelled.Locations[0].DisplayAs = "CANCELLED_CALL"
+
+	firstCancelled := arriving("")
+	firstCancelled.PlannedCancel = true
+
+	// a loop service passing through SOU at 0745 on the way out, then arriving at 0830 on the way back
+	loop := modeltest.Service("S1", modeltest.Stop("SOU", "", "0740"), modeltest.Stop("SOU", "0745", "0746"),
+		modeltest.Stop("BMH", "0800", "0805"), modeltest.Stop("SOU", "0830", ""))
+
+	entry := func(uid, departure, display string) model.LocationContainer {
+		return model.LocationContainer{
+			ServiceUID: uid,
+			RunDate:    "2020-02-12",
+			LocationDetail: model.LocationDetail{
+				GBTTBookedDeparture: departure,
+				DisplayAs:           display,
+			},
+		}
+	}
+	alternatives := model.Lineup{Services: []model.LocationContainer{
+		entry("A3", "0900", "CALL"),
+		entry("S2", "0840", "CALL"),
+		entry("A1", "0845", "CANCELLED_CALL"),
+		entry("A2", "0850", "CALL"),
+	}}
+
+	ts := []struct {
+		name        string
+		first       model.Service
+		second      model.Service
+		margin      time.Duration
+		risk        Risk
+		alternative string
+	}{
+		{"on-time", arriving(""), second, 10 * time.Minute, RiskLow, "A2"},
+		{"slightly-late", arriving("0833"), second, 7 * time.Minute, RiskMedium, "A2"},
+		{"tight", arriving("0837"), second, 3 * time.Minute, RiskHigh, "A2"},
+		{"missed", arriving("0842"), second, -2 * time.Minute, RiskMissed, "A2"},
+		{"very-late", arriving("0856"), second, -16 * time.Minute, RiskMissed, ""},
+		{"cancelled", arriving(""), cancelled, 10 * time.Minute, RiskMissed, "A2"},
+		{"first-cancelled", firstCancelled, second, 10 * time.Minute, RiskMissed, "A2"},
+		{"loop", loop, second, 10 * time.Minute, RiskLow, "A2"},
+	}
+
+	for _, tc := range ts {
+		connection, err := AssessConnection(tc.first, tc.second, "SOU", 0, alternatives)
+		if err != nil {
+			t.Errorf("%s: Got error %v", tc.name, err)
+			continue
+		}
+
+		var alternative string
+		if connection.Alternative != nil {
+			alternative = connection.Alternative.ServiceUID
+		}
+
+		switch {
+		case connection.BookedMargin != 10*time.Minute:
+			t.Errorf("%s: Got wrong booked margin, got %v", tc.name, connection.BookedMargin)
+		case connection.Margin != tc.margin:
+			t.Errorf("%s: Got wrong margin, got %v, expected %v", tc.name, connection.Margin, tc.margin)
+		case connection.Risk != tc.risk:
+			t.Errorf("%s: Got wrong risk, got %s, expected %s", tc.name, connection.Risk, tc.risk)
+		case alternative != tc.alternative:
+			t.Errorf("%s: Got wrong alternative, got %q, expected %q", tc.name, alternative, tc.alternative)
+		}
+	}
+
+	t.Run("not-found", func(t *testing.T) {
+		_, err := AssessConnection(arriving(""), second, "WAT", 0, alternatives)
+		if err != model.ErrLocationNotFound {
+			t.Errorf("Got wrong error, got %v, expected %v", err, model.ErrLocationNotFound)
+		}
+	})
+}
@@ -0,0 +1,156 @@
+// Package metrics writes metrics in the Prometheus text exposition format, without depending on the
+// Prometheus client library. Collectors are registered with a Registry, which serves them all for
+// Prometheus to scrape. A Registry is meant to be mounted as a scrape endpoint of its own, it doesn't
+// implement the client library's interfaces, so apps already using the client library should serve it
+// on a separate path rather than try to merge the two
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Collector writes a set of metrics each time they are scraped
+type Collector interface {
+	Collect(e *Encoder)
+}
+
+// Registry is a set of collectors served on one endpoint, it is safe for concurrent use. Metric names
+// aren't checked across collectors, so each name should come from only one of them
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a collector to the registry
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// ServeHTTP serves every registered collector's metrics, for Prometheus to scrape
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	e := &Encoder{}
+	for _, c := range collectors {
+		c.Collect(e)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(e.buf.Bytes())
+}
+
+// Labels are the labels on a sample, written in name order
+type Labels map[string]string
+
+// Encoder writes metrics in the text exposition format. Each metric's samples must follow its Header
+type Encoder struct {
+	buf bytes.Buffer
+}
+
+// Bytes returns everything written so far
+func (e *Encoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
+
+// Header introduces a metric with its help text and type, e.g. counter, gauge or histogram
+func (e *Encoder) Header(name, help, kind string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(&e.buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// Sample writes a single value of a metric
+func (e *Encoder) Sample(name string, labels Labels, value float64) {
+	e.buf.WriteString(name)
+	if len(labels) > 0 {
+		names := make([]string, 0, len(labels))
+		for n := range labels {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		escape := strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+		e.buf.WriteByte('{')
+		for i, n := range names {
+			if i > 0 {
+				e.buf.WriteByte(',')
+			}
+			fmt.Fprintf(&e.buf, `%s="%s"`, n, escape.Replace(labels[n]))
+		}
+		e.buf.WriteByte('}')
+	}
+	e.buf.WriteByte(' ')
+	e.buf.WriteString(formatValue(value))
+	e.buf.WriteByte('\n')
+}
+
+// formatValue writes a value as Prometheus expects, including infinities
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Histogram counts observations into buckets, it isn't safe for concurrent use on its own
+type Histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// DefaultBuckets are upper bounds suiting request latencies in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// NewHistogram creates a histogram with the given bucket upper bounds, in increasing order
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+// Observe adds a value to the histogram
+func (h *Histogram) Observe(v float64) {
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Histogram writes a histogram's cumulative buckets, sum and count
+func (e *Encoder) Histogram(name string, labels Labels, h *Histogram) {
+	bucket := make(Labels, len(labels)+1)
+	for n, v := range labels {
+		bucket[n] = v
+	}
+	for i, bound := range h.bounds {
+		bucket["le"] = formatValue(bound)
+		e.Sample(name+"_bucket", bucket, float64(h.counts[i]))
+	}
+	bucket["le"] = "+Inf"
+	e.Sample(name+"_bucket", bucket, float64(h.count))
+	e.Sample(name+"_sum", labels, h.sum)
+	e.Sample(name+"_count", labels, float64(h.count))
+}
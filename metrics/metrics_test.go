@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// collectorFunc adapts a function to a Collector
+type collectorFunc func(e *Encoder)
+
+func (f collectorFunc) Collect(e *Encoder) {
+	f(e)
+}
+
+func TestEncoder(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 1})
+	for _, v := range []float64{0.05, 0.5, 2} {
+		h.Observe(v)
+	}
+
+	e := &Encoder{}
+	e.Header("trains_late", "Late trains,\nby station.", "gauge")
+	e.Sample("trains_late", Labels{"operator": "XC", "crs": "MAN"}, 3)
+	e.Sample("trains_late", Labels{"crs": `say "hi"\`}, 0.5)
+	e.Sample("trains_late", nil, math.Inf(1))
+	e.Header("latency_seconds", "Latency.", "histogram")
+	e.Histogram("latency_seconds", Labels{"kind": "service"}, h)
+
+	expected := `# HELP trains_late Late trains,\nby station.
+# TYPE trains_late gauge
+trains_late{crs="MAN",operator="XC"} 3
+trains_late{crs="say \"hi\"\\"} 0.5
+trains_late +Inf
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{kind="service",le="0.1"} 1
+latency_seconds_bucket{kind="service",le="1"} 2
+latency_seconds_bucket{kind="service",le="+Inf"} 3
+latency_seconds_sum{kind="service"} 2.55
+latency_seconds_count{kind="service"} 3
+`
+	if got := string(e.Bytes()); got != expected {
+		t.Errorf("Got wrong exposition, got\n%s\nexpected\n%s", got, expected)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	for _, name := range []string{"first", "second"} {
+		name := name
+		registry.Register(collectorFunc(func(e *Encoder) {
+			e.Header(name, "A metric.", "counter")
+			e.Sample(name, nil, 1)
+		}))
+	}
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	expected := "# HELP first A metric.\n# TYPE first counter\nfirst 1\n# HELP second A metric.\n# TYPE second counter\nsecond 1\n"
+	if got := recorder.Body.String(); got != expected {
+		t.Errorf("Got wrong exposition, got\n%s\nexpected\n%s", got, expected)
+	}
+	if got := recorder.Header().Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Errorf("Got wrong content type, got %s", got)
+	}
+}
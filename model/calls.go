@@ -0,0 +1,134 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrLocationNotFound is returned when a service doesn't visit a given location
+	ErrLocationNotFound = errors.New("Service does not visit location")
+
+	// ErrWrongDirection is returned when a service only visits a destination before its origin
+	ErrWrongDirection = errors.New("Service does not visit destination after origin")
+)
+
+// At reports whether the location has the given TIPLOC or CRS code
+func (d LocationDetail) At(code string) bool {
+	return code != "" && (strings.EqualFold(d.TIPLOC, code) || strings.EqualFold(d.CRS, code))
+}
+
+// PublicCall reports whether passengers can board or alight at the location
+func (d LocationDetail) PublicCall() bool {
+	return d.IsCall && d.IsCallPublic
+}
+
+// PublicCalls returns the locations where passengers can board or alight, including cancelled calls
+func (s Service) PublicCalls() []LocationDetail {
+	var calls []LocationDetail
+	for _, location := range s.Locations {
+		if location.PublicCall() {
+			calls = append(calls, location)
+		}
+	}
+	return calls
+}
+
+// CallsAt reports whether passengers can board or alight at a TIPLOC or CRS code, ignoring cancelled calls
+func (s Service) CallsAt(code string) bool {
+	for _, location := range s.Locations {
+		if location.At(code) && location.PublicCall() && !location.Cancelled() {
+			return true
+		}
+	}
+	return false
+}
+
+// IndexOf returns the position in Locations of the first visit to a TIPLOC or CRS code, or -1 if there isn't one.
+// Loop services can visit a location more than once, IndexesOf returns every visit
+func (s Service) IndexOf(code string) int {
+	for i, location := range s.Locations {
+		if location.At(code) {
+			return i
+		}
+	}
+	return -1
+}
+
+// IndexesOf returns the positions in Locations of every visit to a TIPLOC or CRS code, in order
+func (s Service) IndexesOf(code string) []int {
+	var indexes []int
+	for i, location := range s.Locations {
+		if location.At(code) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// segment finds the positions of the shortest journey from one location to another, so a loop
+// service visiting the origin twice boards at the later visit
+func (s Service) segment(from, to string) (int, int, error) {
+
+	froms := s.IndexesOf(from)
+	tos := s.IndexesOf(to)
+	if len(froms) == 0 || len(tos) == 0 {
+		return -1, -1, ErrLocationNotFound
+	}
+
+	start, end := -1, -1
+	for _, i := range froms {
+		for _, j := range tos {
+			if j <= i {
+				continue
+			}
+			if start == -1 || j-i < end-start {
+				start, end = i, j
+			}
+			break
+		}
+	}
+
+	if start == -1 {
+		return -1, -1, ErrWrongDirection
+	}
+	return start, end, nil
+}
+
+// StopsBetween returns the public calls after leaving one location and before reaching another,
+// given as TIPLOC or CRS codes
+func (s Service) StopsBetween(from, to string) ([]LocationDetail, error) {
+
+	start, end, err := s.segment(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var stops []LocationDetail
+	for _, location := range s.Locations[start+1 : end] {
+		if location.PublicCall() {
+			stops = append(stops, location)
+		}
+	}
+	return stops, nil
+}
+
+// JourneyTime returns the booked time from departing one location to arriving at another, given as TIPLOC or CRS codes
+func (s Service) JourneyTime(from, to string) (time.Duration, error) {
+
+	start, end, err := s.segment(from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	departure, err := s.Locations[start].BookedDepartureTime(s.RunDate)
+	if err != nil {
+		return 0, err
+	}
+	arrival, err := s.Locations[end].BookedArrivalTime(s.RunDate)
+	if err != nil {
+		return 0, err
+	}
+	return arrival.Sub(departure), nil
+}
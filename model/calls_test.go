@@ -0,0 +1,150 @@
+package model
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// loopService runs a circuit from A back round to A, then on to D
+var loopService = Service{
+	RunDate: "2020-02-12",
+	Locations: []LocationDetail{
+		{TIPLOC: "A", CRS: "AAA", GBTTBookedDeparture: "1000", IsCall: true, IsCallPublic: true},
+		{TIPLOC: "B", CRS: "BBB", GBTTBookedArrival: "1010", GBTTBookedDeparture: "1011", IsCall: true, IsCallPublic: true},
+		{TIPLOC: "X", WTTBookedPass: "101500"},
+		{TIPLOC: "C", CRS: "CCC", GBTTBookedArrival: "1020", GBTTBookedDeparture: "1021", IsCall: true, DisplayAs: "CALL"},
+		{TIPLOC: "A", CRS: "AAA", GBTTBookedArrival: "1030", GBTTBookedDeparture: "1032", IsCall: true, IsCallPublic: true},
+		{TIPLOC: "D", CRS: "DDD", GBTTBookedArrival: "1040", IsCall: true, IsCallPublic: true, DisplayAs: "CANCELLED_CALL"},
+	},
+}
+
+// tiplocs lists the TIPLOCs of locations, in order
+func tiplocs(locations []LocationDetail) []string {
+	var codes []string
+	for _, location := range locations {
+		codes = append(codes, location.TIPLOC)
+	}
+	return codes
+}
+
+func TestCallingPattern(t *testing.T) {
+
+	var service Service
+	t.Run("load-expected-data", func(t *testing.T) {
+		pwd, err := os.Getwd()
+		if err != nil {
+			t.Fatalf("Could not load test data, got error %s", err.Error())
+		}
+
+		jsonReader, err := os.Open(path.Join(pwd, "expected", serviceFile))
+		if err != nil {
+			t.Fatalf("Could not open service file, got error %s", err.Error())
+		}
+		defer jsonReader.Close()
+
+		if err := json.NewDecoder(jsonReader).Decode(&service); err != nil {
+			t.Fatalf("Could not decode service JSON, got error %s", err.Error())
+		}
+	})
+
+	t.Run("PublicCalls", func(t *testing.T) {
+		if got := len(service.PublicCalls()); got != 15 {
+			t.Errorf("Got wrong number of public calls, got %d, expected 15", got)
+		}
+
+		expected := []string{"A", "B", "A", "D"}
+		if got := tiplocs(loopService.PublicCalls()); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Got wrong loop public calls, got %v, expected %v", got, expected)
+		}
+	})
+
+	t.Run("CallsAt", func(t *testing.T) {
+		ts := []struct {
+			service  Service
+			code     string
+			expected bool
+		}{
+			{service, "BMH", true},
+			{service, "BOMO", true},
+			{service, "WAT", false},
+			{loopService, "CCC", false},
+			{loopService, "X", false},
+			{loopService, "DDD", false},
+			{loopService, "AAA", true},
+		}
+		for _, tc := range ts {
+			if got := tc.service.CallsAt(tc.code); got != tc.expected {
+				t.Errorf("Got wrong result for %s, got %v, expected %v", tc.code, got, tc.expected)
+			}
+		}
+	})
+
+	t.Run("IndexOf", func(t *testing.T) {
+		switch {
+		case service.IndexOf("CHR") != 9:
+			t.Errorf("Got wrong index for CHR, got %d", service.IndexOf("CHR"))
+		case service.IndexOf("NOWHERE") != -1:
+			t.Errorf("Got wrong index for NOWHERE, got %d", service.IndexOf("NOWHERE"))
+		case loopService.IndexOf("A") != 0:
+			t.Errorf("Got wrong index for A, got %d", loopService.IndexOf("A"))
+		case !reflect.DeepEqual(loopService.IndexesOf("A"), []int{0, 4}):
+			t.Errorf("Got wrong indexes for A, got %v", loopService.IndexesOf("A"))
+		}
+	})
+
+	t.Run("StopsBetween", func(t *testing.T) {
+		ts := []struct {
+			service  Service
+			from, to string
+			expected []string
+			err      error
+		}{
+			{service, "ESL", "POOLE", tiplocs(service.Locations[1:14]), nil},
+			{service, "BMH", "POO", []string{"BRANKSM", "PSTONE"}, nil},
+			{service, "BMH", "BSM", nil, nil},
+			{service, "POO", "BMH", nil, ErrWrongDirection},
+			{service, "WAT", "BMH", nil, ErrLocationNotFound},
+			{loopService, "A", "D", nil, nil},
+			{loopService, "A", "A", []string{"B"}, nil},
+			{loopService, "B", "D", []string{"A"}, nil},
+		}
+		for _, tc := range ts {
+			got, err := tc.service.StopsBetween(tc.from, tc.to)
+			switch {
+			case err != tc.err:
+				t.Errorf("Got wrong error from %s to %s, got %v, expected %v", tc.from, tc.to, err, tc.err)
+			case !reflect.DeepEqual(tiplocs(got), tc.expected):
+				t.Errorf("Got wrong stops from %s to %s, got %v, expected %v", tc.from, tc.to, tiplocs(got), tc.expected)
+			}
+		}
+	})
+
+	t.Run("JourneyTime", func(t *testing.T) {
+		ts := []struct {
+			service  Service
+			from, to string
+			expected time.Duration
+			err      error
+		}{
+			{service, "ESL", "POO", 70 * time.Minute, nil},
+			{service, "SOU", "BMH", 44 * time.Minute, nil},
+			{loopService, "A", "D", 8 * time.Minute, nil},
+			{loopService, "A", "A", 30 * time.Minute, nil},
+			{loopService, "A", "X", 0, ErrNoTime},
+			{loopService, "D", "A", 0, ErrWrongDirection},
+		}
+		for _, tc := range ts {
+			got, err := tc.service.JourneyTime(tc.from, tc.to)
+			switch {
+			case err != tc.err:
+				t.Errorf("Got wrong error from %s to %s, got %v, expected %v", tc.from, tc.to, err, tc.err)
+			case got != tc.expected:
+				t.Errorf("Got wrong journey time from %s to %s, got %v, expected %v", tc.from, tc.to, got, tc.expected)
+			}
+		}
+	})
+}
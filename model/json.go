@@ -0,0 +1,319 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Extras holds any properties of an RTT object which aren't modelled by its struct, keyed by JSON name
+type Extras map[string]json.RawMessage
+
+// jsonField describes a struct field which is read from and written to an RTT JSON object
+type jsonField struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// cache of the JSON fields for each model type, these never change once computed
+var jsonFieldCache sync.Map
+
+// jsonFields returns the tagged fields of a struct type, in declaration order
+func jsonFields(t reflect.Type) []jsonField {
+	if cached, ok := jsonFieldCache.Load(t); ok {
+		return cached.([]jsonField)
+	}
+
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		// skip unexported bookkeeping fields and anything explicitly hidden from JSON
+		tag := f.Tag.Get("json")
+		if f.PkgPath != "" || tag == "-" {
+			continue
+		}
+
+		// the tag name takes priority, falling back on the Go field name
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+		if name == "" {
+			name = f.Name
+		}
+
+		field := jsonField{name: name, index: i}
+		for _, opt := range opts[1:] {
+			if opt == "omitempty" {
+				field.omitEmpty = true
+			}
+		}
+		fields = append(fields, field)
+	}
+
+	jsonFieldCache.Store(t, fields)
+	return fields
+}
+
+// isEmptyValue mirrors the omitempty rules used by encoding/json
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// fieldFor finds the field a property decodes into, preferring an exact match of its name
+// and falling back on a case-insensitive one, the same as encoding/json
+func fieldFor(fields []jsonField, key string) (jsonField, bool) {
+	for _, f := range fields {
+		if f.name == key {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, key) {
+			return f, true
+		}
+	}
+	return jsonField{}, false
+}
+
+// unmarshalObject decodes a JSON object into the struct pointed to by v, returning properties which
+// didn't match a field
+func unmarshalObject(data []byte, v interface{}) (Extras, error) {
+
+	// null leaves the struct untouched, the same as encoding/json
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("cannot unmarshal %v into %T", token, v)
+	}
+
+	target := reflect.ValueOf(v).Elem()
+	fields := jsonFields(target.Type())
+
+	var extras Extras
+	for decoder.More() {
+
+		// read the next key and its undecoded value
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := token.(string)
+
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return nil, err
+		}
+
+		// unknown properties are kept as they were given
+		f, ok := fieldFor(fields, key)
+		if !ok {
+			if extras == nil {
+				extras = make(Extras)
+			}
+			extras[key] = raw
+			continue
+		}
+
+		if err := json.Unmarshal(raw, target.Field(f.index).Addr().Interface()); err != nil {
+			return nil, err
+		}
+	}
+
+	// consume the closing brace
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	return extras, nil
+}
+
+// marshalValue encodes a single value without HTML escaping, leaving that to the outer encoder
+func marshalValue(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// marshalObject encodes a struct as a JSON object, writing the properties in the given order followed by
+// the rest of its fields, as encoding/json would write them, then any remaining extra properties by name.
+// Each known field is encoded by value, which is given the field and the path to the property
+func marshalObject(source reflect.Value, extras Extras, order []string, value func(reflect.Value, string) ([]byte, error)) ([]byte, error) {
+
+	fields := jsonFields(source.Type())
+
+	// work out which property each key is written from, a field or an extra
+	type property struct {
+		key   string
+		field int
+	}
+	var (
+		properties []property
+		written    = make(map[string]bool)
+		fieldDone  = make(map[int]bool)
+	)
+	for _, key := range order {
+		if f, ok := fieldFor(fields, key); ok && !fieldDone[f.index] {
+			fieldDone[f.index] = true
+			properties = append(properties, property{key, f.index})
+			written[key] = true
+		} else if _, ok := extras[key]; ok && !written[key] {
+			properties = append(properties, property{key, -1})
+			written[key] = true
+		}
+	}
+	for _, f := range fields {
+		if fieldDone[f.index] || (f.omitEmpty && isEmptyValue(source.Field(f.index))) {
+			continue
+		}
+		properties = append(properties, property{f.name, f.index})
+	}
+	var remaining []string
+	for key := range extras {
+		if !written[key] {
+			remaining = append(remaining, key)
+		}
+	}
+	sort.Strings(remaining)
+	for _, key := range remaining {
+		properties = append(properties, property{key, -1})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, p := range properties {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		name, err := marshalValue(p.key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+
+		// known fields are encoded from the struct, extras are written back untouched
+		if p.field == -1 {
+			buf.Write(extras[p.key])
+			continue
+		}
+		encoded, err := value(source.Field(p.field), p.key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(encoded)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// marshalModel encodes a model struct in the order encoding/json would, followed by its extra properties
+func marshalModel(v interface{}, extras Extras) ([]byte, error) {
+	return marshalObject(reflect.ValueOf(v), extras, nil, func(field reflect.Value, _ string) ([]byte, error) {
+		return marshalValue(field.Interface())
+	})
+}
+
+// MarshalJSON writes the lineup back out as RTT JSON, keeping its extra properties
+func (l Lineup) MarshalJSON() ([]byte, error) {
+	return marshalModel(l, l.Extras)
+}
+
+// UnmarshalJSON reads RTT JSON into the lineup, keeping properties it doesn't model in Extras
+func (l *Lineup) UnmarshalJSON(data []byte) (err error) {
+	l.Extras, err = unmarshalObject(data, l)
+	return err
+}
+
+// MarshalJSON writes the header back out as RTT JSON, keeping its extra properties
+func (h LocationDetailHeader) MarshalJSON() ([]byte, error) {
+	return marshalModel(h, h.Extras)
+}
+
+// UnmarshalJSON reads RTT JSON into the header, keeping properties it doesn't model in Extras
+func (h *LocationDetailHeader) UnmarshalJSON(data []byte) (err error) {
+	h.Extras, err = unmarshalObject(data, h)
+	return err
+}
+
+// MarshalJSON writes the container back out as RTT JSON, keeping its extra properties
+func (c LocationContainer) MarshalJSON() ([]byte, error) {
+	return marshalModel(c, c.Extras)
+}
+
+// UnmarshalJSON reads RTT JSON into the container, keeping properties it doesn't model in Extras
+func (c *LocationContainer) UnmarshalJSON(data []byte) (err error) {
+	c.Extras, err = unmarshalObject(data, c)
+	return err
+}
+
+// MarshalJSON writes the service back out as RTT JSON, keeping its extra properties
+func (s Service) MarshalJSON() ([]byte, error) {
+	return marshalModel(s, s.Extras)
+}
+
+// UnmarshalJSON reads RTT JSON into the service, keeping properties it doesn't model in Extras
+func (s *Service) UnmarshalJSON(data []byte) (err error) {
+	s.Extras, err = unmarshalObject(data, s)
+	return err
+}
+
+// MarshalJSON writes the pair back out as RTT JSON, keeping its extra properties
+func (p Pair) MarshalJSON() ([]byte, error) {
+	return marshalModel(p, p.Extras)
+}
+
+// UnmarshalJSON reads RTT JSON into the pair, keeping properties it doesn't model in Extras
+func (p *Pair) UnmarshalJSON(data []byte) (err error) {
+	p.Extras, err = unmarshalObject(data, p)
+	return err
+}
+
+// MarshalJSON writes the location back out as RTT JSON, keeping its extra properties
+func (d LocationDetail) MarshalJSON() ([]byte, error) {
+	return marshalModel(d.withAliases(), d.Extras)
+}
+
+// UnmarshalJSON reads RTT JSON into the location, keeping properties it doesn't model in Extras
+func (d *LocationDetail) UnmarshalJSON(data []byte) (err error) {
+	d.Extras, err = unmarshalObject(data, d)
+	d.RealTimeWTTArrivalLatenessDetailed = d.RealTimeWTTArrivalLateness
+	return err
+}
+
+// withAliases fills in fields from their deprecated aliases, for locations built by older code
+func (d LocationDetail) withAliases() LocationDetail {
+	if d.RealTimeWTTArrivalLateness == 0 {
+		d.RealTimeWTTArrivalLateness = d.RealTimeWTTArrivalLatenessDetailed
+	}
+	return d
+}
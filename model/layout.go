@@ -0,0 +1,184 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Layout records the order of the properties in every object of a piece of RTT JSON, keyed by
+// the path to the object in the same form as Warning paths, e.g. "locations[3].origin[0]".
+// It keeps what the model structs can't hold themselves, like properties explicitly set to false
+type Layout map[string][]string
+
+// UnmarshalLossless decodes RTT JSON into v, returning its layout so MarshalLossless can write it back out exactly
+func UnmarshalLossless(data []byte, v interface{}) (Layout, error) {
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	return ReadLayout(data)
+}
+
+// ReadLayout records the layout of RTT JSON without decoding it, for JSON decoded some other way
+func ReadLayout(data []byte) (Layout, error) {
+	layout := make(Layout)
+	return layout, layout.record(data, "")
+}
+
+// MarshalLossless encodes v, writing each object's properties in the order given by a layout from
+// UnmarshalLossless, including those with zero values. Fields set since decoding follow the
+// original properties, then any extra properties which weren't in the original JSON
+func MarshalLossless(v interface{}, layout Layout) ([]byte, error) {
+	return layout.marshal(reflect.ValueOf(v), "")
+}
+
+// record adds the key order of the object at path, and of every object inside it
+func (l Layout) record(data json.RawMessage, path string) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil
+	}
+
+	switch data[0] {
+	case '[':
+		var elements []json.RawMessage
+		if err := json.Unmarshal(data, &elements); err != nil {
+			return err
+		}
+		for i, element := range elements {
+			if err := l.record(element, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+
+	case '{':
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+
+		keys := []string{}
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return err
+			}
+			key := token.(string)
+
+			var value json.RawMessage
+			if err := decoder.Decode(&value); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+			if err := l.record(value, joinPath(path, key)); err != nil {
+				return err
+			}
+		}
+		l[path] = keys
+	}
+	return nil
+}
+
+// marshal encodes the value at path, following the layout for any objects inside it
+func (l Layout) marshal(v reflect.Value, path string) ([]byte, error) {
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return []byte("null"), nil
+		}
+		return l.marshal(v.Elem(), path)
+
+	case reflect.Slice:
+		if v.IsNil() {
+			return []byte("null"), nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			element, err := l.marshal(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(element)
+		}
+		buf.WriteByte(']')
+		return buf.Bytes(), nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return []byte("null"), nil
+		}
+		if v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		return l.marshalMap(v, path)
+
+	case reflect.Struct:
+		if d, ok := v.Interface().(LocationDetail); ok {
+			v = reflect.ValueOf(d.withAliases())
+		}
+
+		var extras Extras
+		if field := v.FieldByName("Extras"); field.IsValid() && field.Type() == reflect.TypeOf(Extras{}) {
+			extras = field.Interface().(Extras)
+		}
+		return marshalObject(v, extras, l[path], func(field reflect.Value, key string) ([]byte, error) {
+			return l.marshal(field, joinPath(path, key))
+		})
+	}
+
+	return marshalValue(v.Interface())
+}
+
+// marshalMap encodes a map as an object, with its keys in their recorded order then the rest by name
+func (l Layout) marshalMap(v reflect.Value, path string) ([]byte, error) {
+
+	var keys []string
+	written := make(map[string]bool)
+	for _, key := range l[path] {
+		if v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())).IsValid() && !written[key] {
+			keys = append(keys, key)
+			written[key] = true
+		}
+	}
+	var remaining []string
+	for _, key := range v.MapKeys() {
+		if !written[key.String()] {
+			remaining = append(remaining, key.String())
+		}
+	}
+	sort.Strings(remaining)
+	keys = append(keys, remaining...)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := marshalValue(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+
+		value, err := l.marshal(v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key())), joinPath(path, key))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
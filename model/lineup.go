@@ -0,0 +1,170 @@
+package model
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Cancelled reports whether the service has been cancelled at this location
+func (d LocationDetail) Cancelled() bool {
+	return d.CancelReasonCode != "" || strings.HasPrefix(d.DisplayAs, "CANCELLED")
+}
+
+// HasRealtime reports whether RTT has realtime data for this location, without which the realtime
+// times fall back on the booked ones
+func (d LocationDetail) HasRealtime() bool {
+	return d.RealTimeActivated && (d.RealTimeArrival != "" || d.RealTimeDeparture != "" || d.RealTimePass != "")
+}
+
+// Cancelled reports whether the service is cancelled in the timetable or has been cancelled at the lineup's location
+func (c LocationContainer) Cancelled() bool {
+	return c.PlannedCancel || c.LocationDetail.Cancelled()
+}
+
+// BookedTime returns when the service is booked at the lineup's location, using the departure
+// where there is one, falling back on the arrival for terminating services and the pass otherwise
+func (c LocationContainer) BookedTime() (time.Time, error) {
+	return c.boardTime(c.RunDate, false)
+}
+
+// RealtimeTime returns the realtime equivalent of BookedTime, using booked times where RTT has no realtime data
+func (c LocationContainer) RealtimeTime() (time.Time, error) {
+	return c.boardTime(c.RunDate, true)
+}
+
+// Where returns a new lineup containing only the services for which keep returns true, in their original order
+func (l Lineup) Where(keep func(LocationContainer) bool) Lineup {
+	filtered := l
+	filtered.Services = nil
+	for _, service := range l.Services {
+		if keep(service) {
+			filtered.Services = append(filtered.Services, service)
+		}
+	}
+	return filtered
+}
+
+// contains checks whether s is one of the given options
+func contains(options []string, s string) bool {
+	for _, option := range options {
+		if option == s {
+			return true
+		}
+	}
+	return false
+}
+
+// WithOperator keeps services run by any of the given ATOC codes, e.g. SW
+func (l Lineup) WithOperator(atocCodes ...string) Lineup {
+	return l.Where(func(c LocationContainer) bool {
+		return contains(atocCodes, c.ATOCCode)
+	})
+}
+
+// WithPlatform keeps services using any of the given platforms at the lineup's location
+func (l Lineup) WithPlatform(platforms ...string) Lineup {
+	return l.Where(func(c LocationContainer) bool {
+		return contains(platforms, c.Platform)
+	})
+}
+
+// WithServiceType keeps services of any of the given types
+func (l Lineup) WithServiceType(types ...ServiceType) Lineup {
+	return l.Where(func(c LocationContainer) bool {
+		for _, t := range types {
+			if ServiceType(c.ServiceType) == t {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithDestination keeps services terminating at any of the given TIPLOCs
+func (l Lineup) WithDestination(tiplocs ...string) Lineup {
+	return l.Where(func(c LocationContainer) bool {
+
+		// RTT gives destinations within the location detail, but check the container's too
+		for _, destinations := range [][]Pair{c.LocationDetail.Destination, c.Destination} {
+			for _, destination := range destinations {
+				if contains(tiplocs, destination.TIPLOC) {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// PassengerOnly keeps services which carry passengers
+func (l Lineup) PassengerOnly() Lineup {
+	return l.Where(func(c LocationContainer) bool {
+		return c.IsPassenger
+	})
+}
+
+// WithoutCancelled drops services which are cancelled in the timetable or at the lineup's location
+func (l Lineup) WithoutCancelled() Lineup {
+	return l.Where(func(c LocationContainer) bool {
+		return !c.Cancelled()
+	})
+}
+
+// BookedBetween keeps services booked at the lineup's location from start up to, but not including, end
+func (l Lineup) BookedBetween(start, end time.Time) Lineup {
+	return l.Where(func(c LocationContainer) bool {
+		t, err := c.BookedTime()
+		return err == nil && !t.Before(start) && t.Before(end)
+	})
+}
+
+// RealtimeBetween keeps services expected at the lineup's location from start up to, but not including, end
+func (l Lineup) RealtimeBetween(start, end time.Time) Lineup {
+	return l.Where(func(c LocationContainer) bool {
+		t, err := c.RealtimeTime()
+		return err == nil && !t.Before(start) && t.Before(end)
+	})
+}
+
+// sortBy returns a new lineup ordered by the given time, services without a time keep their order at the end
+func (l Lineup) sortBy(key func(LocationContainer) (time.Time, error)) Lineup {
+
+	type entry struct {
+		service LocationContainer
+		time    time.Time
+		ok      bool
+	}
+
+	entries := make([]entry, len(l.Services))
+	for i, service := range l.Services {
+		t, err := key(service)
+		entries[i] = entry{service: service, time: t, ok: err == nil}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		switch {
+		case entries[i].ok && entries[j].ok:
+			return entries[i].time.Before(entries[j].time)
+		default:
+			return entries[i].ok && !entries[j].ok
+		}
+	})
+
+	sorted := l
+	sorted.Services = make([]LocationContainer, len(entries))
+	for i, e := range entries {
+		sorted.Services[i] = e.service
+	}
+	return sorted
+}
+
+// SortByBooked returns a new lineup ordered by booked time at the lineup's location, see BookedTime
+func (l Lineup) SortByBooked() Lineup {
+	return l.sortBy(LocationContainer.BookedTime)
+}
+
+// SortByRealtime returns a new lineup ordered by realtime at the lineup's location, see RealtimeTime
+func (l Lineup) SortByRealtime() Lineup {
+	return l.sortBy(LocationContainer.RealtimeTime)
+}
@@ -0,0 +1,189 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+// boardLineup is a late evening departure board, with services either side of midnight
+var boardLineup = Lineup{
+	Location: LocationDetailHeader{Name: "Bournemouth", CRS: "BMH", TIPLOC: "BOMO"},
+	Services: []LocationContainer{
+		{
+			ServiceUID: "A", RunDate: "2020-02-12", ATOCCode: "SW", ServiceType: "train", IsPassenger: true,
+			LocationDetail: LocationDetail{
+				GBTTBookedDeparture: "0005", GBTTBookedDepartureNextDay: true,
+				RealTimeDeparture: "0007", RealTimeDepartureNextDay: true,
+				Platform:    "3",
+				Destination: []Pair{{TIPLOC: "POOLE"}},
+			},
+		},
+		{
+			ServiceUID: "B", RunDate: "2020-02-12", ATOCCode: "XC", ServiceType: "train", IsPassenger: true,
+			LocationDetail: LocationDetail{
+				GBTTBookedDeparture: "2350",
+				RealTimeDeparture:   "0010", RealTimeDepartureNextDay: true,
+				Platform:    "4",
+				Destination: []Pair{{TIPLOC: "MNCRPIC"}},
+			},
+		},
+		{
+			ServiceUID: "C", RunDate: "2020-02-12", ATOCCode: "SW", ServiceType: "bus", IsPassenger: true,
+			PlannedCancel: true,
+			LocationDetail: LocationDetail{
+				GBTTBookedDeparture: "2355",
+				Destination:         []Pair{{TIPLOC: "POOLE"}},
+			},
+		},
+		{
+			ServiceUID: "D", RunDate: "2020-02-12", ATOCCode: "SW", ServiceType: "train",
+			LocationDetail: LocationDetail{
+				WTTBookedPass: "235900",
+				RealTimePass:  "2358",
+				Platform:      "3",
+			},
+		},
+		{
+			ServiceUID: "E", RunDate: "2020-02-12", ATOCCode: "SW", ServiceType: "train", IsPassenger: true,
+			LocationDetail: LocationDetail{
+				GBTTBookedArrival: "2340",
+				RealTimeArrival:   "2345",
+				DisplayAs:         "CANCELLED_CALL",
+				CancelReasonCode:  "TG",
+				Platform:          "4",
+			},
+		},
+		{
+			ServiceUID: "F", RunDate: "2020-02-12", ATOCCode: "SW", ServiceType: "train", IsPassenger: true,
+		},
+		{
+			ServiceUID: "G", RunDate: "2020-02-12", ATOCCode: "DB", ServiceType: "train",
+			LocationDetail: LocationDetail{
+				WTTBookedDeparture: "000230",
+				Origin:             []Pair{{TIPLOC: "EASTLGH", WorkingTime: "231000"}},
+			},
+		},
+		{
+			ServiceUID: "H", RunDate: "2020-02-12", ATOCCode: "SW", ServiceType: "train",
+			LocationDetail: LocationDetail{
+				WTTBookedPass: "003000",
+				RealTimePass:  "0032",
+				Origin:        []Pair{{TIPLOC: "WATRLMN", WorkingTime: "230500"}},
+			},
+		},
+	},
+}
+
+// uids lists the service UIDs of a lineup, in order
+func uids(l Lineup) string {
+	var s string
+	for _, service := range l.Services {
+		s += service.ServiceUID
+	}
+	return s
+}
+
+func TestParseTime(t *testing.T) {
+
+	ts := []struct {
+		runDate, clock string
+		nextDay        bool
+		expected       time.Time
+		err            error
+	}{
+		{"2020-02-12", "2337", false, time.Date(2020, 2, 12, 23, 37, 0, 0, London), nil},
+		{"2020-02-12", "0026", true, time.Date(2020, 2, 13, 0, 26, 0, 0, London), nil},
+		{"2020-02-12", "011630", false, time.Date(2020, 2, 12, 1, 16, 30, 0, London), nil},
+		{"2020-12-31", "0001", true, time.Date(2021, 1, 1, 0, 1, 0, 0, London), nil},
+		{"2020-07-01", "1200", false, time.Date(2020, 7, 1, 11, 0, 0, 0, time.UTC), nil},
+		{"2020-02-12", "", false, time.Time{}, ErrNoTime},
+		{"2020-02-12", "25:0", false, time.Time{}, ErrBadTime},
+		{"2020-02-12", "2460", false, time.Time{}, ErrBadTime},
+		{"2020-02-12", "123", false, time.Time{}, ErrBadTime},
+	}
+
+	for _, tc := range ts {
+		got, err := ParseTime(tc.runDate, tc.clock, tc.nextDay)
+		switch {
+		case err != tc.err:
+			t.Errorf("Got wrong error for %+v, got %v, expected %v", tc, err, tc.err)
+		case !got.Equal(tc.expected):
+			t.Errorf("Got wrong time for %+v, got %v, expected %v", tc, got, tc.expected)
+		}
+	}
+}
+
+func TestAfterMidnight(t *testing.T) {
+
+	// a service leaving its origin at 2305, passing and calling either side of midnight
+	origin := []Pair{{TIPLOC: "WATRLMN", WorkingTime: "230500", PublicTime: "2305"}}
+	ts := []struct {
+		name     string
+		get      func(string) (time.Time, error)
+		expected time.Time
+	}{
+		{"pass-before", LocationDetail{WTTBookedPass: "233000", Origin: origin}.BookedPassTime,
+			time.Date(2020, 2, 12, 23, 30, 0, 0, London)},
+		{"pass-after", LocationDetail{WTTBookedPass: "003000", Origin: origin}.BookedPassTime,
+			time.Date(2020, 2, 13, 0, 30, 0, 0, London)},
+		{"realtime-pass-late", LocationDetail{WTTBookedPass: "235900", RealTimePass: "0004", Origin: origin}.RealtimePassTime,
+			time.Date(2020, 2, 13, 0, 4, 0, 0, London)},
+		{"realtime-pass-early", LocationDetail{WTTBookedPass: "000100", RealTimePass: "2358", Origin: origin}.RealtimePassTime,
+			time.Date(2020, 2, 12, 23, 58, 0, 0, London)},
+		{"working-arrival", LocationDetail{WTTBookedArrival: "011630", Origin: origin}.WorkingArrivalTime,
+			time.Date(2020, 2, 13, 1, 16, 30, 0, London)},
+		{"working-departure-flagged", LocationDetail{WTTBookedDeparture: "000030", GBTTBookedDepartureNextDay: true}.WorkingDepartureTime,
+			time.Date(2020, 2, 13, 0, 0, 30, 0, London)},
+		{"no-origin", LocationDetail{WTTBookedPass: "003000"}.BookedPassTime,
+			time.Date(2020, 2, 12, 0, 30, 0, 0, London)},
+	}
+
+	for _, tc := range ts {
+		got, err := tc.get("2020-02-12")
+		switch {
+		case err != nil:
+			t.Errorf("%s: Got error %v", tc.name, err)
+		case !got.Equal(tc.expected):
+			t.Errorf("%s: Got wrong time, got %v, expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestLineupFilters(t *testing.T) {
+
+	var (
+		start = time.Date(2020, 2, 12, 23, 50, 0, 0, London)
+		end   = time.Date(2020, 2, 13, 0, 6, 0, 0, London)
+	)
+
+	ts := []struct {
+		name     string
+		got      Lineup
+		expected string
+	}{
+		{"operator", boardLineup.WithOperator("XC"), "B"},
+		{"operators", boardLineup.WithOperator("XC", "SW"), "ABCDEFH"},
+		{"platform", boardLineup.WithPlatform("3"), "AD"},
+		{"service-type", boardLineup.WithServiceType(BusService), "C"},
+		{"destination", boardLineup.WithDestination("POOLE"), "AC"},
+		{"passenger", boardLineup.PassengerOnly(), "ABCEF"},
+		{"cancelled", boardLineup.WithoutCancelled(), "ABDFGH"},
+		{"booked-window", boardLineup.BookedBetween(start, end), "ABCDG"},
+		{"realtime-window", boardLineup.RealtimeBetween(start, end), "CDG"},
+		{"chained", boardLineup.PassengerOnly().WithoutCancelled().WithPlatform("3", "4"), "AB"},
+		{"sort-booked", boardLineup.SortByBooked(), "EBCDGAHF"},
+		{"sort-realtime", boardLineup.SortByRealtime(), "ECDGABHF"},
+		{"where", boardLineup.Where(func(c LocationContainer) bool { return c.ServiceUID > "D" }), "EFGH"},
+	}
+
+	for _, tc := range ts {
+		if got := uids(tc.got); got != tc.expected {
+			t.Errorf("%s: Got wrong services, got %s, expected %s", tc.name, got, tc.expected)
+		}
+	}
+
+	// filters leave the original lineup alone
+	if got := uids(boardLineup); got != "ABCDEFGH" {
+		t.Errorf("Original lineup changed, got %s", got)
+	}
+}
@@ -5,6 +5,12 @@ type Lineup struct {
 	Location LocationDetailHeader      `json:"location,omitempty"`
 	Filter   map[string]LocationDetail `json:"filter,omitempty"`
 	Services []LocationContainer       `json:"services,omitempty"`
+
+	Extras   Extras   `json:"-"`
+	Warnings Warnings `json:"-"`
+
+	// Layout is the layout of the JSON the lineup was fetched from, if it came from the API or an archive
+	Layout Layout `json:"-"`
 }
 
 // LocationDetailHeader describes the shorthand location used in the query
@@ -12,6 +18,8 @@ type LocationDetailHeader struct {
 	Name   string `json:"name,omitempty"`
 	CRS    string `json:"crs,omitempty"`
 	TIPLOC string `json:"tiploc,omitempty"`
+
+	Extras Extras `json:"-"`
 }
 
 // LocationContainer contains a description of a service which is running for a lineup
@@ -29,4 +37,6 @@ type LocationContainer struct {
 	Origin           []Pair `json:"origin,omitempty"`
 	Destination      []Pair `json:"destination,omitempty"`
 	CountdownMinutes int    `json:"countdownMinutes,omitempty"`
+
+	Extras Extras `json:"-"`
 }
@@ -1,17 +1,21 @@
 package model
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"reflect"
+	"strings"
 	"testing"
 )
 
 const (
-	lineupFile  = "lineup.json"
-	serviceFile = "service.json"
+	lineupFile   = "lineup.json"
+	serviceFile  = "service.json"
+	latenessFile = "lateness.json"
 )
 
 var (
@@ -333,3 +337,282 @@ func TestService(t *testing.T) {
 		})
 	})
 }
+
+func TestRoundTrip(t *testing.T) {
+
+	// decodes a fixture into v, checking it encodes back losslessly to the same compacted JSON
+	roundTrip := func(t *testing.T, file string, v interface{}) {
+		pwd, err := os.Getwd()
+		if err != nil {
+			t.Fatalf("Could not load test data, got error %s", err.Error())
+		}
+
+		original, err := ioutil.ReadFile(path.Join(pwd, "expected", file))
+		if err != nil {
+			t.Fatalf("Could not read %s, got error %s", file, err.Error())
+		}
+
+		var expected bytes.Buffer
+		if err := json.Compact(&expected, original); err != nil {
+			t.Fatalf("Could not compact %s, got error %s", file, err.Error())
+		}
+
+		layout, err := UnmarshalLossless(original, v)
+		if err != nil {
+			t.Fatalf("Could not decode %s, got error %s", file, err.Error())
+		}
+
+		got, err := MarshalLossless(v, layout)
+		if err != nil {
+			t.Fatalf("Could not encode %s, got error %s", file, err.Error())
+		}
+
+		if !bytes.Equal(got, expected.Bytes()) {
+			t.Errorf("Round trip mismatch for %s\nGot %s\nExpected %s", file, got, expected.Bytes())
+		}
+	}
+
+	t.Run("lineup", func(t *testing.T) {
+		roundTrip(t, lineupFile, &Lineup{})
+	})
+
+	t.Run("service", func(t *testing.T) {
+		roundTrip(t, serviceFile, &Service{})
+	})
+
+	t.Run("lateness", func(t *testing.T) {
+		roundTrip(t, latenessFile, &Service{})
+	})
+
+	t.Run("extras", func(t *testing.T) {
+		original := `{"tiploc":"POOLE","unknownFlag":false,"description":"Poole","extra":{"a":[1,2]}}`
+
+		var pair Pair
+		layout, err := UnmarshalLossless([]byte(original), &pair)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch {
+		case pair.TIPLOC != "POOLE" || pair.Description != "Poole":
+			t.Errorf("Got wrong known fields, got %+v", pair)
+		case string(pair.Extras["unknownFlag"]) != "false":
+			t.Errorf("Got wrong extra unknownFlag, got %s", pair.Extras["unknownFlag"])
+		case string(pair.Extras["extra"]) != `{"a":[1,2]}`:
+			t.Errorf("Got wrong extra extra, got %s", pair.Extras["extra"])
+		}
+
+		got, err := MarshalLossless(pair, layout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != original {
+			t.Errorf("Round trip mismatch\nGot %s\nExpected %s", got, original)
+		}
+
+		// without the layout, extras follow the modelled fields in name order
+		expected := `{"tiploc":"POOLE","description":"Poole","extra":{"a":[1,2]},"unknownFlag":false}`
+		if got, err := json.Marshal(pair); err != nil || string(got) != expected {
+			t.Errorf("Got wrong encoding\nGot %s\nExpected %s", got, expected)
+		}
+	})
+
+	t.Run("modified", func(t *testing.T) {
+		var detail LocationDetail
+		layout, err := UnmarshalLossless([]byte(`{"tiploc":"POOLE","platformConfirmed":false}`), &detail)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// fields set after decoding follow the original properties
+		detail.Platform = "2"
+		detail.Extras = Extras{"new": json.RawMessage(`true`)}
+
+		expected := `{"tiploc":"POOLE","platformConfirmed":false,"platform":"2","new":true}`
+		got, err := MarshalLossless(detail, layout)
+		switch {
+		case err != nil:
+			t.Fatal(err)
+		case string(got) != expected:
+			t.Errorf("Got wrong encoding\nGot %s\nExpected %s", got, expected)
+		}
+	})
+
+	t.Run("case-insensitive", func(t *testing.T) {
+		original := `{"TIPLOC":"POOLE","Description":"Poole"}`
+
+		var pair Pair
+		layout, err := UnmarshalLossless([]byte(original), &pair)
+		switch {
+		case err != nil:
+			t.Fatal(err)
+		case pair.TIPLOC != "POOLE" || pair.Description != "Poole" || pair.Extras != nil:
+			t.Errorf("Got wrong pair, got %+v", pair)
+		}
+
+		if got, err := MarshalLossless(pair, layout); err != nil || string(got) != original {
+			t.Errorf("Round trip mismatch\nGot %s\nExpected %s", got, original)
+		}
+	})
+
+	t.Run("unmodified", func(t *testing.T) {
+		got, err := json.Marshal(expectedLineup)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded Lineup
+		if err := json.Unmarshal(got, &decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		// values built in code encode as before, so decode back to the same struct
+		if !reflect.DeepEqual(decoded, expectedLineup) {
+			t.Errorf("Lineup struct mismatch\nGot %+v\nExpected %+v", decoded, expectedLineup)
+		}
+	})
+}
+
+func TestDecodeStrict(t *testing.T) {
+
+	t.Run("fixtures", func(t *testing.T) {
+		for _, file := range []string{lineupFile, serviceFile, latenessFile} {
+			pwd, err := os.Getwd()
+			if err != nil {
+				t.Fatalf("Could not load test data, got error %s", err.Error())
+			}
+
+			reader, err := os.Open(path.Join(pwd, "expected", file))
+			if err != nil {
+				t.Fatalf("Could not open %s, got error %s", file, err.Error())
+			}
+			defer reader.Close()
+
+			var service Service
+			var lineup Lineup
+			var target interface{} = &lineup
+			if file != lineupFile {
+				target = &service
+			}
+
+			warnings, err := DecodeStrict(reader, target)
+			switch {
+			case err != nil:
+				t.Errorf("Could not decode %s, got error %s", file, err.Error())
+			case len(warnings) != 0:
+				t.Errorf("Got unexpected warnings for %s, got %+v", file, warnings)
+			}
+		}
+	})
+
+	t.Run("mismatches", func(t *testing.T) {
+		body := `{
+			"location": {"name": "Bournemouth", "crs": 12},
+			"services": [
+				{"serviceUid": "W90091", "isPassenger": "yes", "newThing": {"a": 1}},
+				{"serviceUid": "W90092", "locationDetail": {"platform": "3", "realtimeGbttArrivalLateness": 1.5}}
+			],
+			"extra": true
+		}`
+
+		var lineup Lineup
+		warnings, err := DecodeStrict(strings.NewReader(body), &lineup)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := Warnings{
+			{Kind: MistypedProperty, Path: "location.crs", Value: json.RawMessage(`12`)},
+			{Kind: MistypedProperty, Path: "services[0].isPassenger", Value: json.RawMessage(`"yes"`)},
+			{Kind: UnknownProperty, Path: "services[0].newThing", Value: json.RawMessage(`{"a": 1}`)},
+			{Kind: MistypedProperty, Path: "services[1].locationDetail.realtimeGbttArrivalLateness", Value: json.RawMessage(`1.5`)},
+			{Kind: UnknownProperty, Path: "extra", Value: json.RawMessage(`true`)},
+		}
+		if !reflect.DeepEqual(warnings, expected) {
+			t.Errorf("Got wrong warnings\nGot %+v\nExpected %+v", warnings, expected)
+		}
+
+		// everything else is still decoded
+		switch {
+		case lineup.Location.Name != "Bournemouth":
+			t.Errorf("Got wrong location name, got %s", lineup.Location.Name)
+		case len(lineup.Services) != 2:
+			t.Fatalf("Got wrong number of services, got %d", len(lineup.Services))
+		case lineup.Services[1].Platform != "3":
+			t.Errorf("Got wrong platform, got %s", lineup.Services[1].Platform)
+		case string(lineup.Services[0].Extras["newThing"]) != `{"a": 1}`:
+			t.Errorf("Got wrong extras, got %+v", lineup.Services[0].Extras)
+		}
+	})
+
+	t.Run("not-an-object", func(t *testing.T) {
+		var service Service
+		warnings, err := DecodeStrict(strings.NewReader(`[1, 2]`), &service)
+		if typeErr, ok := err.(*json.UnmarshalTypeError); !ok || typeErr.Value != "array" {
+			t.Errorf("Got wrong error, got %v, expected a type error for an array", err)
+		}
+		switch {
+		case len(warnings) != 1 || warnings[0].Kind != MistypedProperty || warnings[0].Path != "":
+			t.Errorf("Got wrong warnings, got %+v", warnings)
+		}
+	})
+}
+
+func TestLateness(t *testing.T) {
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Could not load test data, got error %s", err.Error())
+	}
+
+	jsonReader, err := os.Open(path.Join(pwd, "expected", latenessFile))
+	if err != nil {
+		t.Fatalf("Could not open lateness file, got error %s", err.Error())
+	}
+	defer jsonReader.Close()
+
+	var gotService Service
+	if err := json.NewDecoder(jsonReader).Decode(&gotService); err != nil {
+		t.Fatalf("Could not decode lateness JSON from file reader, got error %s", err.Error())
+	}
+
+	// lateness in minutes, in the order GBTT arrival, WTT arrival, GBTT departure, WTT departure, GBTT pass, WTT pass
+	expected := map[string][6]int{
+		"WATRLMN": {0, 0, 4, 4, 0, 0},
+		"WOKING":  {0, 0, 0, 0, 5, 6},
+		"SOTON":   {7, 6, 5, 5, 0, 0},
+		"POOLE":   {2, 2, 0, 0, 0, 0},
+	}
+
+	if len(gotService.Locations) != len(expected) {
+		t.Fatalf("Got wrong number of locations, got %d, expected %d", len(gotService.Locations), len(expected))
+	}
+
+	for _, location := range gotService.Locations {
+		got := [6]int{
+			location.RealTimeGBTTArrivalLateness,
+			location.RealTimeWTTArrivalLateness,
+			location.RealTimeGBTTDepartureLateness,
+			location.RealTimeWTTDepartureLateness,
+			location.RealTimeGBTTPassLateness,
+			location.RealTimeWTTPassLateness,
+		}
+		if got != expected[location.TIPLOC] {
+			t.Errorf("Got wrong lateness for %s, got %v, expected %v", location.TIPLOC, got, expected[location.TIPLOC])
+		}
+		if location.RealTimeWTTArrivalLatenessDetailed != location.RealTimeWTTArrivalLateness {
+			t.Errorf("Got deprecated alias out of step for %s, got %d", location.TIPLOC, location.RealTimeWTTArrivalLatenessDetailed)
+		}
+	}
+
+	t.Run("deprecated-alias", func(t *testing.T) {
+		got, err := json.Marshal(LocationDetail{TIPLOC: "POOLE", RealTimeWTTArrivalLatenessDetailed: 3})
+		expected := `{"tiploc":"POOLE","realtimeWttArrivalLateness":3}`
+		switch {
+		case err != nil:
+			t.Fatal(err)
+		case string(got) != expected:
+			t.Errorf("Got wrong encoding\nGot %s\nExpected %s", got, expected)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+// Package modeltest builds model values for tests, so each package doesn't need its own fixture factory
+package modeltest
+
+import "github.com/georgeprice/realtime-trains-golang/model"
+
+// RunDate is the date services built by Service run on
+const RunDate = "2020-02-12"
+
+// Call is a stop on a test service, with booked and realtime times in HHMM format
+type Call struct {
+	CRS                        string
+	Arrival, Departure         string
+	RealArrival, RealDeparture string
+
+	// Actual marks the realtime times as actual rather than forecast
+	Actual, Cancelled bool
+}
+
+// Stop is a call with only booked times, use "" for a missing arrival or departure
+func Stop(crs, arrival, departure string) Call {
+	return Call{CRS: crs, Arrival: arrival, Departure: departure}
+}
+
+// TIPLOC is the made up TIPLOC of a station in services built by Service
+func TIPLOC(crs string) string {
+	return crs + "X"
+}
+
+// Service builds a passenger service running on RunDate, calling publicly at each stop and
+// heading for the last of them. Change any other fields on the returned service as needed
+func Service(uid string, calls ...Call) model.Service {
+	service := model.Service{
+		ServiceUID:        uid,
+		RunDate:           RunDate,
+		IsPassenger:       true,
+		RealtimeActivated: true,
+	}
+
+	for _, c := range calls {
+		location := model.LocationDetail{
+			TIPLOC:                  TIPLOC(c.CRS),
+			CRS:                     c.CRS,
+			GBTTBookedArrival:       c.Arrival,
+			GBTTBookedDeparture:     c.Departure,
+			RealTimeArrival:         c.RealArrival,
+			RealTimeArrivalActual:   c.Actual && c.RealArrival != "",
+			RealTimeDeparture:       c.RealDeparture,
+			RealTimeDepartureActual: c.Actual && c.RealDeparture != "",
+			IsCall:                  true,
+			IsCallPublic:            true,
+		}
+		if c.Cancelled {
+			location.DisplayAs = "CANCELLED_CALL"
+		}
+		service.Locations = append(service.Locations, location)
+	}
+
+	if len(service.Locations) > 0 {
+		last := service.Locations[len(service.Locations)-1]
+		service.Destination = []model.Pair{{TIPLOC: last.TIPLOC}}
+	}
+	return service
+}
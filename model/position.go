@@ -0,0 +1,132 @@
+package model
+
+import "time"
+
+// Position is an estimate of where a service is at a point in time, see Service.PositionAt
+type Position struct {
+
+	// Last is the index in Locations of the last location the service reached, -1 before it has started
+	Last int
+
+	// Next is the index in Locations of the next location the service will reach, -1 once it has finished
+	Next int
+
+	// Fraction is how far the service has got from Last to Next, by the time between them from 0 to 1
+	Fraction float64
+
+	// At is set when the service is stood at Last, rather than on its way to Next
+	At bool
+
+	// Stale is set when RTT had no report from locations the service should have reached since its
+	// last report, so the position is estimated from its timings
+	Stale bool
+}
+
+// RTT's serviceLocation values, where the train is in relation to a location
+const (
+	ApproachingStation  = "APPR_STAT"
+	ApproachingPlatform = "APPR_PLAT"
+	AtPlatform          = "AT_PLAT"
+	PreparingToDepart   = "DEP_PREP"
+	ReadyToDepart       = "DEP_READY"
+)
+
+// firstTime returns the first time RTT has of several
+func firstTime(runDate string, times ...func(string) (time.Time, error)) (time.Time, bool) {
+	for _, get := range times {
+		if t, err := get(runDate); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// reachTime returns when the service reaches a location, realtime where RTT has it
+func (d LocationDetail) reachTime(runDate string) (time.Time, bool) {
+	return firstTime(runDate, d.RealtimeArrivalTime, d.RealtimePassTime, d.BookedArrivalTime, d.BookedPassTime,
+		d.WorkingArrivalTime, d.RealtimeDepartureTime, d.BookedDepartureTime, d.WorkingDepartureTime)
+}
+
+// leaveTime returns when the service leaves a location, realtime where RTT has it
+func (d LocationDetail) leaveTime(runDate string) (time.Time, bool) {
+	return firstTime(runDate, d.RealtimeDepartureTime, d.RealtimePassTime, d.BookedDepartureTime, d.BookedPassTime,
+		d.WorkingDepartureTime, d.RealtimeArrivalTime, d.BookedArrivalTime, d.WorkingArrivalTime)
+}
+
+// reported checks whether RTT has an actual report of the service at a location
+func (d LocationDetail) reported() bool {
+	return d.RealTimeArrivalActual || d.RealTimeDepartureActual || d.RealTimePassActual
+}
+
+// noReport checks whether RTT expected a report from a location but didn't get one
+func (d LocationDetail) noReport() bool {
+	return d.RealTimeArrivalNoReport || d.RealTimeDepartureNoReport || d.RealTimePassNoReport
+}
+
+// PositionAt estimates where the service is at a point in time. The last location is the latest the
+// service has an actual report from, or that RTT says it is stood at. Locations without a report whose
+// time has passed count as reached too, but make the position stale. Between locations, the fraction
+// travelled is worked out from the time it left the last and the forecast or booked time at the next.
+// Cancelled locations are skipped
+func (s Service) PositionAt(now time.Time) Position {
+	position := Position{Last: -1, Next: -1}
+
+	approaching := -1
+	for i, location := range s.Locations {
+		if location.Cancelled() {
+			continue
+		}
+
+		switch location.ServiceLocation {
+		case AtPlatform, PreparingToDepart, ReadyToDepart:
+			position.Last, position.At, position.Stale = i, true, false
+			continue
+		case ApproachingStation, ApproachingPlatform:
+			approaching = i
+		}
+
+		switch {
+		case location.reported():
+			position.Last, position.Stale = i, false
+
+			// stood at a call, having arrived but not yet left
+			_, leaves := firstTime(s.RunDate, location.BookedDepartureTime, location.WorkingDepartureTime)
+			position.At = location.RealTimeArrivalActual && !location.RealTimeDepartureActual && leaves
+
+		case location.noReport():
+			if t, ok := location.reachTime(s.RunDate); ok && !t.After(now) {
+				position.Last, position.At, position.Stale = i, false, true
+			}
+		}
+	}
+
+	// the next location is the first after the last which isn't cancelled
+	for i := position.Last + 1; i < len(s.Locations); i++ {
+		if !s.Locations[i].Cancelled() {
+			position.Next = i
+			break
+		}
+	}
+	if approaching > position.Last {
+		position.Next = approaching
+	}
+
+	if position.Last == -1 || position.Next == -1 || position.At {
+		return position
+	}
+
+	from, ok := s.Locations[position.Last].leaveTime(s.RunDate)
+	if !ok {
+		return position
+	}
+	to, ok := s.Locations[position.Next].reachTime(s.RunDate)
+	switch {
+	case !ok || !now.After(from):
+		position.Fraction = 0
+	case !now.Before(to):
+		position.Fraction = 1
+	default:
+		position.Fraction = float64(now.Sub(from)) / float64(to.Sub(from))
+	}
+	return position
+}
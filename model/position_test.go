@@ -0,0 +1,84 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPositionAt(t *testing.T) {
+
+	// leaves A at 1000, passes B at 1010, calls at C 1020-1022 and terminates at D at 1040
+	journey := func(edit func(locations []LocationDetail)) Service {
+		service := Service{RunDate: "2020-02-12", Locations: []LocationDetail{
+			{TIPLOC: "A", GBTTBookedDeparture: "1000", IsCall: true},
+			{TIPLOC: "B", WTTBookedPass: "1010"},
+			{TIPLOC: "C", GBTTBookedArrival: "1020", GBTTBookedDeparture: "1022", IsCall: true},
+			{TIPLOC: "D", GBTTBookedArrival: "1040", IsCall: true},
+		}}
+		edit(service.Locations)
+		return service
+	}
+	at := func(clock string) time.Time {
+		t, err := ParseTime("2020-02-12", clock, false)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	departedA := func(l []LocationDetail) {
+		l[0].RealTimeDeparture, l[0].RealTimeDepartureActual = "1001", true
+		l[1].RealTimePass = "1011"
+	}
+	passedB := func(l []LocationDetail) {
+		departedA(l)
+		l[1].RealTimePassActual = true
+		l[2].RealTimeArrival, l[2].RealTimeDeparture = "1021", "1023"
+	}
+
+	ts := []struct {
+		name     string
+		service  Service
+		now      time.Time
+		expected Position
+	}{
+		{"not-started", journey(func([]LocationDetail) {}), at("0955"), Position{Last: -1, Next: 0}},
+		{"departed", journey(departedA), at("1006"), Position{Last: 0, Next: 1, Fraction: 0.5}},
+		{"passed", journey(passedB), at("1016"), Position{Last: 1, Next: 2, Fraction: 0.5}},
+		{"overdue", journey(passedB), at("1030"), Position{Last: 1, Next: 2, Fraction: 1}},
+		{"at-call", journey(func(l []LocationDetail) {
+			passedB(l)
+			l[2].RealTimeArrivalActual = true
+		}), at("1022"), Position{Last: 2, Next: 3, At: true}},
+		{"at-platform", journey(func(l []LocationDetail) {
+			passedB(l)
+			l[2].ServiceLocation = AtPlatform
+		}), at("1021"), Position{Last: 2, Next: 3, At: true}},
+		{"approaching", journey(func(l []LocationDetail) {
+			departedA(l)
+			l[2].ServiceLocation = ApproachingPlatform
+		}), at("101030"), Position{Last: 0, Next: 2, Fraction: 0.5}},
+		{"no-report", journey(func(l []LocationDetail) {
+			l[0].RealTimeDeparture, l[0].RealTimeDepartureActual = "1000", true
+			l[1].RealTimePassNoReport = true
+		}), at("1015"), Position{Last: 1, Next: 2, Fraction: 0.5, Stale: true}},
+		{"no-report-pending", journey(func(l []LocationDetail) {
+			l[0].RealTimeDeparture, l[0].RealTimeDepartureActual = "1000", true
+			l[1].RealTimePassNoReport = true
+		}), at("1005"), Position{Last: 0, Next: 1, Fraction: 0.5}},
+		{"cancelled-call", journey(func(l []LocationDetail) {
+			passedB(l)
+			l[2].DisplayAs = "CANCELLED_CALL"
+		}), at("102530"), Position{Last: 1, Next: 3, Fraction: 0.5}},
+		{"finished", journey(func(l []LocationDetail) {
+			passedB(l)
+			l[2].RealTimeArrivalActual, l[2].RealTimeDepartureActual = true, true
+			l[3].RealTimeArrival, l[3].RealTimeArrivalActual = "1041", true
+		}), at("1045"), Position{Last: 3, Next: -1}},
+	}
+
+	for _, tc := range ts {
+		if got := tc.service.PositionAt(tc.now); got != tc.expected {
+			t.Errorf("%s: Got wrong position, got %+v, expected %+v", tc.name, got, tc.expected)
+		}
+	}
+}
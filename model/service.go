@@ -31,6 +31,12 @@ type Service struct {
 	RealtimeActivated    bool             `json:"realtimeActivated,omitempty"`
 	RunningIdentity      string           `json:"runningIdentity,omitempty"`
 	PlannedCancel        bool             `json:"plannedCancel,omitempty"`
+
+	Extras   Extras   `json:"-"`
+	Warnings Warnings `json:"-"`
+
+	// Layout is the layout of the JSON the service was fetched from, if it came from the API or an archive
+	Layout Layout `json:"-"`
 }
 
 // Pair describes a start or end of a train's journey (don't ask)
@@ -39,6 +45,8 @@ type Pair struct {
 	Description string `json:"description,omitempty"`
 	WorkingTime string `json:"workingTime,omitempty"`
 	PublicTime  string `json:"publicTime,omitempty"`
+
+	Extras Extras `json:"-"`
 }
 
 // LocationDetail describes a station which is passed through between the origin and destination of a service
@@ -66,19 +74,28 @@ type LocationDetail struct {
 	RealTimeArrivalNoReport bool   `json:"realtimeArrivalNoReport,omitempty"`
 	RealTimeArrivalNextDay  bool   `json:"realtimeArrivalNextDay,omitempty"`
 
-	RealTimeGBTTArrivalLateness        int `json:"realtimeGbttArrivalLateness,omitempty"`
-	RealTimeWTTArrivalLateness         int `json:"realtimeWttDepartureLateness,omitempty"`
-	RealTimeWTTArrivalLatenessDetailed int `json:"realtimeWttArrivalLateness,omitempty"`
+	RealTimeGBTTArrivalLateness int `json:"realtimeGbttArrivalLateness,omitempty"`
+	RealTimeWTTArrivalLateness  int `json:"realtimeWttArrivalLateness,omitempty"`
+
+	// Deprecated: RealTimeWTTArrivalLateness now holds realtimeWttArrivalLateness, it used to hold the departure
+	// lateness by mistake. This is filled in with the same value when decoding, and written out when it is unset
+	RealTimeWTTArrivalLatenessDetailed int `json:"-"`
 
 	RealTimeDeparture         string `json:"realtimeDeparture,omitempty"`
 	RealTimeDepartureActual   bool   `json:"realtimeDepartureActual,omitempty"`
 	RealTimeDepartureNoReport bool   `json:"realtimeDepartureNoReport,omitempty"`
 	RealTimeDepartureNextDay  bool   `json:"realtimeDepartureNextDay,omitempty"`
 
+	RealTimeGBTTDepartureLateness int `json:"realtimeGbttDepartureLateness,omitempty"`
+	RealTimeWTTDepartureLateness  int `json:"realtimeWttDepartureLateness,omitempty"`
+
 	RealTimePass         string `json:"realtimePass,omitempty"`
 	RealTimePassActual   bool   `json:"realtimePassActual,omitempty"`
 	RealTimePassNoReport bool   `json:"realtimePassNoReport,omitempty"`
 
+	RealTimeGBTTPassLateness int `json:"realtimeGbttPassLateness,omitempty"`
+	RealTimeWTTPassLateness  int `json:"realtimeWttPassLateness,omitempty"`
+
 	Platform              string `json:"platform,omitempty"`
 	PlatformConfirmed     bool   `json:"platformConfirmed,omitempty"`
 	PlatformChanged       bool   `json:"platformChanged,omitempty"`
@@ -91,4 +108,6 @@ type LocationDetail struct {
 	CancelReasonLongText  string `json:"cancelReasonLongText,omitempty"`
 	DisplayAs             string `json:"displayAs,omitempty"`
 	ServiceLocation       string `json:"serviceLocation,omitempty"`
+
+	Extras Extras `json:"-"`
 }
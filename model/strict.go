@@ -0,0 +1,248 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// WarningKind describes why a property didn't match the model
+type WarningKind string
+
+// UnknownProperty is a property which has no matching struct field, it is kept in Extras
+// MistypedProperty is a property whose JSON type doesn't suit its struct field, it is left unset
+const (
+	UnknownProperty  WarningKind = "unknown"
+	MistypedProperty WarningKind = "mistyped"
+)
+
+// Warning describes a single property in an RTT response which didn't match the model
+type Warning struct {
+	Kind  WarningKind
+	Path  string
+	Value json.RawMessage
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s property %s: %s", w.Kind, w.Path, w.Value)
+}
+
+// Warnings lists all of the mismatches found in a response, it can be returned as an error
+type Warnings []Warning
+
+func (w Warnings) Error() string {
+	lines := make([]string, len(w))
+	for i, warning := range w {
+		lines[i] = warning.String()
+	}
+	return fmt.Sprintf("%d schema warnings: %s", len(w), strings.Join(lines, "; "))
+}
+
+// DecodeStrict decodes a JSON response into v, listing any properties which don't match the model.
+// Mistyped properties are dropped rather than failing the decode, so the rest of v is still filled in
+func DecodeStrict(r io.Reader, v interface{}) (Warnings, error) {
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return nil, fmt.Errorf("cannot decode into non-pointer %T", v)
+	}
+
+	// check the response against the model, dropping anything which would fail to decode
+	var warnings Warnings
+	cleaned, err := checkValue(bytes.TrimSpace(data), target.Type().Elem(), "", &warnings)
+	if err != nil {
+		return nil, err
+	}
+
+	// a body of the wrong type altogether leaves nothing to decode, which fails whatever the mode
+	if cleaned == nil {
+		return warnings, &json.UnmarshalTypeError{Value: jsonType(data), Type: target.Type().Elem()}
+	}
+	return warnings, json.Unmarshal(cleaned, v)
+}
+
+// jsonType names the type of a JSON value as encoding/json does in its errors
+func jsonType(data json.RawMessage) string {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return "empty"
+	}
+	switch data[0] {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "bool"
+	}
+	return "number"
+}
+
+// checkValue compares a JSON value to the Go type it will be decoded into, recording warnings for
+// anything which doesn't fit, returning the value with mistyped properties removed or nil if it is mistyped
+func checkValue(data json.RawMessage, t reflect.Type, path string, warnings *Warnings) (json.RawMessage, error) {
+
+	// null is accepted by every type, leaving it unset
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return data, nil
+	}
+
+	mistyped := func() (json.RawMessage, error) {
+		*warnings = append(*warnings, Warning{Kind: MistypedProperty, Path: path, Value: data})
+		return nil, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		if data[0] != '"' {
+			return mistyped()
+		}
+	case reflect.Bool:
+		if !bytes.Equal(data, []byte("true")) && !bytes.Equal(data, []byte("false")) {
+			return mistyped()
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if _, err := strconv.ParseInt(string(data), 10, t.Bits()); err != nil {
+			return mistyped()
+		}
+	case reflect.Slice:
+		if data[0] != '[' {
+			return mistyped()
+		}
+		return checkArray(data, t, path, warnings)
+	case reflect.Map:
+		if data[0] != '{' {
+			return mistyped()
+		}
+		return checkMap(data, t, path, warnings)
+	case reflect.Struct:
+		if data[0] != '{' {
+			return mistyped()
+		}
+		return checkObject(data, t, path, warnings)
+	}
+	return data, nil
+}
+
+// checkArray checks each element of an array, replacing mistyped elements with null to keep indexes stable
+func checkArray(data json.RawMessage, t reflect.Type, path string, warnings *Warnings) (json.RawMessage, error) {
+
+	var elements []json.RawMessage
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, element := range elements {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		cleaned, err := checkValue(element, t.Elem(), fmt.Sprintf("%s[%d]", path, i), warnings)
+		if err != nil {
+			return nil, err
+		}
+		if cleaned == nil {
+			cleaned = json.RawMessage("null")
+		}
+		buf.Write(cleaned)
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// checkMap checks each value of an object decoded into a map, dropping mistyped values
+func checkMap(data json.RawMessage, t reflect.Type, path string, warnings *Warnings) (json.RawMessage, error) {
+
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	cleaned := make(map[string]json.RawMessage, len(entries))
+	for key, value := range entries {
+		value, err := checkValue(value, t.Elem(), joinPath(path, key), warnings)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			cleaned[key] = value
+		}
+	}
+	return json.Marshal(cleaned)
+}
+
+// checkObject checks each property of an object decoded into a struct, keeping the original key order
+func checkObject(data json.RawMessage, t reflect.Type, path string, warnings *Warnings) (json.RawMessage, error) {
+
+	fields := jsonFields(t)
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for decoder.More() {
+
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key := token.(string)
+
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+
+		// unknown properties are still decoded, ending up in the struct's extras
+		f, ok := fieldFor(fields, key)
+		if !ok {
+			*warnings = append(*warnings, Warning{Kind: UnknownProperty, Path: joinPath(path, key), Value: value})
+		} else {
+			value, err = checkValue(value, t.Field(f.index).Type, joinPath(path, key), warnings)
+			if err != nil {
+				return nil, err
+			}
+			if value == nil {
+				continue
+			}
+		}
+
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		name, err := marshalValue(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// joinPath builds the dotted path to a property
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,173 @@
+package model
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrNoTime is returned when a location doesn't have the requested time
+	ErrNoTime = errors.New("No time given for location")
+
+	// ErrBadTime is returned when a time of day isn't in the HHMM or HHMMSS format used by RTT
+	ErrBadTime = errors.New("Time of day is not in HHMM or HHMMSS format")
+)
+
+// London is the timezone RTT gives all of its dates and times in, this is UTC if zone data can't be loaded
+var London = loadLondon()
+
+func loadLondon() *time.Location {
+	location, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// ParseTime combines a service's run date, e.g. 2020-02-12, with a time of day in HHMM or HHMMSS format,
+// moving onto the following day when nextDay is set
+func ParseTime(runDate, clock string, nextDay bool) (time.Time, error) {
+
+	if clock == "" {
+		return time.Time{}, ErrNoTime
+	}
+
+	date, err := time.ParseInLocation("2006-01-02", runDate, London)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if nextDay {
+		date = date.AddDate(0, 0, 1)
+	}
+
+	// split the clock into hours, minutes and optional seconds
+	if len(clock) != 4 && len(clock) != 6 {
+		return time.Time{}, ErrBadTime
+	}
+	var parts [3]int
+	for i := 0; i*2 < len(clock); i++ {
+		parts[i], err = strconv.Atoi(clock[i*2 : i*2+2])
+		if err != nil || parts[i] < 0 {
+			return time.Time{}, ErrBadTime
+		}
+	}
+	if parts[0] > 23 || parts[1] > 59 || parts[2] > 59 {
+		return time.Time{}, ErrBadTime
+	}
+
+	return time.Date(date.Year(), date.Month(), date.Day(), parts[0], parts[1], parts[2], 0, London), nil
+}
+
+// BookedArrivalTime returns the public timetable arrival at this location for a service running on runDate
+func (d LocationDetail) BookedArrivalTime(runDate string) (time.Time, error) {
+	return ParseTime(runDate, d.GBTTBookedArrival, d.GBTTBookedArrivalNextDay)
+}
+
+// BookedDepartureTime returns the public timetable departure from this location for a service running on runDate
+func (d LocationDetail) BookedDepartureTime(runDate string) (time.Time, error) {
+	return ParseTime(runDate, d.GBTTBookedDeparture, d.GBTTBookedDepartureNextDay)
+}
+
+// BookedPassTime returns the working timetable pass of this location for a service running on runDate.
+// RTT doesn't flag passes after midnight, so they are worked out from when the service left its origin
+func (d LocationDetail) BookedPassTime(runDate string) (time.Time, error) {
+	return ParseTime(runDate, d.WTTBookedPass, d.afterMidnight(d.WTTBookedPass, false))
+}
+
+// WorkingArrivalTime returns the working timetable arrival at this location for a service running on runDate,
+// which non-passenger calls have without a public one. Like passes, these are worked out around midnight
+func (d LocationDetail) WorkingArrivalTime(runDate string) (time.Time, error) {
+	return ParseTime(runDate, d.WTTBookedArrival, d.afterMidnight(d.WTTBookedArrival, d.GBTTBookedArrivalNextDay))
+}
+
+// WorkingDepartureTime returns the working timetable departure from this location for a service running on runDate
+func (d LocationDetail) WorkingDepartureTime(runDate string) (time.Time, error) {
+	return ParseTime(runDate, d.WTTBookedDeparture, d.afterMidnight(d.WTTBookedDeparture, d.GBTTBookedDepartureNextDay))
+}
+
+// afterMidnight works out whether an unflagged working time is on the day after the run date. Services run for
+// less than a day, so a time of day earlier than the service left its origin must be after midnight.
+// Locations without an origin go by fallback, the flag of the matching public time
+func (d LocationDetail) afterMidnight(clock string, fallback bool) bool {
+	if len(d.Origin) == 0 {
+		return fallback
+	}
+
+	origin := d.Origin[0].WorkingTime
+	if origin == "" {
+		origin = d.Origin[0].PublicTime
+	}
+	if len(origin) < 4 || len(clock) < 4 {
+		return fallback
+	}
+	return padClock(clock) < padClock(origin)
+}
+
+// padClock gives a HHMM time of day seconds, so it can be compared with HHMMSS times as a string
+func padClock(clock string) string {
+	if len(clock) == 4 {
+		return clock + "00"
+	}
+	return clock
+}
+
+// nearest moves a realtime t onto whichever day puts it closest to its booked time, for realtime
+// times RTT doesn't flag as being after midnight
+func nearest(t, booked time.Time) time.Time {
+	switch {
+	case t.Sub(booked) > 12*time.Hour:
+		return t.AddDate(0, 0, -1)
+	case booked.Sub(t) > 12*time.Hour:
+		return t.AddDate(0, 0, 1)
+	}
+	return t
+}
+
+// RealtimeArrivalTime returns the actual or forecast arrival at this location for a service running on runDate
+func (d LocationDetail) RealtimeArrivalTime(runDate string) (time.Time, error) {
+	return ParseTime(runDate, d.RealTimeArrival, d.RealTimeArrivalNextDay)
+}
+
+// RealtimeDepartureTime returns the actual or forecast departure from this location for a service running on runDate
+func (d LocationDetail) RealtimeDepartureTime(runDate string) (time.Time, error) {
+	return ParseTime(runDate, d.RealTimeDeparture, d.RealTimeDepartureNextDay)
+}
+
+// RealtimePassTime returns the actual or forecast pass of this location for a service running on runDate.
+// RTT doesn't flag passes after midnight, so they are put on the day closest to the booked pass
+func (d LocationDetail) RealtimePassTime(runDate string) (time.Time, error) {
+	t, err := ParseTime(runDate, d.RealTimePass, false)
+	if err != nil {
+		return t, err
+	}
+	if booked, err := d.BookedPassTime(runDate); err == nil {
+		return nearest(t, booked), nil
+	}
+	if d.afterMidnight(d.RealTimePass, false) {
+		return t.AddDate(0, 0, 1), nil
+	}
+	return t, nil
+}
+
+// boardTime returns the time a location appears on a board, the departure for calls which have one,
+// otherwise the arrival, otherwise the pass. Public times are used ahead of working ones, which
+// non-passenger calls may only have. Realtime boards fall back on booked times RTT has no data for
+func (d LocationDetail) boardTime(runDate string, realtime bool) (time.Time, error) {
+	kinds := [][]func(string) (time.Time, error){
+		{d.RealtimeDepartureTime, d.BookedDepartureTime, d.WorkingDepartureTime},
+		{d.RealtimeArrivalTime, d.BookedArrivalTime, d.WorkingArrivalTime},
+		{d.RealtimePassTime, d.BookedPassTime},
+	}
+	for _, kind := range kinds {
+		if !realtime {
+			kind = kind[1:]
+		}
+		for _, get := range kind {
+			if t, err := get(runDate); err != ErrNoTime {
+				return t, err
+			}
+		}
+	}
+	return time.Time{}, ErrNoTime
+}
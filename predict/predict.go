@@ -0,0 +1,259 @@
+// Package predict projects a late running service's times at the locations after its last report, for
+// when RTT's own forecasts lag behind. Running times between locations and dwell times at calls are
+// taken from the timetable, optionally letting the train make up some of its delay on the way
+package predict
+
+import (
+	"errors"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// ErrNoReport is returned when a service has no actual reports to predict from
+var ErrNoReport = errors.New("Service has no actual reports to predict from")
+
+// Source says where a predicted time came from
+type Source int
+
+// Actual is RTT's report of the service at its last reported location
+// Forecast is RTT's own forecast
+// Estimated is worked out locally from the timetable
+const (
+	Actual Source = iota
+	Forecast
+	Estimated
+)
+
+func (s Source) String() string {
+	switch s {
+	case Actual:
+		return "actual"
+	case Forecast:
+		return "forecast"
+	default:
+		return "estimated"
+	}
+}
+
+// Options tunes how predictions are made, the zero value runs exactly to the timetable's running and dwell times
+type Options struct {
+
+	// Recovery is the fraction of each booked running time the train can make up, e.g. 0.05 for 5%.
+	// Late trains also cut dwell times down to MinDwell, but never leave a call before they are booked to
+	Recovery float64
+
+	// MinDwell is the shortest time a train stops at a call when recovering, defaults to DefaultDwell
+	MinDwell time.Duration
+
+	// IgnoreForecasts estimates every location, even where RTT has a forecast
+	IgnoreForecasts bool
+}
+
+// DefaultDwell is the shortest stop at a call when recovering time
+const DefaultDwell = 30 * time.Second
+
+func (o Options) minDwell() time.Duration {
+	if o.MinDwell <= 0 {
+		return DefaultDwell
+	}
+	return o.MinDwell
+}
+
+// Prediction is when a service is expected at a location. Arrival is zero at the origin and Departure
+// at the destination, passes have both set to the time the train passes
+type Prediction struct {
+
+	// Index is the location's position in the service's Locations
+	Index    int
+	Location model.LocationDetail
+
+	Arrival, Departure time.Time
+
+	// Delay is against the booked departure, or the booked arrival where there isn't one
+	Delay time.Duration
+
+	Source Source
+}
+
+// first returns the first time the location has of several
+func first(d model.LocationDetail, runDate string, times ...func(model.LocationDetail, string) (time.Time, error)) (time.Time, bool) {
+	for _, get := range times {
+		if t, err := get(d, runDate); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// booked times, public where there are any and working otherwise. Passes count as both arriving and leaving
+func bookedArrival(d model.LocationDetail, runDate string) (time.Time, bool) {
+	return first(d, runDate, model.LocationDetail.BookedArrivalTime, model.LocationDetail.WorkingArrivalTime,
+		model.LocationDetail.BookedPassTime)
+}
+
+func bookedDeparture(d model.LocationDetail, runDate string) (time.Time, bool) {
+	return first(d, runDate, model.LocationDetail.BookedDepartureTime, model.LocationDetail.WorkingDepartureTime,
+		model.LocationDetail.BookedPassTime)
+}
+
+// realtime times RTT has, either actual or forecast
+func realtimeArrival(d model.LocationDetail, runDate string) (time.Time, bool) {
+	if d.RealTimeArrivalNoReport || d.RealTimePassNoReport {
+		return time.Time{}, false
+	}
+	return first(d, runDate, model.LocationDetail.RealtimeArrivalTime, model.LocationDetail.RealtimePassTime)
+}
+
+func realtimeDeparture(d model.LocationDetail, runDate string) (time.Time, bool) {
+	if d.RealTimeDepartureNoReport || d.RealTimePassNoReport {
+		return time.Time{}, false
+	}
+	return first(d, runDate, model.LocationDetail.RealtimeDepartureTime, model.LocationDetail.RealtimePassTime)
+}
+
+// lastReport finds the latest location with an actual report, and when the service left it or will leave
+func lastReport(service model.Service, o Options) (Prediction, error) {
+	for i := len(service.Locations) - 1; i >= 0; i-- {
+		d := service.Locations[i]
+		if !d.RealTimeArrivalActual && !d.RealTimeDepartureActual && !d.RealTimePassActual {
+			continue
+		}
+
+		p := Prediction{Index: i, Location: d, Source: Actual}
+		if d.RealTimePassActual {
+			p.Arrival, _ = realtimeArrival(d, service.RunDate)
+			p.Departure = p.Arrival
+		}
+		if d.RealTimeArrivalActual {
+			p.Arrival, _ = realtimeArrival(d, service.RunDate)
+		}
+		if d.RealTimeDepartureActual {
+			p.Departure, _ = realtimeDeparture(d, service.RunDate)
+		} else if departure, ok := bookedDeparture(d, service.RunDate); ok && d.WTTBookedPass == "" {
+
+			// stood at a call, it will leave once it has dwelt
+			p.Departure = leave(d, service.RunDate, p.Arrival, departure, o)
+		}
+		p.Delay = delay(d, service.RunDate, p)
+		return p, nil
+	}
+	return Prediction{}, ErrNoReport
+}
+
+// leave works out when a train arriving at a call leaves it, never before it is booked to
+func leave(d model.LocationDetail, runDate string, arrival, booked time.Time, o Options) time.Time {
+	dwell := o.minDwell()
+	if o.Recovery <= 0 {
+		if b, ok := bookedArrival(d, runDate); ok && booked.Sub(b) > dwell {
+			dwell = booked.Sub(b)
+		}
+	}
+
+	if departure := arrival.Add(dwell); departure.After(booked) {
+		return departure
+	}
+	return booked
+}
+
+// depart works out when a train arriving at a location leaves it, passing straight through where it
+// passes. It is zero where the location has no booked departure or the arrival isn't known
+func depart(d model.LocationDetail, runDate string, arrival time.Time, o Options) time.Time {
+	booked, ok := bookedDeparture(d, runDate)
+	switch {
+	case !ok || arrival.IsZero():
+		return time.Time{}
+	case d.WTTBookedPass != "":
+		return arrival
+	}
+	return leave(d, runDate, arrival, booked, o)
+}
+
+// delay measures a prediction against the booked departure, or the booked arrival at the destination
+func delay(d model.LocationDetail, runDate string, p Prediction) time.Duration {
+	if booked, ok := bookedDeparture(d, runDate); ok && !p.Departure.IsZero() {
+		return p.Departure.Sub(booked)
+	}
+	if booked, ok := bookedArrival(d, runDate); ok && !p.Arrival.IsZero() {
+		return p.Arrival.Sub(booked)
+	}
+	return 0
+}
+
+// Service projects a service's times from its last actual report to its destination, starting with the
+// report itself. Locations where RTT has a forecast use it, unless told to ignore them, and the rest are
+// estimated from the running time since the location before. Cancelled locations are left out
+func Service(service model.Service, o Options) ([]Prediction, error) {
+
+	last, err := lastReport(service, o)
+	if err != nil {
+		return nil, err
+	}
+	predictions := []Prediction{last}
+
+	previous := last
+	for i := last.Index + 1; i < len(service.Locations); i++ {
+		d := service.Locations[i]
+		if d.Cancelled() {
+			continue
+		}
+		p := Prediction{Index: i, Location: d, Source: Estimated}
+
+		// the booked running time from the previous location, less what can be recovered
+		arrival, hasArrival := bookedArrival(d, service.RunDate)
+		departed, hasDeparted := bookedDeparture(previous.Location, service.RunDate)
+		if hasArrival && hasDeparted && !previous.Departure.IsZero() {
+			running := arrival.Sub(departed)
+			running -= time.Duration(float64(running) * o.Recovery)
+			p.Arrival = previous.Departure.Add(running)
+
+			// the timetable can't be beaten, recovering only makes up lost time
+			if o.Recovery > 0 && p.Arrival.Before(arrival) && previous.Delay >= 0 {
+				p.Arrival = arrival
+			}
+		}
+
+		p.Departure = depart(d, service.RunDate, p.Arrival, o)
+
+		if !o.IgnoreForecasts {
+			forecastArrival, hasArrival := realtimeArrival(d, service.RunDate)
+			forecastDeparture, hasDeparture := realtimeDeparture(d, service.RunDate)
+			if hasArrival {
+				p.Arrival, p.Source = forecastArrival, Forecast
+
+				// without a forecast of its own, the departure follows on from the forecast arrival
+				p.Departure = depart(d, service.RunDate, p.Arrival, o)
+			}
+			if hasDeparture {
+				p.Departure, p.Source = forecastDeparture, Forecast
+			}
+		}
+
+		// the origin has no arrival and the destination no departure
+		if !hasBookedArrival(d, service.RunDate) {
+			p.Arrival = time.Time{}
+		}
+		if !hasBookedDeparture(d, service.RunDate) {
+			p.Departure = time.Time{}
+		}
+
+		p.Delay = delay(d, service.RunDate, p)
+		predictions = append(predictions, p)
+
+		// running times are measured from the last location the train leaves, passing over any without times
+		if !p.Departure.IsZero() {
+			previous = p
+		}
+	}
+	return predictions, nil
+}
+
+func hasBookedArrival(d model.LocationDetail, runDate string) bool {
+	_, ok := bookedArrival(d, runDate)
+	return ok
+}
+
+func hasBookedDeparture(d model.LocationDetail, runDate string) bool {
+	_, ok := bookedDeparture(d, runDate)
+	return ok
+}
@@ -0,0 +1,152 @@
+package predict
+
+import (
+	"testing"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// journey leaves A at 1000, passes B at 1010, calls at C 1020-1025 and terminates at D at 1040
+func journey(edit func(locations []model.LocationDetail)) model.Service {
+	service := model.Service{RunDate: "2020-02-12", Locations: []model.LocationDetail{
+		{TIPLOC: "A", GBTTBookedDeparture: "1000", IsCall: true},
+		{TIPLOC: "B", WTTBookedPass: "1010"},
+		{TIPLOC: "C", GBTTBookedArrival: "1020", GBTTBookedDeparture: "1025", IsCall: true},
+		{TIPLOC: "D", GBTTBookedArrival: "1040", IsCall: true},
+	}}
+	edit(service.Locations)
+	return service
+}
+
+// leftLate departed A 10 minutes late
+func leftLate(l []model.LocationDetail) {
+	l[0].RealTimeDeparture, l[0].RealTimeDepartureActual = "1010", true
+}
+
+// expected is a prediction as index, arrival, departure, delay in minutes and source
+type expected struct {
+	index              int
+	arrival, departure string
+	delay              int
+	source             Source
+}
+
+func TestService(t *testing.T) {
+
+	ts := []struct {
+		name     string
+		service  model.Service
+		options  Options
+		expected []expected
+	}{
+		{"timetable", journey(leftLate), Options{}, []expected{
+			{0, "", "1010", 10, Actual},
+			{1, "1020", "1020", 10, Estimated},
+			{2, "1030", "1035", 10, Estimated},
+			{3, "1050", "", 10, Estimated},
+		}},
+		{"recovery", journey(leftLate), Options{Recovery: 0.2, MinDwell: time.Minute}, []expected{
+			{0, "", "1010", 10, Actual},
+			{1, "1018", "1018", 8, Estimated},
+			{2, "1026", "1027", 2, Estimated},
+			{3, "1040", "", 0, Estimated},
+		}},
+		{"forecast", journey(func(l []model.LocationDetail) {
+			leftLate(l)
+			l[2].RealTimeArrival, l[2].RealTimeDeparture = "1028", "1030"
+		}), Options{}, []expected{
+			{0, "", "1010", 10, Actual},
+			{1, "1020", "1020", 10, Estimated},
+			{2, "1028", "1030", 5, Forecast},
+			{3, "1045", "", 5, Estimated},
+		}},
+		{"forecast-arrival", journey(func(l []model.LocationDetail) {
+			leftLate(l)
+			l[2].RealTimeArrival = "1033"
+		}), Options{}, []expected{
+			{0, "", "1010", 10, Actual},
+			{1, "1020", "1020", 10, Estimated},
+			{2, "1033", "1038", 13, Forecast},
+			{3, "1053", "", 13, Estimated},
+		}},
+		{"untimed-location", journey(func(l []model.LocationDetail) {
+			leftLate(l)
+			l[1] = model.LocationDetail{TIPLOC: "X"}
+		}), Options{}, []expected{
+			{0, "", "1010", 10, Actual},
+			{1, "", "", 0, Estimated},
+			{2, "1030", "1035", 10, Estimated},
+			{3, "1050", "", 10, Estimated},
+		}},
+		{"ignore-forecasts", journey(func(l []model.LocationDetail) {
+			leftLate(l)
+			l[2].RealTimeArrival, l[2].RealTimeDeparture = "1028", "1030"
+		}), Options{IgnoreForecasts: true}, []expected{
+			{0, "", "1010", 10, Actual},
+			{1, "1020", "1020", 10, Estimated},
+			{2, "1030", "1035", 10, Estimated},
+			{3, "1050", "", 10, Estimated},
+		}},
+		{"stood-at-call", journey(func(l []model.LocationDetail) {
+			leftLate(l)
+			l[1].RealTimePass, l[1].RealTimePassActual = "1022", true
+			l[2].RealTimeArrival, l[2].RealTimeArrivalActual = "1032", true
+		}), Options{}, []expected{
+			{2, "1032", "1037", 12, Actual},
+			{3, "1052", "", 12, Estimated},
+		}},
+		{"cancelled-call", journey(func(l []model.LocationDetail) {
+			leftLate(l)
+			l[2].DisplayAs = "CANCELLED_CALL"
+		}), Options{}, []expected{
+			{0, "", "1010", 10, Actual},
+			{1, "1020", "1020", 10, Estimated},
+			{3, "1050", "", 10, Estimated},
+		}},
+	}
+
+	clock := func(s string) time.Time {
+		if s == "" {
+			return time.Time{}
+		}
+		t, err := model.ParseTime("2020-02-12", s, false)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+
+	for _, tc := range ts {
+		predictions, err := Service(tc.service, tc.options)
+		if err != nil {
+			t.Errorf("%s: Got error %v", tc.name, err)
+			continue
+		}
+		if len(predictions) != len(tc.expected) {
+			t.Errorf("%s: Got wrong number of predictions, got %+v", tc.name, predictions)
+			continue
+		}
+
+		for i, e := range tc.expected {
+			p := predictions[i]
+			switch {
+			case p.Index != e.index || p.Location.TIPLOC != tc.service.Locations[e.index].TIPLOC:
+				t.Errorf("%s %d: Got wrong location, got %d", tc.name, i, p.Index)
+			case !p.Arrival.Equal(clock(e.arrival)) || !p.Departure.Equal(clock(e.departure)):
+				t.Errorf("%s %d: Got wrong times, got %s-%s, expected %s-%s", tc.name, i,
+					p.Arrival.Format("1504"), p.Departure.Format("1504"), e.arrival, e.departure)
+			case p.Delay != time.Duration(e.delay)*time.Minute:
+				t.Errorf("%s %d: Got wrong delay, got %v, expected %dm", tc.name, i, p.Delay, e.delay)
+			case p.Source != e.source:
+				t.Errorf("%s %d: Got wrong source, got %s, expected %s", tc.name, i, p.Source, e.source)
+			}
+		}
+	}
+
+	t.Run("no-report", func(t *testing.T) {
+		if _, err := Service(journey(func([]model.LocationDetail) {}), Options{}); err != ErrNoReport {
+			t.Errorf("Got wrong error, got %v, expected %v", err, ErrNoReport)
+		}
+	})
+}
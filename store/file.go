@@ -0,0 +1,235 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// stampFormat names lineup files by when they were fetched, in UTC so they sort in time order
+const stampFormat = "20060102T150405.000000000Z"
+
+// FileStore is an archive kept as JSON files in a directory, it is safe for concurrent use.
+// Services are kept at services/<run date>/<UID>.json and lineups at lineups/<station>/<time>.json,
+// written with their Layout so they match the JSON they were fetched as
+type FileStore struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+var _ Store = &FileStore{}
+
+// Open opens an archive in a directory, creating it if it doesn't exist
+func Open(dir string) (*FileStore, error) {
+	for _, sub := range []string{"services", "lineups"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// validKey checks a key is safe to use as a file name
+func validKey(key string) bool {
+	return key != "" && key != "." && key != ".." && !strings.ContainsAny(key, `/\`)
+}
+
+// servicePath returns where a service is kept
+func (s *FileStore) servicePath(uid, runDate string) (string, error) {
+	if !validKey(uid) {
+		return "", ErrBadKey
+	}
+	if _, err := time.Parse(runDateFormat, runDate); err != nil {
+		return "", ErrBadKey
+	}
+	return filepath.Join(s.dir, "services", runDate, uid+".json"), nil
+}
+
+// PutService stores a service, replacing any earlier copy with the same UID and run date
+func (s *FileStore) PutService(service model.Service) error {
+	path, err := s.servicePath(service.ServiceUID, service.RunDate)
+	if err != nil {
+		return err
+	}
+
+	data, err := model.MarshalLossless(service, service.Layout)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeFile(path, data)
+}
+
+// Service returns the stored copy of a service, or ErrNotFound
+func (s *FileStore) Service(uid, runDate string) (model.Service, error) {
+	var service model.Service
+	path, err := s.servicePath(uid, runDate)
+	if err != nil {
+		return service, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	service.Layout, err = readModel(path, &service)
+	if os.IsNotExist(err) {
+		return service, ErrNotFound
+	}
+	return service, err
+}
+
+// Services returns every stored service matching a query, ordered by run date then UID
+func (s *FileStore) Services(query Query) ([]model.Service, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dates, err := ioutil.ReadDir(filepath.Join(s.dir, "services"))
+	if err != nil {
+		return nil, err
+	}
+
+	// run dates sort as their directory names, so the range can be checked before reading anything
+	from, to := query.dates()
+	var services []model.Service
+	for _, date := range dates {
+		name := date.Name()
+		if !date.IsDir() || (from != "" && name < from) || (to != "" && name > to) {
+			continue
+		}
+
+		files, err := ioutil.ReadDir(filepath.Join(s.dir, "services", name))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			uid := strings.TrimSuffix(file.Name(), ".json")
+			if uid == file.Name() || (query.UID != "" && !strings.EqualFold(uid, query.UID)) {
+				continue
+			}
+
+			var service model.Service
+			service.Layout, err = readModel(filepath.Join(s.dir, "services", name, file.Name()), &service)
+			if err != nil {
+				return nil, err
+			}
+			if query.Match(service) {
+				services = append(services, service)
+			}
+		}
+	}
+	return services, nil
+}
+
+// PutLineup stores a lineup fetched for a station at a time
+func (s *FileStore) PutLineup(station string, at time.Time, lineup model.Lineup) error {
+	if !validKey(station) {
+		return ErrBadKey
+	}
+	path := filepath.Join(s.dir, "lineups", strings.ToUpper(station), at.UTC().Format(stampFormat)+".json")
+
+	data, err := model.MarshalLossless(lineup, lineup.Layout)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeFile(path, data)
+}
+
+// Lineups returns the lineups stored for a station between two times inclusive, oldest first.
+// A zero time leaves that end open
+func (s *FileStore) Lineups(station string, from, to time.Time) ([]Snapshot, error) {
+	if !validKey(station) {
+		return nil, ErrBadKey
+	}
+	station = strings.ToUpper(station)
+	dir := filepath.Join(s.dir, "lineups", station)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, file := range files {
+		at, err := time.Parse(stampFormat, strings.TrimSuffix(file.Name(), ".json"))
+		if err != nil || (!from.IsZero() && at.Before(from)) || (!to.IsZero() && at.After(to)) {
+			continue
+		}
+
+		snapshot := Snapshot{Station: station, At: at}
+		snapshot.Lineup.Layout, err = readModel(filepath.Join(dir, file.Name()), &snapshot.Lineup)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		return snapshots[i].At.Before(snapshots[j].At)
+	})
+	return snapshots, nil
+}
+
+// Close releases the archive, files are written as they are stored so there's nothing to flush
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// writeFile writes a file in the archive, creating its directory if need be
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return WriteFile(path, data, 0644)
+}
+
+// WriteFile writes data to a file like ioutil.WriteFile, but through a temporary file in the same directory
+// which is synced then renamed into place, so readers and crashes never leave half of it
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// readModel decodes a file written by PutService or PutLineup into v, returning its layout
+func readModel(path string, v interface{}) (model.Layout, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return model.UnmarshalLossless(data, v)
+}
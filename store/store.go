@@ -0,0 +1,93 @@
+// Package store archives services and lineups fetched from RTT, so they can be queried later
+package store
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+var (
+	// ErrNotFound is returned when a service isn't in the archive
+	ErrNotFound = errors.New("Not found in archive")
+
+	// ErrBadKey is returned when a UID, run date or station can't be used to store something
+	ErrBadKey = errors.New("Bad archive key")
+)
+
+// Store is an archive of services and lineups, FileStore is the embedded implementation
+type Store interface {
+
+	// PutService stores a service, replacing any earlier copy with the same UID and run date
+	PutService(service model.Service) error
+
+	// Service returns the stored copy of a service, or ErrNotFound
+	Service(uid, runDate string) (model.Service, error)
+
+	// Services returns every stored service matching a query, ordered by run date then UID
+	Services(query Query) ([]model.Service, error)
+
+	// PutLineup stores a lineup fetched for a station at a time
+	PutLineup(station string, at time.Time, lineup model.Lineup) error
+
+	// Lineups returns the lineups stored for a station between two times inclusive, oldest first.
+	// A zero time leaves that end open
+	Lineups(station string, from, to time.Time) ([]Snapshot, error)
+
+	Close() error
+}
+
+// Snapshot is a lineup as it was fetched for a station at a point in time
+type Snapshot struct {
+	Station string
+	At      time.Time
+	Lineup  model.Lineup
+}
+
+// Query picks out services from an archive, empty fields match everything
+type Query struct {
+
+	// From and To limit the run dates, inclusive, a zero time leaves that end open
+	From, To time.Time
+
+	// Station is a TIPLOC or CRS code the service visits
+	Station string
+
+	// Operator is an ATOC code
+	Operator string
+
+	UID string
+}
+
+// dates returns the run dates bounding the query, empty when open
+func (q Query) dates() (from, to string) {
+	if !q.From.IsZero() {
+		from = q.From.In(model.London).Format(runDateFormat)
+	}
+	if !q.To.IsZero() {
+		to = q.To.In(model.London).Format(runDateFormat)
+	}
+	return from, to
+}
+
+// Match checks whether a service meets the query
+func (q Query) Match(service model.Service) bool {
+	from, to := q.dates()
+	switch {
+	case from != "" && service.RunDate < from:
+		return false
+	case to != "" && service.RunDate > to:
+		return false
+	case q.UID != "" && !strings.EqualFold(service.ServiceUID, q.UID):
+		return false
+	case q.Operator != "" && !strings.EqualFold(service.ATOCCode, q.Operator):
+		return false
+	case q.Station != "" && service.IndexOf(q.Station) == -1:
+		return false
+	}
+	return true
+}
+
+const runDateFormat = "2006-01-02"
@@ -0,0 +1,237 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+	"github.com/georgeprice/realtime-trains-golang/model/modeltest"
+)
+
+// openTemp opens an archive in a new temporary directory, returning a function to remove it
+func openTemp(t *testing.T) (*FileStore, func()) {
+	dir, err := ioutil.TempDir("", "rtt-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Open(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return s, func() { os.RemoveAll(dir) }
+}
+
+// newService builds a service from modeltest running on a date for an operator, calling at each of the given CRS codes
+func newService(uid, runDate, operator string, stations ...string) model.Service {
+	var calls []modeltest.Call
+	for _, crs := range stations {
+		calls = append(calls, modeltest.Stop(crs, "", ""))
+	}
+	service := modeltest.Service(uid, calls...)
+	service.RunDate = runDate
+	service.ATOCCode = operator
+	return service
+}
+
+// uids lists the UIDs and run dates of services, in order
+func uids(services []model.Service) []string {
+	var keys []string
+	for _, service := range services {
+		keys = append(keys, service.ServiceUID+"/"+service.RunDate)
+	}
+	return keys
+}
+
+func TestServices(t *testing.T) {
+	s, cleanup := openTemp(t)
+	defer cleanup()
+
+	for _, service := range []model.Service{
+		newService("S1", "2020-02-12", "SW", "BMH", "WAT"),
+		newService("S2", "2020-02-12", "XC", "BMH", "MAN"),
+		newService("S1", "2020-02-13", "SW", "BMH", "WAT"),
+		newService("S3", "2020-02-14", "SW", "SOU", "WAT"),
+	} {
+		if err := s.PutService(service); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("get", func(t *testing.T) {
+		service, err := s.Service("S2", "2020-02-12")
+		switch {
+		case err != nil:
+			t.Fatal(err)
+		case service.ATOCCode != "XC" || len(service.Locations) != 2:
+			t.Errorf("Got wrong service, got %+v", service)
+		}
+
+		if _, err := s.Service("S2", "2020-02-13"); err != ErrNotFound {
+			t.Errorf("Got wrong error, got %v, expected %v", err, ErrNotFound)
+		}
+		if _, err := s.Service("../S2", "2020-02-12"); err != ErrBadKey {
+			t.Errorf("Got wrong error, got %v, expected %v", err, ErrBadKey)
+		}
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		replaced := newService("S3", "2020-02-14", "GW", "SOU", "WAT")
+		if err := s.PutService(replaced); err != nil {
+			t.Fatal(err)
+		}
+		if service, err := s.Service("S3", "2020-02-14"); err != nil || service.ATOCCode != "GW" {
+			t.Errorf("Got wrong service, got %+v, %v", service, err)
+		}
+	})
+
+	ts := []struct {
+		name     string
+		query    Query
+		expected []string
+	}{
+		{"all", Query{}, []string{"S1/2020-02-12", "S2/2020-02-12", "S1/2020-02-13", "S3/2020-02-14"}},
+		{"uid", Query{UID: "s1"}, []string{"S1/2020-02-12", "S1/2020-02-13"}},
+		{"operator", Query{Operator: "XC"}, []string{"S2/2020-02-12"}},
+		{"station", Query{Station: "WAT"}, []string{"S1/2020-02-12", "S1/2020-02-13", "S3/2020-02-14"}},
+		{"dates", Query{
+			From: time.Date(2020, 2, 13, 0, 0, 0, 0, model.London),
+			To:   time.Date(2020, 2, 14, 0, 0, 0, 0, model.London),
+		}, []string{"S1/2020-02-13", "S3/2020-02-14"}},
+		{"none", Query{Station: "EUS"}, nil},
+	}
+
+	for _, tc := range ts {
+		services, err := s.Services(tc.query)
+		if err != nil {
+			t.Errorf("%s: Got error %v", tc.name, err)
+			continue
+		}
+		if got := uids(services); !equal(got, tc.expected) {
+			t.Errorf("%s: Got wrong services, got %v, expected %v", tc.name, got, tc.expected)
+		}
+	}
+}
+
+func TestLineups(t *testing.T) {
+	s, cleanup := openTemp(t)
+	defer cleanup()
+
+	start := time.Date(2020, 2, 12, 10, 0, 0, 0, model.London)
+	for i := 0; i < 3; i++ {
+		lineup := model.Lineup{Location: model.LocationDetailHeader{CRS: "MAN"}}
+		lineup.Services = make([]model.LocationContainer, i)
+		if err := s.PutLineup("man", start.Add(time.Duration(i)*time.Minute), lineup); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshots, err := s.Lineups("MAN", start.Add(time.Minute), start.Add(time.Hour))
+	switch {
+	case err != nil:
+		t.Fatal(err)
+	case len(snapshots) != 2:
+		t.Fatalf("Got wrong number of lineups, got %d, expected 2", len(snapshots))
+	case !snapshots[0].At.Equal(start.Add(time.Minute)) || len(snapshots[1].Lineup.Services) != 2:
+		t.Errorf("Got wrong lineups, got %+v", snapshots)
+	case snapshots[0].Station != "MAN":
+		t.Errorf("Got wrong station, got %s", snapshots[0].Station)
+	}
+
+	ts := []struct {
+		name     string
+		from, to time.Time
+		expected int
+	}{
+		{"open-start", time.Time{}, start.Add(time.Minute), 2},
+		{"open-end", start.Add(time.Minute), time.Time{}, 2},
+		{"open", time.Time{}, time.Time{}, 3},
+	}
+	for _, tc := range ts {
+		snapshots, err := s.Lineups("MAN", tc.from, tc.to)
+		if err != nil || len(snapshots) != tc.expected {
+			t.Errorf("%s: Got wrong number of lineups, got %d, %v, expected %d", tc.name, len(snapshots), err, tc.expected)
+		}
+	}
+
+	if snapshots, err := s.Lineups("EUS", start, start.Add(time.Hour)); err != nil || len(snapshots) != 0 {
+		t.Errorf("Got lineups for an unknown station, got %+v, %v", snapshots, err)
+	}
+}
+
+// equal compares lists of keys, treating nil and empty as the same
+func TestLossless(t *testing.T) {
+	s, cleanup := openTemp(t)
+	defer cleanup()
+
+	body := `{"serviceUid":"S1","runDate":"2020-02-12","isPassenger":false,"newThing":1,"locations":[{"tiploc":"BOMO","isCall":false}]}`
+	var service model.Service
+	layout, err := model.UnmarshalLossless([]byte(body), &service)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.Layout = layout
+
+	if err := s.PutService(service); err != nil {
+		t.Fatal(err)
+	}
+	if written, err := ioutil.ReadFile(filepath.Join(s.dir, "services", "2020-02-12", "S1.json")); err != nil || string(written) != body {
+		t.Errorf("Got wrong archived JSON, got %s (%v), expected %s", written, err, body)
+	}
+
+	// the layout comes back with the service, so storing it again keeps it as it was
+	stored, err := s.Service("S1", "2020-02-12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := model.MarshalLossless(stored, stored.Layout); err != nil || string(out) != body {
+		t.Errorf("Got wrong JSON from the archived service, got %s (%v), expected %s", out, err, body)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rtt-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "state.json")
+	for _, data := range []string{"first", "second"} {
+		if err := WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	switch {
+	case err != nil:
+		t.Fatal(err)
+	case info.Mode().Perm() != 0644:
+		t.Errorf("Got wrong mode, got %v, expected %v", info.Mode().Perm(), os.FileMode(0644))
+	}
+	if data, err := ioutil.ReadFile(path); err != nil || string(data) != "second" {
+		t.Errorf("Got wrong contents, got %q (%v), expected %q", data, err, "second")
+	}
+
+	// nothing is left behind besides the file itself
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 1 {
+		t.Errorf("Got wrong files, got %d (%v), expected 1", len(files), err)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
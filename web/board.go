@@ -0,0 +1,129 @@
+package web
+
+import (
+	"strings"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// Row is a service as shown on a departure board
+type Row struct {
+
+	// Key identifies the row, as UID/run date since RTT reuses UIDs on other days and boards can span midnight
+	Key             string `json:"key"`
+	UID             string `json:"uid"`
+	RunDate         string `json:"runDate"`
+	Time            string `json:"time"`
+	Destination     string `json:"destination"`
+	Platform        string `json:"platform"`
+	PlatformChanged bool   `json:"platformChanged"`
+	Expected        string `json:"expected"`
+	Operator        string `json:"operator"`
+	Cancelled       bool   `json:"cancelled"`
+}
+
+// Update is a change to a board. A subscriber's first update has every row in Changed, after
+// that only rows which are new or have changed are sent, along with the keys of rows removed
+type Update struct {
+	Changed []Row    `json:"changed,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+
+	// Order is the key of every row on the board in order, null when the rows haven't changed. Rows which
+	// aren't in it can be removed, so a snapshot replaces whatever a reconnecting screen had
+	Order []string `json:"order"`
+
+	// Error is set while the board can't be refreshed, the rows are kept from the last refresh
+	Error string `json:"error,omitempty"`
+}
+
+// status describes a realtime time against the booked one, as boards do
+func status(booked, realtime time.Time, cancelled bool) string {
+	switch {
+	case cancelled:
+		return "Cancelled"
+	case booked.IsZero() || realtime.IsZero():
+		return ""
+	case realtime.Truncate(time.Minute).Equal(booked.Truncate(time.Minute)):
+		return "On time"
+	}
+	return "Exp " + realtime.Format("15:04")
+}
+
+// rows lays out a lineup as a board
+func rows(lineup model.Lineup) []Row {
+	rows := make([]Row, 0, len(lineup.Services))
+	for _, c := range lineup.Services {
+		booked, _ := c.BookedTime()
+		var realtime time.Time
+		if c.RealTimeActivated {
+			realtime, _ = c.RealtimeTime()
+		}
+
+		destinations := c.LocationDetail.Destination
+		if len(destinations) == 0 {
+			destinations = c.Destination
+		}
+		var names []string
+		for _, d := range destinations {
+			names = append(names, d.Description)
+		}
+
+		row := Row{
+			Key:             c.ServiceUID + "/" + c.RunDate,
+			UID:             c.ServiceUID,
+			RunDate:         c.RunDate,
+			Destination:     strings.Join(names, " & "),
+			Platform:        c.Platform,
+			PlatformChanged: c.PlatformChanged,
+			Expected:        status(booked, realtime, c.Cancelled()),
+			Operator:        c.ATOCName,
+			Cancelled:       c.Cancelled(),
+		}
+		if !booked.IsZero() {
+			row.Time = booked.Format("15:04")
+		}
+		if c.RealTimeDepartureActual {
+			row.Expected = "Departed"
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// keys lists the keys of rows in order
+func keys(rows []Row) []string {
+	keys := make([]string, len(rows))
+	for i, r := range rows {
+		keys[i] = r.Key
+	}
+	return keys
+}
+
+// diff works out the update taking a board from before to after, and whether anything changed
+func diff(before, after []Row) (Update, bool) {
+	var u Update
+
+	old := make(map[string]Row, len(before))
+	for _, r := range before {
+		old[r.Key] = r
+	}
+	for _, r := range after {
+		if previous, ok := old[r.Key]; !ok || previous != r {
+			u.Changed = append(u.Changed, r)
+		}
+		delete(old, r.Key)
+	}
+	for _, r := range before {
+		if _, ok := old[r.Key]; ok {
+			u.Removed = append(u.Removed, r.Key)
+		}
+	}
+
+	order := keys(after)
+	changed := len(u.Changed) > 0 || len(u.Removed) > 0 || strings.Join(order, ",") != strings.Join(keys(before), ",")
+	if changed {
+		u.Order = order
+	}
+	return u, changed
+}
@@ -0,0 +1,79 @@
+package web
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+func TestRows(t *testing.T) {
+	lineup := model.Lineup{Services: []model.LocationContainer{
+		{
+			LocationDetail: model.LocationDetail{
+				RealTimeActivated:   true,
+				GBTTBookedDeparture: "1200",
+				RealTimeDeparture:   "1203",
+				Platform:            "4",
+				PlatformChanged:     true,
+				Destination:         []model.Pair{{Description: "London Euston"}},
+			},
+			ServiceUID: "S1",
+			RunDate:    "2020-02-12",
+			ATOCName:   "Avanti West Coast",
+		},
+		{
+			LocationDetail: model.LocationDetail{GBTTBookedDeparture: "1205", CancelReasonCode: "TG"},
+			ServiceUID:     "S2",
+			RunDate:        "2020-02-12",
+			Destination:    []model.Pair{{Description: "Crewe"}, {Description: "Chester"}},
+		},
+		{
+			LocationDetail: model.LocationDetail{
+				RealTimeActivated:       true,
+				GBTTBookedDeparture:     "1210",
+				RealTimeDeparture:       "1210",
+				RealTimeDepartureActual: true,
+			},
+			ServiceUID: "S3",
+			RunDate:    "2020-02-12",
+		},
+	}}
+
+	expected := []Row{
+		{Key: "S1/2020-02-12", UID: "S1", RunDate: "2020-02-12", Time: "12:00", Destination: "London Euston", Platform: "4", PlatformChanged: true, Expected: "Exp 12:03",
+			Operator: "Avanti West Coast"},
+		{Key: "S2/2020-02-12", UID: "S2", RunDate: "2020-02-12", Time: "12:05", Destination: "Crewe & Chester", Expected: "Cancelled", Cancelled: true},
+		{Key: "S3/2020-02-12", UID: "S3", RunDate: "2020-02-12", Time: "12:10", Expected: "Departed"},
+	}
+	if got := rows(lineup); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Got wrong rows, got %+v, expected %+v", got, expected)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a, b, c := Row{Key: "A", UID: "A", Time: "12:00"}, Row{Key: "B", UID: "B", Time: "12:05"}, Row{Key: "C", UID: "C", Time: "12:10"}
+	late := b
+	late.Expected = "Exp 12:09"
+
+	ts := []struct {
+		name          string
+		before, after []Row
+		expected      Update
+		changed       bool
+	}{
+		{"unchanged", []Row{a, b}, []Row{a, b}, Update{}, false},
+		{"first", nil, []Row{a, b}, Update{Changed: []Row{a, b}, Order: []string{"A", "B"}}, true},
+		{"changed", []Row{a, b}, []Row{a, late}, Update{Changed: []Row{late}, Order: []string{"A", "B"}}, true},
+		{"added-removed", []Row{a, b}, []Row{b, c}, Update{Changed: []Row{c}, Removed: []string{"A"}, Order: []string{"B", "C"}}, true},
+		{"reordered", []Row{a, b}, []Row{b, a}, Update{Order: []string{"B", "A"}}, true},
+		{"emptied", []Row{a}, nil, Update{Removed: []string{"A"}, Order: []string{}}, true},
+	}
+
+	for _, tc := range ts {
+		got, changed := diff(tc.before, tc.after)
+		if changed != tc.changed || !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("%s: Got wrong update, got %+v (%t), expected %+v (%t)", tc.name, got, changed, tc.expected, tc.changed)
+		}
+	}
+}
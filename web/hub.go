@@ -0,0 +1,257 @@
+package web
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/filter"
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// Source is where boards and services come from, an api.User outside of tests
+type Source interface {
+	Departures(origin string) (model.Lineup, error)
+	ServiceInfo(id string, date time.Time) (model.Service, error)
+}
+
+// updateBuffer is how many events a subscriber can fall behind by before it is dropped
+const updateBuffer = 16
+
+var (
+	// ErrBadTopic is returned for a topic which isn't a station's board or a service on a date
+	ErrBadTopic = errors.New("expected a station CRS, or a service UID with an optional date")
+
+	crsCode    = regexp.MustCompile(`^[A-Z]{3}$`)
+	serviceUID = regexp.MustCompile(`^[A-Z0-9]{1,10}$`)
+)
+
+// Topic is what a subscriber watches, either a station's board or a service running on a date. A board
+// can be narrowed down by a filter, each filter being a topic of its own
+type Topic struct {
+	Station string `json:"station,omitempty"`
+	Filter  string `json:"filter,omitempty"`
+	Service string `json:"service,omitempty"`
+	Date    string `json:"date,omitempty"`
+}
+
+// Normalise checks a topic, upper casing its codes and filling in today's date for a service without one.
+// A filter which can't be parsed gives its *filter.SyntaxError
+func (t Topic) Normalise() (Topic, error) {
+	t.Station, t.Service = strings.ToUpper(t.Station), strings.ToUpper(t.Service)
+	t.Filter = strings.TrimSpace(t.Filter)
+	switch {
+	case t.Station != "" && t.Service == "" && t.Date == "" && crsCode.MatchString(t.Station):
+		if _, err := filter.Parse(t.Filter); err != nil {
+			return t, err
+		}
+		return t, nil
+	case t.Station == "" && t.Filter == "" && serviceUID.MatchString(t.Service):
+		if t.Date == "" {
+			t.Date = time.Now().In(model.London).Format("2006-01-02")
+		}
+		if _, err := time.ParseInLocation("2006-01-02", t.Date, model.London); err == nil {
+			return t, nil
+		}
+	}
+	return t, ErrBadTopic
+}
+
+// Event is a change to a topic, Board is set for stations and Stops for services
+type Event struct {
+	Topic
+	Board *Update        `json:"board,omitempty"`
+	Stops *ServiceUpdate `json:"stops,omitempty"`
+}
+
+// Hub shares one upstream poll of each topic between everyone watching it. A topic is polled from
+// its first subscriber until an interval passes with none left, so a page load followed by its
+// event stream only fetches the board once
+type Hub struct {
+	source   Source
+	interval time.Duration
+
+	mu     sync.Mutex
+	feeds  map[Topic]*feed
+	closed bool
+	done   chan struct{}
+}
+
+// feed is a topic being polled, and who is watching it
+type feed struct {
+	topic       Topic
+	filter      filter.Expression
+	subscribers map[chan Event]struct{}
+
+	// polled is set once the topic has been fetched, the rest are from the last fetch
+	polled bool
+	rows   []Row
+	stops  []Stop
+	err    string
+}
+
+// snapshot is the event bringing a new subscriber up to date
+func (f *feed) snapshot() Event {
+	e := Event{Topic: f.topic}
+	if f.topic.Station != "" {
+		e.Board = &Update{Changed: f.rows, Order: keys(f.rows), Error: f.err}
+	} else {
+		e.Stops = &ServiceUpdate{Changed: f.stops, Length: len(f.stops), Error: f.err}
+	}
+	return e
+}
+
+// update takes in a fetch of the topic, returning the event for subscribers and whether anything changed
+func (f *feed) update(lineup model.Lineup, service model.Service, err error) (Event, bool) {
+	e := Event{Topic: f.topic}
+
+	if err != nil {
+		changed := err.Error() != f.err
+		f.err = err.Error()
+		if f.topic.Station != "" {
+			e.Board = &Update{Error: f.err}
+		} else {
+			e.Stops = &ServiceUpdate{Length: len(f.stops), Error: f.err}
+		}
+		return e, changed
+	}
+
+	recovered := f.err != ""
+	f.err = ""
+	if f.topic.Station != "" {
+		next := rows(filter.Apply(f.filter, lineup))
+		u, changed := diff(f.rows, next)
+		f.rows, e.Board = next, &u
+		return e, changed || recovered
+	}
+
+	next := stops(service)
+	u, changed := diffStops(f.stops, next)
+	f.stops, e.Stops = next, &u
+	return e, changed || recovered
+}
+
+// NewHub creates a hub polling each topic from source every interval
+func NewHub(source Source, interval time.Duration) *Hub {
+	return &Hub{source: source, interval: interval, feeds: make(map[Topic]*feed), done: make(chan struct{})}
+}
+
+// Subscribe watches a topic, which must have been normalised. The first event has the whole board or
+// service, sent as soon as it has been fetched, then further events come as it changes. The channel is
+// closed if the subscriber falls too far behind or the hub is closed, and cancel must be called once the
+// subscriber is finished with it
+func (h *Hub) Subscribe(t Topic) (events <-chan Event, cancel func()) {
+	ch := make(chan Event, updateBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	f, ok := h.feeds[t]
+	if !ok {
+
+		// normalised topics have filters which parse
+		expr, _ := filter.Parse(t.Filter)
+		f = &feed{topic: t, filter: expr, subscribers: make(map[chan Event]struct{})}
+		h.feeds[t] = f
+		go h.poll(f)
+	}
+	f.subscribers[ch] = struct{}{}
+	if f.polled {
+		ch <- f.snapshot()
+	}
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := f.subscribers[ch]; ok {
+			delete(f.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close stops polling and closes every subscriber's channel
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	close(h.done)
+	for _, f := range h.feeds {
+		for ch := range f.subscribers {
+			delete(f.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// poll refreshes a topic every interval, until there is no one left watching it
+func (h *Hub) poll(f *feed) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.refresh(f)
+
+		select {
+		case <-ticker.C:
+		case <-h.done:
+			return
+		}
+
+		h.mu.Lock()
+		idle := len(f.subscribers) == 0
+		if idle {
+			delete(h.feeds, f.topic)
+		}
+		h.mu.Unlock()
+		if idle {
+			return
+		}
+	}
+}
+
+// refresh fetches a topic and sends any change to its subscribers
+func (h *Hub) refresh(f *feed) {
+	var lineup model.Lineup
+	var service model.Service
+	var err error
+	if f.topic.Station != "" {
+		lineup, err = h.source.Departures(f.topic.Station)
+	} else {
+		date, _ := time.ParseInLocation("2006-01-02", f.topic.Date, model.London)
+		service, err = h.source.ServiceInfo(f.topic.Service, date)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e, changed := f.update(lineup, service, err)
+
+	// everyone waiting on the first fetch gets the whole topic
+	if !f.polled {
+		f.polled, e, changed = true, f.snapshot(), true
+	}
+	if !changed {
+		return
+	}
+
+	for ch := range f.subscribers {
+		select {
+		case ch <- e:
+		default:
+
+			// it has missed events, so drop it to start again from a snapshot
+			delete(f.subscribers, ch)
+			close(ch)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Package web serves live departure boards to browsers. Each station's board is an HTML page, kept up to
+// date by server-sent events carrying only what has changed, and every screen watching a station shares
+// a single upstream poll of it. Apps can also subscribe to boards and services over a websocket
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/filter"
+)
+
+// pageWait is how long a page waits for a board it has never fetched before, before rendering it empty
+const pageWait = 10 * time.Second
+
+// crsPattern matches the paths of boards, /board/CRS, and their event streams, /board/CRS/events
+var crsPattern = regexp.MustCompile(`^/board/([A-Za-z]{3})(/events)?/?$`)
+
+// Server serves departure boards, at /board/CRS, with their updates streamed from /board/CRS/events.
+// Either can be given a filter, e.g. /board/CRS?filter=operator=NT, to show only the services matching it.
+// Boards and services can also be subscribed to over a websocket at /stream
+type Server struct {
+	hub *Hub
+}
+
+// NewServer creates a server whose boards are fetched from source every interval
+func NewServer(source Source, interval time.Duration) *Server {
+	return &Server{hub: NewHub(source, interval)}
+}
+
+// Close stops polling boards and ends every event stream
+func (s *Server) Close() {
+	s.hub.Close()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.URL.Path == "/stream" {
+		if conn, err := upgrade(w, r); err == nil {
+			s.stream(conn)
+		}
+		return
+	}
+
+	match := crsPattern.FindStringSubmatch(r.URL.Path)
+	if match == nil {
+		http.NotFound(w, r)
+		return
+	}
+	crs := strings.ToUpper(match[1])
+
+	if match[2] != "" {
+		s.events(w, r, crs)
+		return
+	}
+	s.page(w, r, crs)
+}
+
+// boardTopic is the topic of a station's board, narrowed down by the filter in the request's query. A
+// filter which can't be parsed is answered with a bad request, returning false
+func boardTopic(w http.ResponseWriter, r *http.Request, crs string) (Topic, bool) {
+	t, err := Topic{Station: crs, Filter: r.URL.Query().Get(filter.QueryParameter)}.Normalise()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return t, false
+	}
+	return t, true
+}
+
+// page renders a station's board as it is now, waiting for it to be fetched if no one is watching it yet
+func (s *Server) page(w http.ResponseWriter, r *http.Request, crs string) {
+	t, ok := boardTopic(w, r, crs)
+	if !ok {
+		return
+	}
+	events, cancel := s.hub.Subscribe(t)
+	defer cancel()
+
+	var board Update
+	select {
+	case e, ok := <-events:
+		if ok {
+			board = *e.Board
+		}
+	case <-time.After(pageWait):
+	case <-r.Context().Done():
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := pageTemplate.Execute(w, struct {
+		CRS string
+		Update
+	}{crs, board}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// events streams a station's board as server-sent events, one "update" event per change
+func (s *Server) events(w http.ResponseWriter, r *http.Request, crs string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	t, ok := boardTopic(w, r, crs)
+	if !ok {
+		return
+	}
+
+	events, cancel := s.hub.Subscribe(t)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(e.Board)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "event: update\ndata: %s\n\n", data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+var pageTemplate = template.Must(template.New("board").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.CRS}} departures</title>
+<style>
+body { background: #000; color: #f5a623; font-family: monospace; font-size: 2vw; margin: 2vw; }
+table { width: 100%; border-collapse: collapse; }
+th { text-align: left; color: #fff; }
+td, th { padding: 0.2em 0.5em; }
+.changed { color: #000; background: #f5a623; }
+.cancelled { color: #ff4b4b; }
+#error { color: #ff4b4b; }
+</style>
+</head>
+<body>
+<h1>{{.CRS}} departures</h1>
+<p id="error">{{.Error}}</p>
+<table>
+<thead><tr><th>Time</th><th>Destination</th><th>Plat</th><th>Expected</th><th>Operator</th></tr></thead>
+<tbody id="services">
+{{- range .Changed}}
+<tr id="s-{{.Key}}"{{if .Cancelled}} class="cancelled"{{end}}><td>{{.Time}}</td><td>{{.Destination}}</td>
+<td{{if .PlatformChanged}} class="changed"{{end}}>{{.Platform}}</td><td>{{.Expected}}</td><td>{{.Operator}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+<script>
+(function () {
+	var services = document.getElementById("services");
+	var fields = ["time", "destination", "platform", "expected", "operator"];
+
+	function fill(row, service) {
+		row.className = service.cancelled ? "cancelled" : "";
+		while (row.cells.length < fields.length) {
+			row.insertCell();
+		}
+		fields.forEach(function (field, i) {
+			row.cells[i].textContent = service[field];
+		});
+		row.cells[2].className = service.platformChanged ? "changed" : "";
+	}
+
+	var events = new EventSource(location.pathname.replace(/\/$/, "") + "/events" + location.search);
+	events.addEventListener("update", function (e) {
+		var update = JSON.parse(e.data);
+		(update.removed || []).forEach(function (key) {
+			var row = document.getElementById("s-" + key);
+			if (row) {
+				row.remove();
+			}
+		});
+		(update.changed || []).forEach(function (service) {
+			var row = document.getElementById("s-" + service.key);
+			if (!row) {
+				row = services.insertRow();
+				row.id = "s-" + service.key;
+			}
+			fill(row, service);
+		});
+		if (update.order) {
+			var keep = {};
+			update.order.forEach(function (key) {
+				keep["s-" + key] = true;
+				services.appendChild(document.getElementById("s-" + key));
+			});
+			Array.prototype.slice.call(services.rows).forEach(function (row) {
+				if (!keep[row.id]) {
+					row.remove();
+				}
+			});
+		}
+		document.getElementById("error").textContent = update.error || "";
+	});
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,327 @@
+package web
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// fakeSource serves a board of the given destinations, and services calling at them, counting requests
+// for each station and service
+type fakeSource struct {
+	mu           sync.Mutex
+	destinations []string
+	err          error
+	requests     map[string]int
+}
+
+func newFakeSource(destinations ...string) *fakeSource {
+	return &fakeSource{destinations: destinations, requests: make(map[string]int)}
+}
+
+func (f *fakeSource) Departures(origin string) (model.Lineup, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[origin]++
+
+	var lineup model.Lineup
+	for _, d := range f.destinations {
+		lineup.Services = append(lineup.Services, model.LocationContainer{
+			LocationDetail: model.LocationDetail{GBTTBookedDeparture: "1200", Destination: []model.Pair{{Description: d}}},
+			ServiceUID:     d,
+			RunDate:        "2020-02-12",
+		})
+	}
+	return lineup, f.err
+}
+
+func (f *fakeSource) ServiceInfo(id string, date time.Time) (model.Service, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[id+" "+date.Format("2006-01-02")]++
+
+	service := model.Service{ServiceUID: id, RunDate: date.Format("2006-01-02")}
+	for _, d := range f.destinations {
+		service.Locations = append(service.Locations, model.LocationDetail{
+			TIPLOC: d, Description: d, GBTTBookedArrival: "1200", IsCall: true, IsCallPublic: true,
+		})
+	}
+	return service, f.err
+}
+
+func (f *fakeSource) set(err error, destinations ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.destinations, f.err = destinations, err
+}
+
+func (f *fakeSource) count(crs string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[crs]
+}
+
+// next waits for an event, failing the test if none comes
+func next(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		if !ok {
+			t.Fatal("Got closed events")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("Got no event")
+	}
+	return Event{}
+}
+
+func TestHubSharesPolls(t *testing.T) {
+	source := newFakeSource("Crewe")
+	hub := NewHub(source, time.Hour)
+	defer hub.Close()
+
+	first, cancelFirst := hub.Subscribe(Topic{Station: "MAN"})
+	defer cancelFirst()
+	next(t, first)
+
+	// a later subscriber gets the board without fetching it again
+	second, cancelSecond := hub.Subscribe(Topic{Station: "MAN"})
+	defer cancelSecond()
+	if u := next(t, second).Board; len(u.Changed) != 1 || u.Changed[0].Destination != "Crewe" {
+		t.Errorf("Got wrong snapshot, got %+v", u)
+	}
+	if got := source.count("MAN"); got != 1 {
+		t.Errorf("Got wrong number of requests, got %d, expected %d", got, 1)
+	}
+}
+
+func TestHubUpdates(t *testing.T) {
+	source := newFakeSource("Crewe")
+	hub := NewHub(source, 10*time.Millisecond)
+	defer hub.Close()
+
+	updates, cancel := hub.Subscribe(Topic{Station: "MAN"})
+	defer cancel()
+	next(t, updates)
+
+	source.set(nil, "Crewe", "Chester")
+	if u := next(t, updates).Board; len(u.Changed) != 1 || u.Changed[0].UID != "Chester" || len(u.Order) != 2 {
+		t.Errorf("Got wrong update, got %+v", u)
+	}
+
+	// failing keeps the rows, and recovering clears the error
+	source.set(errors.New("API rate limit exceeded"), "Chester")
+	if u := next(t, updates).Board; u.Error != "API rate limit exceeded" || u.Order != nil {
+		t.Errorf("Got wrong update, got %+v", u)
+	}
+	source.set(nil, "Chester")
+	if u := next(t, updates).Board; u.Error != "" || !sameKeys(u.Removed, "Crewe") {
+		t.Errorf("Got wrong update, got %+v", u)
+	}
+}
+
+func TestHubServices(t *testing.T) {
+	source := newFakeSource("Crewe", "Chester")
+	hub := NewHub(source, 10*time.Millisecond)
+	defer hub.Close()
+
+	topic, err := Topic{Service: "w12345", Date: "2020-02-12"}.Normalise()
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, cancel := hub.Subscribe(topic)
+	defer cancel()
+
+	first := next(t, events)
+	if first.Service != "W12345" || first.Stops == nil || first.Stops.Length != 2 || first.Stops.Changed[1].Name != "Chester" ||
+		first.Stops.Changed[1].BookedArrival != "2020-02-12T12:00:00Z" {
+		t.Errorf("Got wrong snapshot, got %+v", first.Stops)
+	}
+	if got := source.count("W12345 2020-02-12"); got != 1 {
+		t.Errorf("Got wrong number of requests, got %d, expected %d", got, 1)
+	}
+
+	source.set(nil, "Crewe", "Holyhead")
+	if u := next(t, events).Stops; len(u.Changed) != 1 || u.Changed[0].Index != 1 || u.Changed[0].Name != "Holyhead" {
+		t.Errorf("Got wrong update, got %+v", u)
+	}
+}
+
+func TestNormalise(t *testing.T) {
+	today := time.Now().In(model.London).Format("2006-01-02")
+
+	ts := []struct {
+		topic    Topic
+		expected Topic
+		fails    bool
+	}{
+		{Topic{Station: "man"}, Topic{Station: "MAN"}, false},
+		{Topic{Service: "w12345", Date: "2020-02-12"}, Topic{Service: "W12345", Date: "2020-02-12"}, false},
+		{Topic{Service: "W12345"}, Topic{Service: "W12345", Date: today}, false},
+		{Topic{}, Topic{}, true},
+		{Topic{Station: "MANC"}, Topic{}, true},
+		{Topic{Station: "MAN", Service: "W12345"}, Topic{}, true},
+		{Topic{Station: "MAN", Date: "2020-02-12"}, Topic{}, true},
+		{Topic{Service: "W12345", Date: "2020-02-30"}, Topic{}, true},
+		{Topic{Service: "../W12345"}, Topic{}, true},
+		{Topic{Station: "man", Filter: " operator=NT "}, Topic{Station: "MAN", Filter: "operator=NT"}, false},
+		{Topic{Station: "MAN", Filter: "operator="}, Topic{}, true},
+		{Topic{Service: "W12345", Filter: "operator=NT"}, Topic{}, true},
+	}
+
+	for _, tc := range ts {
+		got, err := tc.topic.Normalise()
+		if (err != nil) != tc.fails || (!tc.fails && got != tc.expected) {
+			t.Errorf("Got wrong topic for %+v, got %+v (%v), expected %+v", tc.topic, got, err, tc.expected)
+		}
+	}
+}
+
+// sameKeys checks a list of row keys against the UIDs expected, all running on the fake source's run date
+func sameKeys(got []string, uids ...string) bool {
+	expected := make([]string, len(uids))
+	for i, uid := range uids {
+		expected[i] = uid + "/2020-02-12"
+	}
+	return strings.Join(got, ",") == strings.Join(expected, ",")
+}
+
+func TestHubStopsPolling(t *testing.T) {
+	source := newFakeSource("Crewe")
+	hub := NewHub(source, 10*time.Millisecond)
+	defer hub.Close()
+
+	updates, cancel := hub.Subscribe(Topic{Station: "MAN"})
+	next(t, updates)
+	cancel()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		hub.mu.Lock()
+		_, polling := hub.feeds[Topic{Station: "MAN"}]
+		hub.mu.Unlock()
+		if !polling {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Got station still polled without subscribers")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	requests := source.count("MAN")
+	time.Sleep(50 * time.Millisecond)
+	if got := source.count("MAN"); got != requests {
+		t.Errorf("Got requests after polling stopped, got %d, expected %d", got, requests)
+	}
+}
+
+func TestServer(t *testing.T) {
+	source := newFakeSource("Crewe", "<Chester>")
+	server := NewServer(source, 10*time.Millisecond)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	t.Run("page", func(t *testing.T) {
+		response, err := client.Get(ts.URL + "/board/man")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+
+		for _, expected := range []string{"MAN departures", `<tr id="s-Crewe/2020-02-12">`, "&lt;Chester&gt;", `"/events"`} {
+			if !strings.Contains(string(body), expected) {
+				t.Errorf("Got page without %q, got\n%s", expected, body)
+			}
+		}
+	})
+
+	t.Run("filtered", func(t *testing.T) {
+		response, err := client.Get(ts.URL + "/board/MAN?filter=destination%3DCrewe")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+
+		if !strings.Contains(string(body), `<tr id="s-Crewe/2020-02-12">`) || strings.Contains(string(body), "&lt;Chester&gt;") {
+			t.Errorf("Got wrong filtered page, got\n%s", body)
+		}
+	})
+
+	t.Run("bad-filter", func(t *testing.T) {
+		for _, path := range []string{"/board/MAN?filter=operator%3D", "/board/MAN/events?filter=operator%3D"} {
+			response, err := client.Get(ts.URL + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := ioutil.ReadAll(response.Body)
+			response.Body.Close()
+			if response.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "filter: ") {
+				t.Errorf("Got wrong response for %s, got %d %s, expected %d", path, response.StatusCode, body, http.StatusBadRequest)
+			}
+		}
+	})
+
+	t.Run("not-found", func(t *testing.T) {
+		for _, path := range []string{"/", "/board/", "/board/MANC", "/board/MAN/other"} {
+			response, err := client.Get(ts.URL + path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if response.StatusCode != http.StatusNotFound {
+				t.Errorf("Got wrong status for %s, got %d, expected %d", path, response.StatusCode, http.StatusNotFound)
+			}
+		}
+	})
+
+	t.Run("events", func(t *testing.T) {
+		response, err := client.Get(ts.URL + "/board/MAN/events")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		if got := response.Header.Get("Content-Type"); got != "text/event-stream" {
+			t.Errorf("Got wrong content type, got %s", got)
+		}
+
+		events := bufio.NewScanner(response.Body)
+		read := func() Update {
+			var u Update
+			for events.Scan() {
+				line := events.Text()
+				if strings.HasPrefix(line, "data: ") {
+					if err := json.Unmarshal([]byte(line[len("data: "):]), &u); err != nil {
+						t.Fatal(err)
+					}
+					return u
+				}
+			}
+			t.Fatalf("Got no event, %v", events.Err())
+			return u
+		}
+
+		if u := read(); !sameKeys(u.Order, "Crewe", "<Chester>") {
+			t.Errorf("Got wrong snapshot, got %+v", u)
+		}
+		source.set(nil, "<Chester>")
+		if u := read(); len(u.Changed) != 0 || !sameKeys(u.Removed, "Crewe") || !sameKeys(u.Order, "<Chester>") {
+			t.Errorf("Got wrong update, got %+v", u)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package web
+
+import (
+	"time"
+
+	"github.com/georgeprice/realtime-trains-golang/model"
+)
+
+// Stop is a public call made by a service, with times in RFC 3339 and left out where RTT has none
+type Stop struct {
+
+	// Index is the call's position in the service's Locations
+	Index  int    `json:"index"`
+	TIPLOC string `json:"tiploc"`
+	CRS    string `json:"crs,omitempty"`
+	Name   string `json:"name"`
+
+	BookedArrival     string `json:"bookedArrival,omitempty"`
+	BookedDeparture   string `json:"bookedDeparture,omitempty"`
+	RealtimeArrival   string `json:"realtimeArrival,omitempty"`
+	RealtimeDeparture string `json:"realtimeDeparture,omitempty"`
+
+	// Arrived and Departed are set once RTT has an actual report rather than a forecast
+	Arrived  bool `json:"arrived"`
+	Departed bool `json:"departed"`
+
+	Platform        string `json:"platform,omitempty"`
+	PlatformChanged bool   `json:"platformChanged,omitempty"`
+	Cancelled       bool   `json:"cancelled,omitempty"`
+}
+
+// ServiceUpdate is a change to a service. A subscriber's first update has every stop in Changed,
+// after that only stops which have changed are sent
+type ServiceUpdate struct {
+	Changed []Stop `json:"changed,omitempty"`
+
+	// Length is how many stops the service has, if it changes Changed has all of them
+	Length int `json:"length"`
+
+	// Error is set while the service can't be refreshed, the stops are kept from the last refresh
+	Error string `json:"error,omitempty"`
+}
+
+// stamp formats a time of a location, leaving it out where RTT has none
+func stamp(get func(string) (time.Time, error), runDate string) string {
+	t, err := get(runDate)
+	if err != nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// stops lists a service's public calls
+func stops(service model.Service) []Stop {
+	var stops []Stop
+	for i, d := range service.Locations {
+		if !d.PublicCall() {
+			continue
+		}
+		stops = append(stops, Stop{
+			Index:             i,
+			TIPLOC:            d.TIPLOC,
+			CRS:               d.CRS,
+			Name:              d.Description,
+			BookedArrival:     stamp(d.BookedArrivalTime, service.RunDate),
+			BookedDeparture:   stamp(d.BookedDepartureTime, service.RunDate),
+			RealtimeArrival:   stamp(d.RealtimeArrivalTime, service.RunDate),
+			RealtimeDeparture: stamp(d.RealtimeDepartureTime, service.RunDate),
+			Arrived:           d.RealTimeArrivalActual,
+			Departed:          d.RealTimeDepartureActual,
+			Platform:          d.Platform,
+			PlatformChanged:   d.PlatformChanged,
+			Cancelled:         d.Cancelled() || service.PlannedCancel,
+		})
+	}
+	return stops
+}
+
+// diffStops works out the update taking a service from before to after, and whether anything changed
+func diffStops(before, after []Stop) (ServiceUpdate, bool) {
+	u := ServiceUpdate{Length: len(after)}
+	if len(before) != len(after) {
+		u.Changed = after
+		return u, true
+	}
+
+	for i := range after {
+		if before[i] != after[i] {
+			u.Changed = append(u.Changed, after[i])
+		}
+	}
+	return u, len(u.Changed) > 0
+}
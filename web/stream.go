@@ -0,0 +1,170 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// maxSubscriptions is how many topics one connection can watch at once
+const maxSubscriptions = 50
+
+// request is a message from a client, asking to subscribe to or unsubscribe from a topic, e.g.
+// {"type": "subscribe", "station": "MAN"} or {"type": "subscribe", "service": "W12345", "date": "2020-02-12"}
+type request struct {
+	Type string `json:"type"`
+	Topic
+
+	// invalid is why the message couldn't be read as a request
+	invalid error
+}
+
+// response is a message to a client. Updates are "update" messages carrying an event, subscribing and
+// unsubscribing are acknowledged by "subscribed" and "unsubscribed" messages with the normalised topic,
+// and requests which can't be met are answered by an "error" message
+type response struct {
+	Type string `json:"type"`
+	Event
+	Error string `json:"error,omitempty"`
+}
+
+// subscription is a connection's subscription to a topic
+type subscription struct {
+	topic  Topic
+	cancel func()
+}
+
+// delivery is an event for a subscription, ok is false once the hub has closed its channel
+type delivery struct {
+	sub   *subscription
+	event Event
+	ok    bool
+}
+
+// stream serves a websocket, pushing events for the topics the client subscribes to
+func (s *Server) stream(conn *wsConn) {
+	requests := make(chan request)
+	failed := make(chan error, 1)
+	done := make(chan struct{})
+	go func() {
+		for {
+			message, err := conn.readMessage()
+			if err != nil {
+				failed <- err
+				return
+			}
+
+			var r request
+			if err := json.Unmarshal(message, &r); err != nil {
+				r = request{invalid: err}
+			}
+			select {
+			case requests <- r:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	subs := make(map[Topic]*subscription)
+	deliveries := make(chan delivery)
+	defer func() {
+		close(done)
+		for _, sub := range subs {
+			sub.cancel()
+		}
+	}()
+
+	// subscribe forwards a topic's events until the hub closes its channel
+	subscribe := func(t Topic) {
+		events, cancel := s.hub.Subscribe(t)
+		sub := &subscription{topic: t, cancel: cancel}
+		subs[t] = sub
+		go func() {
+			for {
+				e, ok := <-events
+				select {
+				case deliveries <- delivery{sub, e, ok}:
+				case <-done:
+					return
+				}
+				if !ok {
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		select {
+		case r := <-requests:
+			if err := s.handle(conn, r, subs, subscribe); err != nil {
+				conn.close(closeGoingAway, "")
+				return
+			}
+
+		case d := <-deliveries:
+
+			// events from a subscription since cancelled are dropped
+			if subs[d.sub.topic] != d.sub {
+				continue
+			}
+			if !d.ok {
+				select {
+				case <-s.hub.done:
+					conn.close(closeGoingAway, "server shutting down")
+					return
+				default:
+				}
+
+				// the hub dropped it for falling behind, so start again from a snapshot
+				subscribe(d.sub.topic)
+				continue
+			}
+			if err := conn.writeJSON(response{Type: "update", Event: d.event}); err != nil {
+				conn.close(closeGoingAway, "")
+				return
+			}
+
+		case err := <-failed:
+			if e, ok := err.(*protocolError); ok {
+				conn.close(e.code, e.reason)
+			} else if err != errClosed {
+				conn.close(closeUnexpected, "")
+			}
+			return
+
+		case <-s.hub.done:
+			conn.close(closeGoingAway, "server shutting down")
+			return
+		}
+	}
+}
+
+// handle answers a request, returning an error only when the connection has failed
+func (s *Server) handle(conn *wsConn, r request, subs map[Topic]*subscription, subscribe func(Topic)) error {
+	t, err := r.Topic.Normalise()
+
+	switch {
+	case r.invalid != nil:
+		err = fmt.Errorf("bad request: %v", r.invalid)
+	case r.Type != "subscribe" && r.Type != "unsubscribe":
+		err = fmt.Errorf("unknown request type %q, expected subscribe or unsubscribe", r.Type)
+	case err != nil:
+	case r.Type == "subscribe" && subs[t] == nil && len(subs) >= maxSubscriptions:
+		err = fmt.Errorf("too many subscriptions, at most %d", maxSubscriptions)
+	case r.Type == "subscribe":
+		if subs[t] == nil {
+			subscribe(t)
+		}
+	default:
+		if sub := subs[t]; sub != nil {
+			sub.cancel()
+			delete(subs, t)
+		}
+	}
+
+	if err != nil {
+		return conn.writeJSON(response{Type: "error", Event: Event{Topic: r.Topic}, Error: err.Error()})
+	}
+	return conn.writeJSON(response{Type: r.Type + "d", Event: Event{Topic: t}})
+}
@@ -0,0 +1,226 @@
+package web
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptKey(t *testing.T) {
+
+	// the example from RFC 6455
+	if got, expected := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="; got != expected {
+		t.Errorf("Got wrong accept key, got %s, expected %s", got, expected)
+	}
+}
+
+// wsClient is the client end of a websocket, masking its frames as clients must
+type wsClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, server *httptest.Server) *wsClient {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	fmt.Fprint(conn, "GET /stream HTTP/1.1\r\nHost: rtt\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	r := bufio.NewReader(conn)
+	response, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols || response.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Got wrong handshake, got %d %v", response.StatusCode, response.Header)
+	}
+	return &wsClient{t: t, conn: conn, r: r}
+}
+
+func (c *wsClient) send(opcode byte, fin bool, payload []byte) {
+	header := []byte{opcode, 0x80 | byte(len(payload))}
+	if fin {
+		header[0] |= 0x80
+	}
+	mask := []byte{1, 2, 3, 4}
+	masked := make([]byte, len(payload))
+	for i := range payload {
+		masked[i] = payload[i] ^ mask[i%4]
+	}
+	if _, err := c.conn.Write(append(append(header, mask...), masked...)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *wsClient) request(kind string, topic Topic) {
+	data, _ := json.Marshal(request{Type: kind, Topic: topic})
+	c.send(opText, true, data)
+}
+
+func (c *wsClient) read() (byte, []byte) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	length := int(header[1] & 0x7f)
+	switch length {
+	case 126:
+		var extended [2]byte
+		io.ReadFull(c.r, extended[:])
+		length = int(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		io.ReadFull(c.r, extended[:])
+		length = int(binary.BigEndian.Uint64(extended[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		c.t.Fatal(err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+// response reads messages until one of the given type, skipping updates
+func (c *wsClient) response(kind string) response {
+	for {
+		opcode, payload := c.read()
+		if opcode != opText {
+			c.t.Fatalf("Got wrong opcode, got %d, expected %d", opcode, opText)
+		}
+		var r response
+		if err := json.Unmarshal(payload, &r); err != nil {
+			c.t.Fatal(err)
+		}
+		if r.Type == kind {
+			return r
+		}
+		if r.Type != "update" {
+			c.t.Fatalf("Got wrong response, got %s", payload)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	source := newFakeSource("Crewe", "Chester")
+	server := NewServer(source, 10*time.Millisecond)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	defer server.Close()
+
+	c := dial(t, ts)
+	defer c.conn.Close()
+
+	c.request("subscribe", Topic{Station: "man"})
+	if r := c.response("subscribed"); r.Station != "MAN" {
+		t.Errorf("Got wrong subscription, got %+v", r.Topic)
+	}
+	if r := c.response("update"); r.Station != "MAN" || r.Board == nil || !sameKeys(r.Board.Order, "Crewe", "Chester") {
+		t.Errorf("Got wrong board, got %+v", r.Event)
+	}
+
+	// a filtered board is a topic of its own, with only the services matching
+	c.request("subscribe", Topic{Station: "MAN", Filter: "destination=Chester"})
+	if r := c.response("subscribed"); r.Station != "MAN" || r.Filter != "destination=Chester" {
+		t.Errorf("Got wrong subscription, got %+v", r.Topic)
+	}
+	if r := c.response("update"); r.Filter != "destination=Chester" || r.Board == nil || !sameKeys(r.Board.Order, "Chester") {
+		t.Errorf("Got wrong filtered board, got %+v", r.Event)
+	}
+	c.request("unsubscribe", Topic{Station: "MAN", Filter: "destination=Chester"})
+	c.response("unsubscribed")
+
+	c.request("subscribe", Topic{Service: "W12345", Date: "2020-02-12"})
+	c.response("subscribed")
+	if r := c.response("update"); r.Service != "W12345" || r.Stops == nil || r.Stops.Length != 2 {
+		t.Errorf("Got wrong service, got %+v", r.Event)
+	}
+
+	// a change comes through for both the board and the service
+	source.set(nil, "Crewe", "Holyhead")
+	board, service := false, false
+	for !board || !service {
+		r := c.response("update")
+		board = board || r.Board != nil && len(r.Board.Changed) == 1 && r.Board.Changed[0].UID == "Holyhead"
+		service = service || r.Stops != nil && len(r.Stops.Changed) == 1 && r.Stops.Changed[0].Name == "Holyhead"
+	}
+
+	c.request("unsubscribe", Topic{Station: "MAN"})
+	if r := c.response("unsubscribed"); r.Station != "MAN" {
+		t.Errorf("Got wrong unsubscription, got %+v", r.Topic)
+	}
+
+	// bad requests are answered with errors, leaving the connection open
+	for _, message := range []string{`{"type": "watch", "station": "MAN"}`, `{"type": "subscribe", "station": "MANC"}`, `{"type": "subscribe", "station": "MAN", "filter": "operator="}`, `subscribe`} {
+		c.send(opText, true, []byte(message))
+		if r := c.response("error"); r.Error == "" {
+			t.Errorf("Got no error for %s", message)
+		}
+	}
+
+	// pings are answered, and messages can be split into fragments
+	c.send(opPing, true, []byte("hello"))
+	if opcode, payload := c.read(); opcode != opPong || string(payload) != "hello" {
+		t.Errorf("Got wrong pong, got %d %q", opcode, payload)
+	}
+	c.send(opText, false, []byte(`{"type": "subscribe",`))
+	c.send(opContinuation, true, []byte(` "station": "BHM"}`))
+	if r := c.response("subscribed"); r.Station != "BHM" {
+		t.Errorf("Got wrong subscription, got %+v", r.Topic)
+	}
+
+	// closing is echoed back
+	c.send(opClose, true, []byte{0x03, 0xe8})
+	for {
+		opcode, payload := c.read()
+		if opcode == opClose {
+			if code := binary.BigEndian.Uint16(payload); code != closeNormal {
+				t.Errorf("Got wrong close code, got %d, expected %d", code, closeNormal)
+			}
+			break
+		}
+	}
+}
+
+func TestStreamUnmasked(t *testing.T) {
+	server := NewServer(newFakeSource(), time.Hour)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	defer server.Close()
+
+	c := dial(t, ts)
+	defer c.conn.Close()
+
+	// clients must mask their frames
+	c.conn.Write([]byte{0x81, 2, '{', '}'})
+	if opcode, payload := c.read(); opcode != opClose || binary.BigEndian.Uint16(payload) != closeProtocol {
+		t.Errorf("Got wrong close, got %d %q", opcode, payload)
+	}
+}
+
+func TestUpgradeRejected(t *testing.T) {
+	server := NewServer(newFakeSource(), time.Hour)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	defer server.Close()
+
+	response, err := http.Get(ts.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("Got wrong status, got %d, expected %d", response.StatusCode, http.StatusBadRequest)
+	}
+}